@@ -0,0 +1,144 @@
+package circuit
+
+import (
+	"file-explorers-be/models"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var units = map[string]string{
+	"voltage":      "V",
+	"current":      "A",
+	"power":        "W",
+	"resistance":   "Ω",
+	"voltage_rms":  "V",
+	"voltage_peak": "V",
+	"current_rms":  "A",
+	"current_peak": "A",
+}
+
+// measured is a component's values keyed by quantity, so DC and AC results
+// are checked the same way.
+type measured struct {
+	id, name, kind string
+	values         map[string]float64
+}
+
+// Check compares an evaluation against a challenge's targets. A target names a
+// component by id, name or type and is met when any matching component
+// measures within the relative tolerance; the sign is ignored since the
+// builder does not fix a component's orientation.
+func Check(evaluation models.CircuitEvaluation, targets []models.CircuitTarget, tolerance float64) error {
+	if err := checkTopology(evaluation.Short, evaluation.Open); err != nil {
+		return err
+	}
+
+	components := make([]measured, len(evaluation.Components))
+	for i, result := range evaluation.Components {
+		components[i] = measured{
+			id:   result.ID,
+			name: result.Name,
+			kind: result.Type,
+			values: map[string]float64{
+				"voltage": math.Abs(result.Voltage),
+				"current": math.Abs(result.Current),
+				"power":   math.Abs(result.Power),
+			},
+		}
+		if result.Resistance != nil {
+			components[i].values["resistance"] = *result.Resistance
+		}
+	}
+	return checkTargets(components, targets, tolerance)
+}
+
+// CheckSimulation compares a simulation against a challenge's targets. Plain
+// voltage and current targets are compared with RMS values, which is what a
+// meter shows, and power with the average power.
+func CheckSimulation(simulation models.CircuitSimulation, targets []models.CircuitTarget, tolerance float64) error {
+	if err := checkTopology(simulation.Short, simulation.Open); err != nil {
+		return err
+	}
+
+	components := make([]measured, len(simulation.Components))
+	for i, trace := range simulation.Components {
+		components[i] = measured{
+			id:   trace.ID,
+			name: trace.Name,
+			kind: trace.Type,
+			values: map[string]float64{
+				"voltage":      trace.VoltageRMS,
+				"current":      trace.CurrentRMS,
+				"power":        math.Abs(trace.PowerAverage),
+				"voltage_rms":  trace.VoltageRMS,
+				"voltage_peak": trace.VoltagePeak,
+				"current_rms":  trace.CurrentRMS,
+				"current_peak": trace.CurrentPeak,
+			},
+		}
+	}
+	return checkTargets(components, targets, tolerance)
+}
+
+func checkTopology(short, open bool) error {
+	if short {
+		return fmt.Errorf("The circuit is short-circuited")
+	}
+	if open {
+		return fmt.Errorf("The circuit is not closed")
+	}
+	return nil
+}
+
+func checkTargets(components []measured, targets []models.CircuitTarget, tolerance float64) error {
+	for _, target := range targets {
+		if err := checkTarget(components, target, tolerance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTarget(components []measured, target models.CircuitTarget, tolerance float64) error {
+	unit, ok := units[target.Quantity]
+	if !ok {
+		return fmt.Errorf("Unknown quantity %q", target.Quantity)
+	}
+
+	var closest *float64
+	for _, component := range components {
+		if !component.matches(target.Component) {
+			continue
+		}
+		value, ok := component.values[target.Quantity]
+		if !ok {
+			continue
+		}
+		if within(value, target.Value, tolerance) {
+			return nil
+		}
+		if closest == nil || math.Abs(value-target.Value) < math.Abs(*closest-target.Value) {
+			closest = &value
+		}
+	}
+
+	if closest == nil {
+		return fmt.Errorf("No %s in the circuit", target.Component)
+	}
+	return fmt.Errorf("%s %s is %g %s, expected %g %s", target.Component, target.Quantity, *closest, unit, target.Value, unit)
+}
+
+func (m measured) matches(component string) bool {
+	if component == typeAmmeterAlt {
+		component = TypeAmmeter
+	}
+	return m.id == component || strings.EqualFold(m.name, component) || m.kind == component
+}
+
+func within(value, target, tolerance float64) bool {
+	if target == 0 {
+		return math.Abs(value) <= tolerance
+	}
+	return math.Abs(value-target) <= math.Abs(target)*tolerance
+}
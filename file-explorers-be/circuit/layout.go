@@ -0,0 +1,107 @@
+package circuit
+
+import "fmt"
+
+// Grid used when laying out imported circuits, matching the spacing of the
+// builder's own exports. Components are horizontal and 80 px long.
+const (
+	layoutOriginX  = 480
+	layoutOriginY  = 160
+	layoutSpacingX = 200
+	layoutSpacingY = 160
+	layoutColumns  = 4
+	layoutHalfSize = 40
+)
+
+var idPrefixes = map[string]string{
+	TypeBattery:   "bat",
+	TypeResistor:  "res",
+	TypeBulb:      "bulb",
+	TypeSwitch:    "sw",
+	TypeDiode:     "dio",
+	TypeWire:      "wire",
+	TypeAmmeter:   "amm",
+	TypeVoltmeter: "volt",
+}
+
+// layout places components on a grid in the order a walk from the first
+// battery reaches them, so connected components end up next to each other,
+// and assigns ids in the builder's style. Wires with a single terminal are
+// dropped since nothing else connects to them.
+func layout(c *Circuit) {
+	order := walk(c)
+
+	terminals := map[string]int{}
+	for _, comp := range c.Components {
+		for _, t := range []Terminal{comp.Start, comp.End} {
+			if t.WireID != nil {
+				terminals[*t.WireID]++
+			}
+		}
+	}
+
+	for slot, i := range order {
+		comp := &c.Components[i]
+		comp.ID = fmt.Sprintf("%s_%d", idPrefixes[comp.Type], i+1)
+		comp.X = float64(layoutOriginX + slot%layoutColumns*layoutSpacingX)
+		comp.Y = float64(layoutOriginY + slot/layoutColumns*layoutSpacingY)
+		comp.Start.ID = comp.ID + "_start"
+		comp.Start.X, comp.Start.Y = comp.X-layoutHalfSize, comp.Y
+		comp.End.ID = comp.ID + "_end"
+		comp.End.X, comp.End.Y = comp.X+layoutHalfSize, comp.Y
+
+		for _, t := range []*Terminal{&comp.Start, &comp.End} {
+			if t.WireID != nil && terminals[*t.WireID] < 2 {
+				t.WireID = nil
+			}
+		}
+	}
+}
+
+// walk returns component indexes in breadth-first order over shared wires,
+// starting from the first battery and continuing with any parts left over.
+func walk(c *Circuit) (order []int) {
+	byWire := map[string][]int{}
+	for i, comp := range c.Components {
+		for _, t := range []Terminal{comp.Start, comp.End} {
+			if t.WireID != nil {
+				byWire[*t.WireID] = append(byWire[*t.WireID], i)
+			}
+		}
+	}
+
+	seen := make([]bool, len(c.Components))
+	visit := func(start int) {
+		queue := []int{start}
+		seen[start] = true
+		for len(queue) > 0 {
+			i := queue[0]
+			queue = queue[1:]
+			order = append(order, i)
+			for _, t := range []Terminal{c.Components[i].Start, c.Components[i].End} {
+				if t.WireID == nil {
+					continue
+				}
+				for _, j := range byWire[*t.WireID] {
+					if !seen[j] {
+						seen[j] = true
+						queue = append(queue, j)
+					}
+				}
+			}
+		}
+	}
+
+	for i, comp := range c.Components {
+		if comp.Type == TypeBattery && !seen[i] {
+			visit(i)
+			break
+		}
+	}
+	for i := range c.Components {
+		if !seen[i] {
+			visit(i)
+		}
+	}
+	return
+}
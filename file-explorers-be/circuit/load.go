@@ -0,0 +1,230 @@
+// Package circuit loads circuits exported by the circuit builder and solves
+// them with modified nodal analysis, so challenge answers can be checked on
+// the server instead of trusting the browser simulator.
+package circuit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const Version = "2.0"
+
+// MaxComponents bounds the size of a circuit. Solving it builds a dense
+// matrix, so the work grows with the cube of the component count.
+const MaxComponents = 200
+
+var (
+	ErrUnsupportedVersion = errors.New("Unsupported circuit version")
+	ErrNoComponents       = errors.New("Circuit has no components")
+	ErrNoSource           = errors.New("Circuit has no battery")
+	ErrTooManyComponents  = fmt.Errorf("Circuit has more than %d components", MaxComponents)
+)
+
+const (
+	TypeBattery    = "battery"
+	TypeResistor   = "resistor"
+	TypeBulb       = "bulb"
+	TypeSwitch     = "switch"
+	TypeDiode      = "diode"
+	TypeWire       = "wire"
+	TypeAmmeter    = "ampermeter"
+	TypeVoltmeter  = "voltmeter"
+	typeAmmeterAlt = "ammeter"
+)
+
+var knownTypes = map[string]bool{
+	TypeBattery:   true,
+	TypeResistor:  true,
+	TypeBulb:      true,
+	TypeSwitch:    true,
+	TypeDiode:     true,
+	TypeWire:      true,
+	TypeAmmeter:   true,
+	TypeVoltmeter: true,
+}
+
+// Resistances used for ideal parts, matching the browser simulator.
+const (
+	shortResistance     = 1e-6
+	voltmeterResistance = 1e9
+	// Bulbs and resistors without a resistance get the builder's default.
+	defaultResistance = 100
+	// Diodes are piecewise linear: a forward drop in series with a small
+	// resistance when conducting, open otherwise.
+	diodeForwardVoltage = 0.7
+	diodeOnResistance   = 0.01
+)
+
+// Terminal is one end of a component. Terminals sharing a wireId are
+// connected; a terminal without a wire is left floating.
+type Terminal struct {
+	ID     string  `json:"id"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	WireID *string `json:"wireId"`
+}
+
+type Component struct {
+	ID         string                     `json:"id"`
+	Type       string                     `json:"type"`
+	Name       string                     `json:"name,omitempty"`
+	X          float64                    `json:"x"`
+	Y          float64                    `json:"y"`
+	Rotation   float64                    `json:"rotation"`
+	Start      Terminal                   `json:"start"`
+	End        Terminal                   `json:"end"`
+	Values     map[string]json.RawMessage `json:"values"`
+	Voltage    *float64                   `json:"voltage,omitempty"`
+	Resistance *float64                   `json:"resistance,omitempty"`
+	IsOn       *bool                      `json:"is_on,omitempty"`
+}
+
+type Circuit struct {
+	Version    string      `json:"version"`
+	Timestamp  string      `json:"timestamp,omitempty"`
+	Components []Component `json:"components"`
+}
+
+// Parse decodes a circuit export.
+func Parse(data []byte) (*Circuit, error) {
+	var c Circuit
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("Invalid circuit: %w", err)
+	}
+	if c.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+	if len(c.Components) == 0 {
+		return nil, ErrNoComponents
+	}
+	if len(c.Components) > MaxComponents {
+		return nil, ErrTooManyComponents
+	}
+	ids := map[string]bool{}
+	for i := range c.Components {
+		comp := &c.Components[i]
+		if comp.Type == typeAmmeterAlt {
+			comp.Type = TypeAmmeter
+		}
+		if !knownTypes[comp.Type] {
+			return nil, fmt.Errorf("Unknown component type %q", comp.Type)
+		}
+		if comp.ID == "" {
+			return nil, fmt.Errorf("Component %d has no id", i)
+		}
+		if ids[comp.ID] {
+			return nil, fmt.Errorf("Duplicate component id %q", comp.ID)
+		}
+		ids[comp.ID] = true
+	}
+	return &c, nil
+}
+
+// Decode loads a circuit that has already been decoded into generic JSON
+// values, as it arrives inside a request body.
+func Decode(v interface{}) (*Circuit, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// DisplayName returns the name shown in the builder, falling back to the id.
+func (c Component) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if name, ok := c.String("name"); ok && name != "" {
+		return name
+	}
+	return c.ID
+}
+
+// Value reads a numeric value, which the builder exports either as a plain
+// number or as {value, automatic}.
+func (c Component) Value(key string) (float64, bool) {
+	raw, ok := c.Values[key]
+	if !ok {
+		return 0, false
+	}
+
+	var number float64
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number, true
+	}
+
+	var wrapped struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err == nil && wrapped.Value != nil {
+		return *wrapped.Value, true
+	}
+	return 0, false
+}
+
+func (c Component) String(key string) (string, bool) {
+	raw, ok := c.Values[key]
+	if !ok {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// SourceVoltage is the battery's voltage, or its amplitude for AC sources.
+func (c Component) SourceVoltage() float64 {
+	if v, ok := c.Value("maxVoltage"); ok {
+		return v
+	}
+	if v, ok := c.Value("voltage"); ok {
+		return v
+	}
+	if c.Voltage != nil {
+		return *c.Voltage
+	}
+	return 0
+}
+
+// ResistanceOhms follows the rules of the browser simulator: meters, wires and
+// closed switches are near-ideal, an open switch never conducts.
+func (c Component) ResistanceOhms() float64 {
+	switch c.Type {
+	case TypeWire, TypeAmmeter:
+		return shortResistance
+	case TypeVoltmeter:
+		return voltmeterResistance
+	case TypeSwitch:
+		if c.closed() {
+			return shortResistance
+		}
+		return math.Inf(1)
+	}
+
+	if c.Resistance != nil && *c.Resistance > 0 {
+		return *c.Resistance
+	}
+	if r, ok := c.Value("resistance"); ok && r > 0 {
+		return r
+	}
+	return defaultResistance
+}
+
+func (c Component) closed() bool {
+	if c.IsOn != nil {
+		return *c.IsOn
+	}
+	if raw, ok := c.Values["is_on"]; ok {
+		var on bool
+		if err := json.Unmarshal(raw, &on); err == nil {
+			return on
+		}
+	}
+	return false
+}
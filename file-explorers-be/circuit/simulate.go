@@ -0,0 +1,228 @@
+package circuit
+
+import (
+	"errors"
+	"file-explorers-be/models"
+	"math"
+)
+
+var (
+	ErrTooManySamples     = errors.New("Simulation has too many samples, lower the sample rate or duration")
+	ErrSimulationTooLarge = errors.New("Simulation is too large, use fewer components or samples")
+)
+
+const (
+	maxSamples = 10000
+	// maxSimulationWork caps components × samples: every sample solves the
+	// whole circuit and keeps three values per component.
+	maxSimulationWork = 100000
+	// Used when a battery does not set its own timing, matching the
+	// builder's defaults.
+	defaultClockSpeed = 20
+	defaultPeriod     = 1
+	defaultPeriods    = 5
+	defaultMaxCurrent = 1
+)
+
+// IsAC reports whether the battery produces an alternating voltage.
+func (c Component) IsAC() bool {
+	sourceType, _ := c.String("sourceType")
+	return sourceType == "AC"
+}
+
+// Period is the AC period in seconds, from periodTime or frequency.
+func (c Component) Period() float64 {
+	if p, ok := c.Value("periodTime"); ok && p > 0 {
+		return p
+	}
+	if f, ok := c.Value("frequency"); ok && f > 0 {
+		return 1 / f
+	}
+	return defaultPeriod
+}
+
+// SourceVoltageAt follows the battery's waveform in the builder:
+// maxVoltage·sin(2πt/period) for AC sources and a constant for DC.
+func (c Component) SourceVoltageAt(t float64) float64 {
+	if !c.IsAC() {
+		return c.SourceVoltage()
+	}
+	return c.SourceVoltage() * math.Sin(2*math.Pi*t/c.Period())
+}
+
+// HasAC reports whether any battery in the circuit is an AC source.
+func (c *Circuit) HasAC() bool {
+	for _, comp := range c.Components {
+		if comp.Type == TypeBattery && comp.IsAC() {
+			return true
+		}
+	}
+	return false
+}
+
+// timing picks the sample rate and duration from the first AC battery (or the
+// first battery), the way the builder's oscilloscopes sample it. A source that
+// only gives a frequency is sampled 20 times per period.
+func (c *Circuit) timing() (sampleRate, duration float64) {
+	var source *Component
+	for i := range c.Components {
+		comp := &c.Components[i]
+		if comp.Type != TypeBattery {
+			continue
+		}
+		if source == nil || comp.IsAC() && !source.IsAC() {
+			source = comp
+		}
+	}
+	if source == nil {
+		return defaultClockSpeed, defaultPeriods * defaultPeriod
+	}
+
+	sampleRate, ok := source.Value("clockSpeed")
+	if !ok || sampleRate <= 0 {
+		sampleRate = defaultClockSpeed / source.Period()
+	}
+	duration, ok = source.Value("shownTime")
+	if !ok || duration <= 0 {
+		duration = defaultPeriods * source.Period()
+	}
+	return
+}
+
+// Simulate samples the circuit over time. Zero sampleRate or duration fall
+// back to the timing of the circuit's batteries.
+func Simulate(c *Circuit, sampleRate, duration float64) (simulation models.CircuitSimulation, err error) {
+	n, err := newNetwork(c)
+	if err != nil {
+		return
+	}
+
+	defaultRate, defaultDuration := c.timing()
+	if sampleRate <= 0 {
+		sampleRate = defaultRate
+	}
+	if duration <= 0 {
+		duration = defaultDuration
+	}
+	samples := int(math.Round(sampleRate * duration))
+	if samples > maxSamples {
+		return simulation, ErrTooManySamples
+	}
+	if samples < 1 {
+		samples = 1
+	}
+	if samples*len(c.Components) > maxSimulationWork {
+		return simulation, ErrSimulationTooLarge
+	}
+
+	evaluation := n.check()
+	simulation.SampleRate = sampleRate
+	simulation.Duration = duration
+	simulation.Short = evaluation.Short
+	simulation.Open = evaluation.Open
+	simulation.Warnings = evaluation.Warnings
+	simulation.Times = make([]float64, samples)
+
+	count := len(c.Components)
+	voltage := make([][]float64, count)
+	current := make([][]float64, count)
+	power := make([][]float64, count)
+	for i := range c.Components {
+		voltage[i] = make([]float64, samples)
+		current[i] = make([]float64, samples)
+		power[i] = make([]float64, samples)
+	}
+
+	sources := make([]float64, len(n.sources))
+	for s := 0; s < samples; s++ {
+		t := float64(s) / sampleRate
+		simulation.Times[s] = clean(t)
+		for k, i := range n.sources {
+			sources[k] = c.Components[i].SourceVoltageAt(t)
+		}
+
+		var op operatingPoint
+		op, err = n.operatingPoint(evaluation, sources)
+		if err != nil {
+			return
+		}
+		for i, result := range n.results(op) {
+			voltage[i][s] = result.Voltage
+			current[i][s] = result.Current
+			power[i][s] = result.Power
+		}
+	}
+
+	maxVoltage, maxCurrent := c.scale()
+	simulation.Components = make([]models.CircuitTrace, count)
+	for i, comp := range c.Components {
+		trace := models.CircuitTrace{
+			ID:           comp.ID,
+			Name:         comp.DisplayName(),
+			Type:         comp.Type,
+			VoltagePeak:  peak(voltage[i]),
+			VoltageRMS:   rms(voltage[i]),
+			CurrentPeak:  peak(current[i]),
+			CurrentRMS:   rms(current[i]),
+			PowerAverage: mean(power[i]),
+		}
+		trace.Oscilloscopes = []models.OscilloscopeTrace{
+			oscilloscope(trace.Name, "volt", voltage[i], math.Max(maxVoltage, trace.VoltagePeak)),
+			oscilloscope(trace.Name, "amper", current[i], math.Max(maxCurrent, trace.CurrentPeak)),
+			oscilloscope(trace.Name, "watt", power[i], math.Max(maxVoltage*maxCurrent, peak(power[i]))),
+		}
+		simulation.Components[i] = trace
+	}
+	return
+}
+
+// scale returns the first battery's maxVoltage and maxCurrent, which the
+// builder uses for the oscilloscopes' vertical range.
+func (c *Circuit) scale() (maxVoltage, maxCurrent float64) {
+	for _, comp := range c.Components {
+		if comp.Type != TypeBattery {
+			continue
+		}
+		maxVoltage = math.Abs(comp.SourceVoltage())
+		maxCurrent = defaultMaxCurrent
+		if i, ok := comp.Value("maxCurrent"); ok && i > 0 {
+			maxCurrent = i
+		}
+		return
+	}
+	return
+}
+
+func oscilloscope(name, inputType string, measurements []float64, scale float64) models.OscilloscopeTrace {
+	return models.OscilloscopeTrace{
+		Name:            name,
+		InputType:       inputType,
+		MaxMeasurements: len(measurements),
+		MinVoltage:      -scale,
+		MaxVoltage:      scale,
+		Measurements:    measurements,
+	}
+}
+
+func peak(values []float64) (p float64) {
+	for _, v := range values {
+		p = math.Max(p, math.Abs(v))
+	}
+	return
+}
+
+func rms(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v * v
+	}
+	return clean(math.Sqrt(sum / float64(len(values))))
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return clean(sum / float64(len(values)))
+}
@@ -0,0 +1,52 @@
+package circuit
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+// circuit_ac_test.json is a 120 V, 60 Hz source across two 12 Ω resistors in
+// series, so each resistor sees half the voltage at 5 A peak.
+func TestSimulateACExample(t *testing.T) {
+	data, err := os.ReadFile("../../file-explorers-fe/public/circuit_ac_test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulation, err := Simulate(c, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(simulation.Times) != 100 {
+		t.Errorf("got %d samples, want 100", len(simulation.Times))
+	}
+
+	want := map[string]struct{ voltagePeak, currentPeak float64 }{
+		"bat_ac_1": {120, 5},
+		"res_ac_1": {60, 5},
+		"res_ac_2": {60, 5},
+	}
+	for _, trace := range simulation.Components {
+		w, ok := want[trace.ID]
+		if !ok {
+			t.Errorf("unexpected component %s", trace.ID)
+			continue
+		}
+		checkClose(t, trace.ID+" voltage peak", trace.VoltagePeak, w.voltagePeak)
+		checkClose(t, trace.ID+" voltage RMS", trace.VoltageRMS, w.voltagePeak/math.Sqrt2)
+		checkClose(t, trace.ID+" current peak", trace.CurrentPeak, w.currentPeak)
+		checkClose(t, trace.ID+" current RMS", trace.CurrentRMS, w.currentPeak/math.Sqrt2)
+	}
+}
+
+func checkClose(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(math.Abs(got)-want) > 1e-3*want {
+		t.Errorf("%s = %g, want %g", name, got, want)
+	}
+}
@@ -0,0 +1,400 @@
+package circuit
+
+import (
+	"errors"
+	"file-explorers-be/models"
+	"fmt"
+	"math"
+)
+
+var ErrUnsolvable = errors.New("Circuit cannot be solved, check for batteries connected in parallel")
+
+// gmin ties every node to ground through a huge resistance so parts of the
+// circuit that float (e.g. a lone resistor) still give a solvable system.
+const gmin = 1e-12
+
+// network is a circuit reduced to numbered nodes. Ground is the negative
+// terminal of the first battery.
+type network struct {
+	circuit *Circuit
+	nodes   int
+	// wires names each node after its wire; floating terminals get "".
+	wires   []string
+	ground  int
+	ends    [][2]int
+	sources []int
+}
+
+func newNetwork(c *Circuit) (*network, error) {
+	n := &network{circuit: c, ends: make([][2]int, len(c.Components))}
+	wires := map[string]int{}
+	node := func(t Terminal) int {
+		if t.WireID == nil || *t.WireID == "" {
+			n.wires = append(n.wires, "")
+			n.nodes++
+			return n.nodes - 1
+		}
+		id, ok := wires[*t.WireID]
+		if !ok {
+			id = n.nodes
+			wires[*t.WireID] = id
+			n.wires = append(n.wires, *t.WireID)
+			n.nodes++
+		}
+		return id
+	}
+
+	for i, comp := range c.Components {
+		n.ends[i] = [2]int{node(comp.Start), node(comp.End)}
+		if comp.Type == TypeBattery {
+			n.sources = append(n.sources, i)
+		}
+	}
+	if len(n.sources) == 0 {
+		return nil, ErrNoSource
+	}
+	n.ground = n.ends[n.sources[0]][1]
+	return n, nil
+}
+
+// Evaluate solves the circuit's DC operating point. AC batteries are treated
+// as DC sources at their peak voltage; use Simulate for their waveforms.
+func Evaluate(c *Circuit) (evaluation models.CircuitEvaluation, err error) {
+	n, err := newNetwork(c)
+	if err != nil {
+		return
+	}
+
+	voltages := make([]float64, len(n.sources))
+	for k, i := range n.sources {
+		voltages[k] = c.Components[i].SourceVoltage()
+	}
+
+	evaluation = n.check()
+	op, err := n.operatingPoint(evaluation, voltages)
+	if err != nil {
+		return
+	}
+	evaluation.Components = n.results(op)
+	return
+}
+
+// operatingPoint solves the network unless a battery is shorted onto a
+// single wire, which has no solution; that short is reported with an
+// all-zero operating point.
+func (n *network) operatingPoint(evaluation models.CircuitEvaluation, voltages []float64) (op operatingPoint, err error) {
+	if evaluation.Short && n.hardShort() {
+		return operatingPoint{
+			potentials: make([]float64, n.nodes),
+			currents:   make([]float64, len(n.circuit.Components)),
+		}, nil
+	}
+	return n.solve(voltages)
+}
+
+// check looks for shorted and open sources. A source is shorted when its
+// terminals are joined through near-ideal parts only, and open when no
+// conducting path leads from one terminal back to the other.
+func (n *network) check() (evaluation models.CircuitEvaluation) {
+	shorts := newUnion(n.nodes)
+	paths := newUnion(n.nodes)
+	for i, comp := range n.circuit.Components {
+		a, b := n.ends[i][0], n.ends[i][1]
+		switch comp.Type {
+		case TypeBattery:
+			continue
+		case TypeDiode:
+			paths.join(a, b)
+			continue
+		}
+		r := comp.ResistanceOhms()
+		if r <= shortResistance {
+			shorts.join(a, b)
+		}
+		if !math.IsInf(r, 1) && comp.Type != TypeVoltmeter {
+			paths.join(a, b)
+		}
+	}
+
+	for _, i := range n.sources {
+		comp := n.circuit.Components[i]
+		a, b := n.ends[i][0], n.ends[i][1]
+		switch {
+		case shorts.find(a) == shorts.find(b):
+			evaluation.Short = true
+			evaluation.Warnings = append(evaluation.Warnings, fmt.Sprintf("%s is short-circuited", comp.DisplayName()))
+		case !n.connected(paths, i):
+			evaluation.Open = true
+			evaluation.Warnings = append(evaluation.Warnings, fmt.Sprintf("%s is not part of a closed circuit", comp.DisplayName()))
+		}
+	}
+	return
+}
+
+// connected reports whether source i's terminals are joined by a conducting
+// path, which may lead through other batteries.
+func (n *network) connected(paths *union, i int) bool {
+	withSources := paths.clone()
+	for _, j := range n.sources {
+		if j != i {
+			withSources.join(n.ends[j][0], n.ends[j][1])
+		}
+	}
+	return withSources.find(n.ends[i][0]) == withSources.find(n.ends[i][1])
+}
+
+func (n *network) hardShort() bool {
+	for _, i := range n.sources {
+		if n.ends[i][0] == n.ends[i][1] {
+			return true
+		}
+	}
+	return false
+}
+
+// operatingPoint holds the potential of every node and the current through
+// every component, indexed like the circuit's components.
+type operatingPoint struct {
+	potentials []float64
+	currents   []float64
+}
+
+// solve finds the operating point for the given source voltages. Diodes are
+// piecewise linear, so the system is re-solved until every diode's assumed
+// state agrees with the result.
+func (n *network) solve(voltages []float64) (op operatingPoint, err error) {
+	on := map[int]bool{}
+	for i, comp := range n.circuit.Components {
+		if comp.Type == TypeDiode {
+			on[i] = true
+		}
+	}
+
+	for attempt := 0; attempt <= 2*len(on)+1; attempt++ {
+		op, err = n.solveLinear(voltages, on)
+		if err != nil {
+			return
+		}
+
+		changed := false
+		for i, conducting := range on {
+			drop := op.potentials[n.ends[i][0]] - op.potentials[n.ends[i][1]]
+			if conducting && op.currents[i] < 0 || !conducting && drop > diodeForwardVoltage {
+				on[i] = !conducting
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return
+}
+
+// solveLinear stamps the modified nodal analysis system with diodes fixed in
+// the given states and solves it.
+func (n *network) solveLinear(voltages []float64, diodeOn map[int]bool) (op operatingPoint, err error) {
+	// Unknowns: every node except ground, then one current per source.
+	index := make([]int, n.nodes)
+	size := 0
+	for node := range index {
+		if node == n.ground {
+			index[node] = -1
+			continue
+		}
+		index[node] = size
+		size++
+	}
+	nodeCount := size
+	size += len(n.sources)
+
+	matrix := make([][]float64, size)
+	for i := range matrix {
+		matrix[i] = make([]float64, size+1)
+	}
+	for i := 0; i < nodeCount; i++ {
+		matrix[i][i] += gmin
+	}
+
+	conductance := func(i int) float64 {
+		comp := n.circuit.Components[i]
+		if comp.Type == TypeDiode {
+			if diodeOn[i] {
+				return 1 / diodeOnResistance
+			}
+			return 0
+		}
+		return 1 / comp.ResistanceOhms()
+	}
+
+	for i, comp := range n.circuit.Components {
+		if comp.Type == TypeBattery {
+			continue
+		}
+		g := conductance(i)
+		if g == 0 {
+			continue
+		}
+		a, b := index[n.ends[i][0]], index[n.ends[i][1]]
+		if a >= 0 {
+			matrix[a][a] += g
+		}
+		if b >= 0 {
+			matrix[b][b] += g
+		}
+		if a >= 0 && b >= 0 {
+			matrix[a][b] -= g
+			matrix[b][a] -= g
+		}
+
+		// A conducting diode drops its forward voltage, which stamps as a
+		// current source from the cathode back to the anode.
+		if comp.Type == TypeDiode {
+			if a >= 0 {
+				matrix[a][size] += g * diodeForwardVoltage
+			}
+			if b >= 0 {
+				matrix[b][size] -= g * diodeForwardVoltage
+			}
+		}
+	}
+
+	for k, i := range n.sources {
+		row := nodeCount + k
+		a, b := index[n.ends[i][0]], index[n.ends[i][1]]
+		if a >= 0 {
+			matrix[a][row] += 1
+			matrix[row][a] += 1
+		}
+		if b >= 0 {
+			matrix[b][row] -= 1
+			matrix[row][b] -= 1
+		}
+		matrix[row][size] = voltages[k]
+	}
+
+	x, err := gauss(matrix)
+	if err != nil {
+		return
+	}
+
+	op.potentials = make([]float64, n.nodes)
+	for node, i := range index {
+		if i >= 0 {
+			op.potentials[node] = x[i]
+		}
+	}
+
+	op.currents = make([]float64, len(n.circuit.Components))
+	source := 0
+	for i, comp := range n.circuit.Components {
+		drop := op.potentials[n.ends[i][0]] - op.potentials[n.ends[i][1]]
+		switch {
+		case comp.Type == TypeBattery:
+			// The MNA current flows into the positive terminal.
+			op.currents[i] = -x[nodeCount+source]
+			source++
+		case comp.Type == TypeDiode && diodeOn[i]:
+			op.currents[i] = (drop - diodeForwardVoltage) / diodeOnResistance
+		default:
+			op.currents[i] = drop * conductance(i)
+		}
+	}
+	return
+}
+
+func (n *network) results(op operatingPoint) []models.CircuitComponentResult {
+	results := make([]models.CircuitComponentResult, len(n.circuit.Components))
+	for i, comp := range n.circuit.Components {
+		result := models.CircuitComponentResult{
+			ID:      comp.ID,
+			Name:    comp.DisplayName(),
+			Type:    comp.Type,
+			Voltage: clean(op.potentials[n.ends[i][0]] - op.potentials[n.ends[i][1]]),
+			Current: clean(op.currents[i]),
+		}
+		if comp.Type != TypeBattery && comp.Type != TypeDiode {
+			if r := comp.ResistanceOhms(); !math.IsInf(r, 1) {
+				result.Resistance = &r
+			}
+		}
+		result.Power = clean(result.Voltage * result.Current)
+		results[i] = result
+	}
+	return results
+}
+
+// gauss solves an augmented matrix in place using partial pivoting.
+func gauss(m [][]float64) ([]float64, error) {
+	size := len(m)
+	for col := 0; col < size; col++ {
+		pivot := col
+		for row := col + 1; row < size; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-18 {
+			return nil, ErrUnsolvable
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < size; row++ {
+			factor := m[row][col] / m[col][col]
+			if factor == 0 {
+				continue
+			}
+			for k := col; k <= size; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, size)
+	for row := size - 1; row >= 0; row-- {
+		sum := m[row][size]
+		for k := row + 1; k < size; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, nil
+}
+
+// clean rounds away the noise left by gmin and floating point error.
+func clean(v float64) float64 {
+	if math.Abs(v) < 1e-9 {
+		return 0
+	}
+	return math.Round(v*1e9) / 1e9
+}
+
+type union struct {
+	parent []int
+}
+
+func newUnion(size int) *union {
+	u := &union{parent: make([]int, size)}
+	for i := range u.parent {
+		u.parent[i] = i
+	}
+	return u
+}
+
+func (u *union) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+func (u *union) join(a, b int) {
+	u.parent[u.find(a)] = u.find(b)
+}
+
+func (u *union) clone() *union {
+	c := &union{parent: make([]int, len(u.parent))}
+	copy(c.parent, u.parent)
+	return c
+}
@@ -0,0 +1,161 @@
+package circuit
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"math"
+	"testing"
+)
+
+// part builds a component between two wires; an empty wire leaves that end
+// floating.
+func part(id, kind, start, end string, values map[string]interface{}) Component {
+	terminal := func(wire string) Terminal {
+		if wire == "" {
+			return Terminal{ID: id + "_" + wire}
+		}
+		return Terminal{ID: id + "_" + wire, WireID: &wire}
+	}
+	c := Component{ID: id, Type: kind, Start: terminal(start), End: terminal(end), Values: map[string]json.RawMessage{}}
+	for k, v := range values {
+		raw, _ := json.Marshal(v)
+		c.Values[k] = raw
+	}
+	return c
+}
+
+func battery(id, plus, minus string, volts float64) Component {
+	return part(id, TypeBattery, plus, minus, map[string]interface{}{"voltage": volts})
+}
+
+func resistor(id, start, end string, ohms float64) Component {
+	return part(id, TypeResistor, start, end, map[string]interface{}{"resistance": ohms})
+}
+
+func evaluate(t *testing.T, components ...Component) (models.CircuitEvaluation, map[string]models.CircuitComponentResult) {
+	t.Helper()
+	evaluation, err := Evaluate(&Circuit{Version: Version, Components: components})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byId := map[string]models.CircuitComponentResult{}
+	for _, result := range evaluation.Components {
+		byId[result.ID] = result
+	}
+	return evaluation, byId
+}
+
+// A 12 V battery across 100 Ω and 200 Ω in series splits its voltage one
+// third to two thirds.
+func TestEvaluateVoltageDivider(t *testing.T) {
+	evaluation, results := evaluate(t,
+		battery("bat", "a", "g", 12),
+		resistor("r1", "a", "m", 100),
+		resistor("r2", "m", "g", 200),
+	)
+	if evaluation.Short || evaluation.Open {
+		t.Errorf("got short %v, open %v; want neither", evaluation.Short, evaluation.Open)
+	}
+	checkClose(t, "bat current", results["bat"].Current, 0.04)
+	checkClose(t, "r1 voltage", results["r1"].Voltage, 4)
+	checkClose(t, "r2 voltage", results["r2"].Voltage, 8)
+	checkClose(t, "r2 current", results["r2"].Current, 0.04)
+	checkClose(t, "r2 power", results["r2"].Power, 0.32)
+}
+
+// 10 Ω in series with two 20 Ω in parallel is 20 Ω, so the battery drives
+// 0.5 A that splits evenly between the parallel pair.
+func TestEvaluateSeriesParallel(t *testing.T) {
+	_, results := evaluate(t,
+		battery("bat", "a", "g", 10),
+		resistor("r1", "a", "m", 10),
+		resistor("r2", "m", "g", 20),
+		resistor("r3", "m", "g", 20),
+	)
+	checkClose(t, "bat current", results["bat"].Current, 0.5)
+	checkClose(t, "r1 voltage", results["r1"].Voltage, 5)
+	for _, id := range []string{"r2", "r3"} {
+		checkClose(t, id+" voltage", results[id].Voltage, 5)
+		checkClose(t, id+" current", results[id].Current, 0.25)
+	}
+}
+
+func TestEvaluateOpenSwitch(t *testing.T) {
+	evaluation, results := evaluate(t,
+		battery("bat", "a", "g", 9),
+		part("sw", TypeSwitch, "a", "m", map[string]interface{}{"is_on": false}),
+		resistor("r1", "m", "g", 100),
+	)
+	if !evaluation.Open || len(evaluation.Warnings) != 1 {
+		t.Errorf("got open %v, warnings %q; want one open warning", evaluation.Open, evaluation.Warnings)
+	}
+	if i := results["r1"].Current; math.Abs(i) > 1e-6 {
+		t.Errorf("r1 current = %g, want 0", i)
+	}
+}
+
+func TestEvaluateClosedSwitch(t *testing.T) {
+	evaluation, results := evaluate(t,
+		battery("bat", "a", "g", 9),
+		part("sw", TypeSwitch, "a", "m", map[string]interface{}{"is_on": true}),
+		resistor("r1", "m", "g", 100),
+	)
+	if evaluation.Open {
+		t.Errorf("closed switch reported open: %q", evaluation.Warnings)
+	}
+	checkClose(t, "r1 current", results["r1"].Current, 0.09)
+}
+
+func TestEvaluateShort(t *testing.T) {
+	evaluation, _ := evaluate(t,
+		battery("bat", "a", "g", 9),
+		part("w", TypeWire, "a", "g", nil),
+		resistor("r1", "a", "g", 100),
+	)
+	if !evaluation.Short || len(evaluation.Warnings) != 1 {
+		t.Errorf("got short %v, warnings %q; want one short warning", evaluation.Short, evaluation.Warnings)
+	}
+
+	// Both terminals on one wire has no solution; it is reported as a short
+	// with nothing flowing.
+	evaluation, results := evaluate(t, battery("bat", "a", "a", 9))
+	if !evaluation.Short {
+		t.Error("battery across one wire not reported as a short")
+	}
+	if i := results["bat"].Current; i != 0 {
+		t.Errorf("bat current = %g, want 0", i)
+	}
+}
+
+// A resistor with a floating end carries no current but does not stop the
+// rest of the circuit from solving.
+func TestEvaluateFloatingNode(t *testing.T) {
+	_, results := evaluate(t,
+		battery("bat", "a", "g", 6),
+		resistor("r1", "a", "g", 60),
+		resistor("r2", "a", "", 100),
+	)
+	checkClose(t, "r1 current", results["r1"].Current, 0.1)
+	if i := results["r2"].Current; math.Abs(i) > 1e-6 {
+		t.Errorf("r2 current = %g, want 0", i)
+	}
+}
+
+func TestEvaluateParallelBatteries(t *testing.T) {
+	c := &Circuit{Version: Version, Components: []Component{
+		battery("b1", "a", "g", 9),
+		battery("b2", "a", "g", 12),
+		resistor("r1", "a", "g", 100),
+	}}
+	if _, err := Evaluate(c); !errors.Is(err, ErrUnsolvable) {
+		t.Errorf("got %v, want %v", err, ErrUnsolvable)
+	}
+}
+
+func TestEvaluateNoSource(t *testing.T) {
+	c := &Circuit{Version: Version, Components: []Component{resistor("r1", "a", "g", 100)}}
+	if _, err := Evaluate(c); !errors.Is(err, ErrNoSource) {
+		t.Errorf("got %v, want %v", err, ErrNoSource)
+	}
+}
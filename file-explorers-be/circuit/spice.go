@@ -0,0 +1,338 @@
+package circuit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SPICE decks carry the builder's component type in a comment line before
+// each element, e.g. "* bulb L1", so bulbs, switches and meters survive a
+// round trip. Decks written by other tools are read by element letter.
+const (
+	spiceGround          = "0"
+	spiceOpenResistance  = 1e12
+	spiceDiodeModel      = "DMOD"
+	spiceDefaultVoltage  = 9
+	spiceDefaultClock    = 20
+	spiceDefaultShowTime = 5
+)
+
+var spiceNamePattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ToSPICE writes the circuit as a SPICE deck that ngspice can run. Ground is
+// the negative terminal of the first battery; ammeters become zero volt
+// sources so the simulator reports their current.
+func ToSPICE(c *Circuit, title string) (string, error) {
+	n, err := newNetwork(c)
+	if err != nil {
+		return "", err
+	}
+
+	nodes := make([]string, n.nodes)
+	for i, wire := range n.wires {
+		switch {
+		case i == n.ground:
+			nodes[i] = spiceGround
+		case wire == "":
+			nodes[i] = fmt.Sprintf("nc_%d", i)
+		default:
+			nodes[i] = spiceName(wire)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "* %s\n", strings.ReplaceAll(title, "\n", " "))
+
+	used := map[string]bool{}
+	diodes := false
+	for i, comp := range c.Components {
+		a, k := nodes[n.ends[i][0]], nodes[n.ends[i][1]]
+		fmt.Fprintf(&b, "* %s %s\n", comp.Type, comp.DisplayName())
+
+		switch comp.Type {
+		case TypeBattery:
+			name := elementName("V", comp.DisplayName(), used)
+			if comp.IsAC() {
+				fmt.Fprintf(&b, "%s %s %s SIN(0 %g %g)\n", name, a, k, comp.SourceVoltage(), 1/comp.Period())
+			} else {
+				fmt.Fprintf(&b, "%s %s %s DC %g\n", name, a, k, comp.SourceVoltage())
+			}
+		case TypeAmmeter:
+			fmt.Fprintf(&b, "%s %s %s DC 0\n", elementName("V", comp.DisplayName(), used), a, k)
+		case TypeDiode:
+			fmt.Fprintf(&b, "%s %s %s %s\n", elementName("D", comp.DisplayName(), used), a, k, spiceDiodeModel)
+			diodes = true
+		default:
+			r := comp.ResistanceOhms()
+			if math.IsInf(r, 1) {
+				r = spiceOpenResistance
+			}
+			fmt.Fprintf(&b, "%s %s %s %g\n", elementName("R", comp.DisplayName(), used), a, k, r)
+		}
+	}
+
+	if diodes {
+		fmt.Fprintf(&b, ".model %s D\n", spiceDiodeModel)
+	}
+	if c.HasAC() {
+		rate, duration := c.timing()
+		fmt.Fprintf(&b, ".tran %g %g\n", 1/rate, duration)
+	} else {
+		b.WriteString(".op\n")
+	}
+	b.WriteString(".end\n")
+	return b.String(), nil
+}
+
+// elementName prefixes a component name with its SPICE element letter unless
+// it already starts with it, keeping names unique within the deck.
+func elementName(letter, name string, used map[string]bool) string {
+	name = spiceName(name)
+	if !strings.HasPrefix(strings.ToUpper(name), letter) {
+		name = letter + name
+	}
+
+	unique := name
+	for i := 2; used[strings.ToUpper(unique)]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[strings.ToUpper(unique)] = true
+	return unique
+}
+
+func spiceName(name string) string {
+	return spiceNamePattern.ReplaceAllString(name, "_")
+}
+
+// FromSPICE reads a simple SPICE deck of resistors, voltage sources and
+// diodes into a circuit laid out on the workspace grid. The title line is
+// returned as the circuit's name.
+func FromSPICE(deck string) (c *Circuit, title string, err error) {
+	lines := spiceLines(deck)
+	if len(lines) == 0 {
+		return nil, "", ErrNoComponents
+	}
+	title = strings.TrimSpace(strings.TrimPrefix(lines[0].text, "*"))
+
+	c = &Circuit{Version: Version, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+	var hintType, hintName string
+deck:
+	for _, line := range lines[1:] {
+		text := line.text
+		switch {
+		case strings.HasPrefix(text, "*"):
+			fields := strings.Fields(strings.TrimPrefix(text, "*"))
+			if len(fields) > 0 && knownTypes[fields[0]] {
+				hintType = fields[0]
+				hintName = strings.Join(fields[1:], " ")
+			}
+			continue
+		case strings.HasPrefix(text, "."):
+			if strings.EqualFold(strings.Fields(text)[0], ".end") {
+				break deck
+			}
+			continue
+		}
+
+		comp, err := spiceElement(text, hintType)
+		if err != nil {
+			return nil, "", fmt.Errorf("Line %d: %w", line.number, err)
+		}
+		if hintName != "" {
+			setValue(&comp, "name", hintName)
+		}
+		c.Components = append(c.Components, comp)
+		hintType, hintName = "", ""
+	}
+
+	if len(c.Components) == 0 {
+		return nil, "", ErrNoComponents
+	}
+	layout(c)
+	return c, title, nil
+}
+
+type spiceLine struct {
+	number int
+	text   string
+}
+
+// spiceLines trims the deck, drops inline comments and joins "+"
+// continuation lines onto the line they continue.
+func spiceLines(deck string) (lines []spiceLine) {
+	for i, text := range strings.Split(deck, "\n") {
+		text = strings.TrimSpace(text)
+		if i > 0 && !strings.HasPrefix(text, "*") {
+			if j := strings.IndexAny(text, ";$"); j >= 0 {
+				text = strings.TrimSpace(text[:j])
+			}
+		}
+		if text == "" && i > 0 {
+			continue
+		}
+		if strings.HasPrefix(text, "+") && len(lines) > 0 {
+			lines[len(lines)-1].text += " " + strings.TrimSpace(text[1:])
+			continue
+		}
+		lines = append(lines, spiceLine{number: i + 1, text: text})
+	}
+	return
+}
+
+func spiceElement(text, hint string) (comp Component, err error) {
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ", ",", " ").Replace(text))
+	if len(fields) < 4 {
+		return comp, fmt.Errorf("Incomplete element %q", text)
+	}
+	name := fields[0]
+	comp.Start.WireID = spiceWire(fields[1])
+	comp.End.WireID = spiceWire(fields[2])
+	args := fields[3:]
+	setValue(&comp, "name", name)
+
+	switch strings.ToUpper(name[:1]) {
+	case "R":
+		r, err := parseSpiceNumber(args[0])
+		if err != nil {
+			return comp, err
+		}
+		comp.Type = TypeResistor
+		switch hint {
+		case TypeBulb, TypeVoltmeter, TypeWire, TypeAmmeter:
+			comp.Type = hint
+		case TypeSwitch:
+			comp.Type = TypeSwitch
+			on := r <= 1
+			comp.IsOn = &on
+		}
+		if comp.Type == TypeResistor || comp.Type == TypeBulb {
+			comp.Resistance = &r
+			setValue(&comp, "resistance", map[string]interface{}{"value": r, "automatic": false})
+		}
+	case "V":
+		err = spiceSource(&comp, args, hint)
+	case "D":
+		comp.Type = TypeDiode
+	default:
+		return comp, fmt.Errorf("Unsupported element %s", name)
+	}
+	return comp, err
+}
+
+// spiceSource reads "DC v", a bare value or "SIN(vo va freq)". A zero volt
+// DC source is how SPICE measures current, so it becomes an ammeter.
+func spiceSource(comp *Component, args []string, hint string) error {
+	voltage, ac, frequency := 0.0, false, 0.0
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "DC":
+			continue
+		case "AC":
+			// Small-signal magnitude, not part of the operating point.
+			i++
+			continue
+		case "SIN":
+			if i+3 >= len(args) {
+				return fmt.Errorf("SIN needs an offset, amplitude and frequency")
+			}
+			amplitude, err := parseSpiceNumber(args[i+2])
+			if err != nil {
+				return err
+			}
+			frequency, err = parseSpiceNumber(args[i+3])
+			if err != nil {
+				return err
+			}
+			voltage, ac = amplitude, true
+			i = len(args)
+		default:
+			v, err := parseSpiceNumber(args[i])
+			if err != nil {
+				return err
+			}
+			voltage = v
+		}
+	}
+
+	if hint == TypeAmmeter || hint != TypeBattery && !ac && voltage == 0 {
+		comp.Type = TypeAmmeter
+		return nil
+	}
+
+	comp.Type = TypeBattery
+	comp.Voltage = &voltage
+	sourceType, period := "DC", 1.0
+	clock := float64(spiceDefaultClock)
+	shown := float64(spiceDefaultShowTime)
+	if ac {
+		sourceType = "AC"
+		if frequency > 0 {
+			period = 1 / frequency
+		}
+		clock = spiceDefaultClock / period
+		shown = defaultPeriods * period
+	}
+	setValue(comp, "sourceType", sourceType)
+	setValue(comp, "maxVoltage", voltage)
+	setValue(comp, "voltage", voltage)
+	setValue(comp, "maxCurrent", defaultMaxCurrent)
+	setValue(comp, "clockSpeed", clock)
+	setValue(comp, "periodTime", period)
+	setValue(comp, "shownTime", shown)
+	return nil
+}
+
+func spiceWire(node string) *string {
+	if strings.EqualFold(node, "gnd") {
+		node = spiceGround
+	}
+	wire := spiceName(node)
+	if !strings.HasPrefix(wire, "wire_") {
+		wire = "wire_" + wire
+	}
+	return &wire
+}
+
+var spiceNumberPattern = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+)(?:e[+-]?\d+)?)([a-z]*)$`)
+
+// parseSpiceNumber reads a value with an optional SPICE scale suffix, e.g.
+// 4.7k, 10meg or 100n. Units after the suffix (10kOhm) are ignored.
+func parseSpiceNumber(s string) (float64, error) {
+	match := spiceNumberPattern.FindStringSubmatch(strings.ToLower(s))
+	if match == nil {
+		return 0, fmt.Errorf("Invalid value %q", s)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value %q", s)
+	}
+
+	suffix := match[2]
+	scale := 1.0
+	switch {
+	case strings.HasPrefix(suffix, "meg"):
+		scale = 1e6
+	case strings.HasPrefix(suffix, "mil"):
+		scale = 25.4e-6
+	case suffix == "":
+	default:
+		scale = map[byte]float64{'t': 1e12, 'g': 1e9, 'k': 1e3, 'm': 1e-3, 'u': 1e-6, 'n': 1e-9, 'p': 1e-12, 'f': 1e-15}[suffix[0]]
+		if scale == 0 {
+			scale = 1
+		}
+	}
+	return value * scale, nil
+}
+
+func setValue(comp *Component, key string, value interface{}) {
+	if comp.Values == nil {
+		comp.Values = map[string]json.RawMessage{}
+	}
+	raw, _ := json.Marshal(value)
+	comp.Values[key] = raw
+}
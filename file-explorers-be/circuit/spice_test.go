@@ -0,0 +1,184 @@
+package circuit
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Exporting a circuit and importing the deck again keeps every component's
+// type and name, so the imported circuit solves the same way.
+func TestSPICERoundTrip(t *testing.T) {
+	c := &Circuit{Version: Version, Components: []Component{
+		battery("bat", "a", "g", 12),
+		part("sw", TypeSwitch, "a", "b", map[string]interface{}{"is_on": true, "name": "S1"}),
+		part("amp", TypeAmmeter, "b", "c", nil),
+		resistor("r1", "c", "m", 100),
+		part("lamp", TypeBulb, "m", "g", map[string]interface{}{"resistance": 200}),
+		part("vm", TypeVoltmeter, "m", "g", nil),
+		part("d", TypeDiode, "m", "", nil),
+	}}
+	deck, err := ToSPICE(c, "Divider\nwith a lamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"* Divider with a lamp", "Vbat a 0 DC 12", "Vamp b c DC 0", "RS1 a b 1e-06", ".model DMOD D", ".op"} {
+		if !strings.Contains(deck, line+"\n") {
+			t.Errorf("deck is missing %q:\n%s", line, deck)
+		}
+	}
+
+	imported, title, err := FromSPICE(deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Divider with a lamp" {
+		t.Errorf("title = %q, want %q", title, "Divider with a lamp")
+	}
+	if len(imported.Components) != len(c.Components) {
+		t.Fatalf("got %d components, want %d", len(imported.Components), len(c.Components))
+	}
+	for i, comp := range imported.Components {
+		want := c.Components[i]
+		if comp.Type != want.Type || comp.DisplayName() != want.DisplayName() {
+			t.Errorf("component %d = %s %s, want %s %s", i, comp.Type, comp.DisplayName(), want.Type, want.DisplayName())
+		}
+	}
+
+	before, err := Evaluate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Evaluate(imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range before.Components {
+		got := after.Components[i]
+		if !near(got.Voltage, want.Voltage) || !near(got.Current, want.Current) {
+			t.Errorf("%s: got %g V %g A, want %g V %g A", want.Name, got.Voltage, got.Current, want.Voltage, want.Current)
+		}
+	}
+}
+
+// Decks from other tools have no type hints: elements are read by letter,
+// values may carry scale suffixes and lines may continue with "+".
+func TestFromSPICEForeignDeck(t *testing.T) {
+	deck := `Foreign deck
+V1 in 0 DC 5 ; supply
+VSENSE in mid 0
+R1 mid out 4.7k
+R2 out GND
++ 10kOhm
+VAC out 0 SIN(0 170 60)
+D1 out 0 DMOD
+.model DMOD D
+.end
+R3 out 0 1k
+`
+	c, title, err := FromSPICE(deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Foreign deck" {
+		t.Errorf("title = %q, want %q", title, "Foreign deck")
+	}
+
+	want := []struct {
+		kind, name string
+		value      float64
+	}{
+		{TypeBattery, "V1", 5},
+		{TypeAmmeter, "VSENSE", 0},
+		{TypeResistor, "R1", 4700},
+		{TypeResistor, "R2", 10000},
+		{TypeBattery, "VAC", 170},
+		{TypeDiode, "D1", 0},
+	}
+	if len(c.Components) != len(want) {
+		t.Fatalf("got %d components, want %d", len(c.Components), len(want))
+	}
+	for i, w := range want {
+		comp := c.Components[i]
+		if comp.Type != w.kind || comp.DisplayName() != w.name {
+			t.Errorf("component %d = %s %s, want %s %s", i, comp.Type, comp.DisplayName(), w.kind, w.name)
+			continue
+		}
+		switch comp.Type {
+		case TypeBattery:
+			checkClose(t, w.name+" voltage", comp.SourceVoltage(), w.value)
+		case TypeResistor:
+			checkClose(t, w.name+" resistance", comp.ResistanceOhms(), w.value)
+		}
+	}
+	if c.Components[0].IsAC() || !c.Components[4].IsAC() {
+		t.Error("V1 should be DC and VAC should be AC")
+	}
+	checkClose(t, "VAC period", c.Components[4].Period(), 1.0/60)
+	if r2 := c.Components[3]; *r2.End.WireID != *c.Components[0].End.WireID {
+		t.Errorf("R2 ends on %s, want the ground wire %s", *r2.End.WireID, *c.Components[0].End.WireID)
+	}
+}
+
+func TestFromSPICEErrors(t *testing.T) {
+	tests := []struct {
+		deck string
+		want string
+	}{
+		{"", ErrNoComponents.Error()},
+		{"Title only\n.end\n", ErrNoComponents.Error()},
+		{"Title\nR1 a b\n", "Line 2: Incomplete element"},
+		{"Title\n\nX1 a b sub\n", "Line 3: Unsupported element X1"},
+		{"Title\nR1 a b ten\n", `Line 2: Invalid value "ten"`},
+		{"Title\nV1 a 0 SIN(0 5)\n", "Line 2: SIN needs"},
+	}
+	for _, test := range tests {
+		_, _, err := FromSPICE(test.deck)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("FromSPICE(%q) = %v, want %q", test.deck, err, test.want)
+		}
+	}
+
+	if _, _, err := FromSPICE("\n"); !errors.Is(err, ErrNoComponents) {
+		t.Errorf("got %v, want %v", err, ErrNoComponents)
+	}
+}
+
+func TestParseSpiceNumber(t *testing.T) {
+	tests := map[string]float64{
+		"100":    100,
+		"4.7k":   4700,
+		"4.7K":   4700,
+		"10meg":  10e6,
+		"10Meg":  10e6,
+		"1m":     1e-3,
+		"100n":   100e-9,
+		"2.2u":   2.2e-6,
+		"1e3":    1000,
+		"-.5":    -0.5,
+		"10kOhm": 10000,
+		"5V":     5,
+		"1mil":   25.4e-6,
+	}
+	for in, want := range tests {
+		got, err := parseSpiceNumber(in)
+		if err != nil {
+			t.Errorf("parseSpiceNumber(%q): %v", in, err)
+			continue
+		}
+		if !near(got, want) {
+			t.Errorf("parseSpiceNumber(%q) = %g, want %g", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "k", "1.2.3", "ten"} {
+		if _, err := parseSpiceNumber(in); err == nil {
+			t.Errorf("parseSpiceNumber(%q) should fail", in)
+		}
+	}
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-9+1e-6*math.Abs(want)
+}
@@ -0,0 +1,33 @@
+// Command mock-oidc runs a local OpenID Connect provider that signs anyone
+// in, for trying school account login without a real Google or Microsoft
+// tenant. Point a provider at it with
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9000
+//	OIDC_MOCK_CLIENT_ID=file-explorers
+package main
+
+import (
+	"file-explorers-be/oidc"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, as the backend reaches it")
+	clientID := flag.String("client-id", "file-explorers", "accepted client id")
+	email := flag.String("email", "student@school.example", "user signed in when there is no login_hint")
+	flag.Parse()
+
+	provider, err := oidc.NewMockProvider(*issuer, *clientID, *email)
+	if err != nil {
+		log.Fatal("Failed to create mock provider:", err)
+	}
+
+	log.Println("Mock OIDC provider on", *addr, "issuer", *issuer)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		log.Fatal("Mock provider failed:", err)
+	}
+}
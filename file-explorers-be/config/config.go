@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -10,10 +13,96 @@ type Config struct {
 	DBUser     string
 	DBPassword string
 	DBName     string
-	JwtSecret  string
 	JwtIssuer  string
+
+	// JwtSigningKey is a PEM file with the RSA or Ed25519 private key access
+	// tokens are signed with. JwtVerificationKeys are further key files
+	// whose tokens are still accepted, for rotating keys; they are published
+	// at /.well-known/jwks.json together with the signing key. Without a
+	// signing key a temporary one is generated on every start.
+	JwtSigningKey       string
+	JwtVerificationKeys []string
+
+	// AccessTokenTTL is how long a signed access token is accepted.
+	// RefreshTokenTTL is how long a refresh token stays usable; every
+	// refresh rotates it and starts the window again.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// The admin account is created on startup when a username is set.
+	AdminUsername string
+	AdminEmail    string
+	AdminPassword string
+
+	// PublicURL is where the API is reachable for links in emails; AppURL
+	// is the frontend, for links that open a page such as password reset.
+	PublicURL string
+	AppURL    string
+
+	// MailDriver is "smtp" or "outbox"; the outbox writes messages to
+	// MailOutboxDir instead of sending them.
+	MailDriver    string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+
+	// UnverifiedPolicy decides what accounts without a verified email may
+	// do: "allow" everything, "limited" to playing, or "block" signing in.
+	// They are deleted after UnverifiedPurgeDays; 0 keeps them.
+	UnverifiedPolicy    string
+	UnverifiedPurgeDays int
+
+	// Guest accounts are deleted after GuestPurgeDays without signing in;
+	// 0 keeps them.
+	GuestPurgeDays int
+
+	// Accounts whose owner asked for deletion are kept for
+	// AccountDeletionDays, so signing in again can still undo it.
+	AccountDeletionDays int
+
+	// IP addresses in the audit log are deleted after
+	// AuditIPRetentionDays; 0 keeps them.
+	AuditIPRetentionDays int
+
+	// Failed logins are counted per username and per address in
+	// LoginThrottleStore: "memory" for a single instance, "mysql" to share
+	// the counters between several. Past LoginFreeAttempts every failure
+	// doubles the wait before the next try; LoginMaxAttempts failures lock
+	// the account, and LoginIPMaxAttempts the address, for LoginLockout.
+	LoginThrottleStore string
+	LoginFreeAttempts  int
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginLockout       time.Duration
+
+	// OIDCProviders are the school account providers users can sign in
+	// with, listed in OIDC_PROVIDERS and configured through
+	// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _SCOPES.
+	OIDCProviders []OIDCProvider
 }
 
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+const (
+	UnverifiedAllow   = "allow"
+	UnverifiedLimited = "limited"
+	UnverifiedBlock   = "block"
+)
+
+const (
+	ThrottleMemory = "memory"
+	ThrottleMySQL  = "mysql"
+)
+
 func NewConfig() Config {
 	return Config{
 		DBHost:     getEnv("DB_HOST", "nejc:password@tcp(172.21.0.10:3306)/file_explorers"),
@@ -21,8 +110,43 @@ func NewConfig() Config {
 		DBPassword: getEnv("DB_PASSWORD", "password"),
 		DBName:     getEnv("DB_NAME", "file_explorers"),
 
-		JwtSecret: getEnv("JWT_SECRET", "your_jwt_secret"),
-		JwtIssuer: getEnv("JWT_ISSUER", "file-explorers"),
+		JwtIssuer:           getEnv("JWT_ISSUER", "file-explorers"),
+		JwtSigningKey:       getEnv("JWT_SIGNING_KEY", ""),
+		JwtVerificationKeys: getList("JWT_VERIFICATION_KEYS"),
+
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 12*time.Hour),
+
+		AdminUsername: getEnv("ADMIN_USERNAME", ""),
+		AdminEmail:    getEnv("ADMIN_EMAIL", ""),
+		AdminPassword: getEnv("ADMIN_PASSWORD", ""),
+
+		PublicURL: getEnv("PUBLIC_URL", "http://localhost:8080"),
+		AppURL:    getEnv("APP_URL", "http://localhost:8081"),
+
+		MailDriver:    getEnv("MAIL_DRIVER", "outbox"),
+		MailFrom:      getEnv("MAIL_FROM", "File Explorers <no-reply@file-explorers.local>"),
+		MailOutboxDir: getEnv("MAIL_OUTBOX_DIR", "outbox"),
+		SMTPHost:      getEnv("SMTP_HOST", ""),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUsername:  getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:  getEnv("SMTP_PASSWORD", ""),
+
+		UnverifiedPolicy:    getEnv("UNVERIFIED_POLICY", UnverifiedLimited),
+		UnverifiedPurgeDays: getInt("UNVERIFIED_PURGE_DAYS", 7),
+
+		GuestPurgeDays:      getInt("GUEST_PURGE_DAYS", 30),
+		AccountDeletionDays: getInt("ACCOUNT_DELETION_DAYS", 14),
+
+		AuditIPRetentionDays: getInt("AUDIT_IP_RETENTION_DAYS", 90),
+
+		LoginThrottleStore: getEnv("LOGIN_THROTTLE_STORE", ThrottleMemory),
+		LoginFreeAttempts:  getInt("LOGIN_FREE_ATTEMPTS", 3),
+		LoginMaxAttempts:   getInt("LOGIN_MAX_ATTEMPTS", 10),
+		LoginIPMaxAttempts: getInt("LOGIN_IP_MAX_ATTEMPTS", 50),
+		LoginLockout:       getDuration("LOGIN_LOCKOUT", 15*time.Minute),
+
+		OIDCProviders: getOIDCProviders(),
 	}
 }
 
@@ -33,12 +157,88 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fmt.Printf("Invalid %s %q, using %s\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fmt.Printf("Invalid %s %q, using %d\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getList splits a comma-separated variable, skipping empty entries.
+func getList(key string) (values []string) {
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+func getOIDCProviders() (providers []OIDCProvider) {
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			fmt.Printf("Skipping OIDC provider %s without %sISSUER or %sCLIENT_ID\n", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return
+}
+
 func (cfg *Config) Print() {
 	fmt.Println("Configuration:")
 	fmt.Println("DB Host: ", cfg.DBHost)
 	fmt.Println("DB User: ", cfg.DBUser)
 	fmt.Println("DB Name: ", cfg.DBName)
-	fmt.Println("JWT Secret: ", cfg.JwtSecret)
 	fmt.Println("JWT Issuer: ", cfg.JwtIssuer)
+	fmt.Println("JWT signing key: ", cfg.JwtSigningKey)
+	fmt.Println("JWT verification keys: ", cfg.JwtVerificationKeys)
+	fmt.Println("Access token TTL: ", cfg.AccessTokenTTL)
+	fmt.Println("Refresh token TTL: ", cfg.RefreshTokenTTL)
+	fmt.Println("Admin user: ", cfg.AdminUsername)
+	fmt.Println("Public URL: ", cfg.PublicURL)
+	fmt.Println("App URL: ", cfg.AppURL)
+	fmt.Println("Mail driver: ", cfg.MailDriver)
+	fmt.Println("Unverified policy: ", cfg.UnverifiedPolicy)
+	fmt.Println("Unverified purge days: ", cfg.UnverifiedPurgeDays)
+	fmt.Println("Guest purge days: ", cfg.GuestPurgeDays)
+	fmt.Println("Account deletion days: ", cfg.AccountDeletionDays)
+	fmt.Println("Audit IP retention days: ", cfg.AuditIPRetentionDays)
+	fmt.Println("Login throttle store: ", cfg.LoginThrottleStore)
+	for _, p := range cfg.OIDCProviders {
+		fmt.Println("OIDC provider: ", p.Name, p.Issuer)
+	}
 	fmt.Println("-----")
 }
@@ -0,0 +1,44 @@
+package jwk
+
+// Set is the signing key plus every key tokens are still accepted from.
+// Rotating works in steps: publish the next key as a verification key so
+// other tools pick it up, make it the signing key, and keep the old one as
+// a verification key until the tokens it signed have expired.
+type Set struct {
+	signing *Key
+	keys    []*Key
+}
+
+func NewSet(signing *Key, verification ...*Key) *Set {
+	s := &Set{signing: signing, keys: []*Key{signing}}
+	for _, key := range verification {
+		if key.ID != signing.ID {
+			s.keys = append(s.keys, key)
+		}
+	}
+	return s
+}
+
+// Signing is the key new tokens are signed with.
+func (s *Set) Signing() *Key {
+	return s.signing
+}
+
+// Lookup finds the key a token names in its kid header.
+func (s *Set) Lookup(kid string) (*Key, bool) {
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Document lists the public keys of the set.
+func (s *Set) Document() Document {
+	doc := Document{Keys: make([]JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		doc.Keys = append(doc.Keys, key.JWK())
+	}
+	return doc
+}
@@ -0,0 +1,213 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Circuit is a netlist wired up for evaluation, with its gates in
+// topological order.
+type Circuit struct {
+	netlist *Netlist
+	// sources[g][i] is the gate driving input i of gate g, or -1 when the
+	// input is unconnected and reads as 0.
+	sources [][]int
+	order   []int
+	inputs  map[string]int
+	outputs map[string]int
+}
+
+// Compile resolves the wires between gates, binds the level's inputs to
+// switches and its outputs to gates, and rejects combinational loops.
+func Compile(n *Netlist, inputs, outputs []string) (*Circuit, error) {
+	c := &Circuit{
+		netlist: n,
+		sources: make([][]int, len(n.Gates)),
+		inputs:  map[string]int{},
+		outputs: map[string]int{},
+	}
+
+	drivers := map[string]int{}
+	for i, gate := range n.Gates {
+		if gate.Type == TypeOutput || gate.Output == nil || gate.Output.WireID == nil {
+			continue
+		}
+		wire := *gate.Output.WireID
+		if other, ok := drivers[wire]; ok {
+			return nil, fmt.Errorf("%w: gates %s and %s drive the same wire", ErrInvalidNetlist, n.Gates[other].DisplayName(), gate.DisplayName())
+		}
+		drivers[wire] = i
+	}
+
+	for i, gate := range n.Gates {
+		c.sources[i] = make([]int, len(gate.Inputs))
+		for j, in := range gate.Inputs {
+			c.sources[i][j] = -1
+			if in.WireID == nil {
+				continue
+			}
+			if driver, ok := drivers[*in.WireID]; ok {
+				c.sources[i][j] = driver
+			}
+		}
+	}
+
+	if err := c.bind(inputs, outputs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNetlist, err)
+	}
+	if err := c.sort(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNetlist, err)
+	}
+	return c, nil
+}
+
+func (c *Circuit) bind(inputs, outputs []string) error {
+	for _, name := range inputs {
+		c.inputs[name] = -1
+	}
+	for i, gate := range c.netlist.Gates {
+		if gate.Type != TypeSwitch {
+			continue
+		}
+		if _, ok := c.inputs[gate.DisplayName()]; !ok {
+			return fmt.Errorf("Switch %s is not one of the inputs %s", gate.DisplayName(), strings.Join(inputs, ", "))
+		}
+		c.inputs[gate.DisplayName()] = i
+	}
+	for _, name := range inputs {
+		if c.inputs[name] < 0 {
+			return fmt.Errorf("No switch for input %s", name)
+		}
+	}
+
+	for _, name := range outputs {
+		found := -1
+		for i, gate := range c.netlist.Gates {
+			if gate.DisplayName() != name {
+				continue
+			}
+			// An output probe wins over a gate that happens to share its name.
+			if found < 0 || gate.Type == TypeOutput {
+				found = i
+			}
+		}
+		if found < 0 {
+			return fmt.Errorf("No gate for output %s", name)
+		}
+		c.outputs[name] = found
+	}
+	return nil
+}
+
+// sort orders the gates so every gate comes after the gates driving it,
+// reporting the gates of the first loop it finds.
+func (c *Circuit) sort() error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(c.netlist.Gates))
+	var stack []int
+
+	var visit func(g int) error
+	visit = func(g int) error {
+		switch state[g] {
+		case done:
+			return nil
+		case visiting:
+			var names []string
+			for i := len(stack) - 1; i >= 0; i-- {
+				names = append([]string{c.netlist.Gates[stack[i]].DisplayName()}, names...)
+				if stack[i] == g {
+					break
+				}
+			}
+			return fmt.Errorf("Combinational loop through %s", strings.Join(names, " -> "))
+		}
+
+		state[g] = visiting
+		stack = append(stack, g)
+		for _, source := range c.sources[g] {
+			if source < 0 {
+				continue
+			}
+			if err := visit(source); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[g] = done
+		c.order = append(c.order, g)
+		return nil
+	}
+
+	for g := range c.netlist.Gates {
+		if err := visit(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate sets the switches to the given input values and returns every
+// output.
+func (c *Circuit) Evaluate(inputs map[string]bool) map[string]bool {
+	values := make([]bool, len(c.netlist.Gates))
+	for name, g := range c.inputs {
+		values[g] = inputs[name]
+	}
+
+	for _, g := range c.order {
+		gate := c.netlist.Gates[g]
+		if gate.Type == TypeSwitch {
+			continue
+		}
+		in := make([]bool, len(c.sources[g]))
+		for i, source := range c.sources[g] {
+			in[i] = source >= 0 && values[source]
+		}
+		values[g] = gate.apply(in)
+	}
+
+	outputs := map[string]bool{}
+	for name, g := range c.outputs {
+		outputs[name] = values[g]
+	}
+	return outputs
+}
+
+// GateCount is the number of logic gates placed, not counting switches and
+// output probes.
+func (c *Circuit) GateCount() (count int) {
+	for _, gate := range c.netlist.Gates {
+		if gate.isLogic() {
+			count++
+		}
+	}
+	return
+}
+
+// Depth is the longest chain of logic gates between a switch and an output.
+func (c *Circuit) Depth() (depth int) {
+	levels := make([]int, len(c.netlist.Gates))
+	for _, g := range c.order {
+		longest := 0
+		for _, source := range c.sources[g] {
+			if source >= 0 && levels[source] > longest {
+				longest = levels[source]
+			}
+		}
+		if c.netlist.Gates[g].isLogic() {
+			longest++
+		}
+		levels[g] = longest
+	}
+
+	for _, g := range c.outputs {
+		if levels[g] > depth {
+			depth = levels[g]
+		}
+	}
+	return
+}
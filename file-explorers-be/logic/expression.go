@@ -0,0 +1,193 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// expression is a compiled boolean expression over the level's inputs.
+type expression func(inputs map[string]bool) bool
+
+// parseExpression compiles an expression such as "A & !(B | C)". Operators,
+// from tightest to loosest binding:
+//
+//	!x ~x not x x'     negation
+//	& * and nand       conjunction
+//	^ xor xnor nxor    exclusive or
+//	| + or nor         disjunction
+//
+// Only the given input names and the constants 0 and 1 may be used.
+func parseExpression(source string, inputs []string) (expression, error) {
+	p := &parser{known: map[string]bool{}}
+	for _, name := range inputs {
+		p.known[name] = true
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p.tokens = tokens
+
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected %q in expression", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func tokenize(source string) (tokens []string, err error) {
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()!~'&*^|+", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, fmt.Errorf("Unexpected %q in expression", string(r))
+		}
+	}
+	return
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	known  map[string]bool
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// accept consumes the next token if it is one of the given operators;
+// keywords match case-insensitively.
+func (p *parser) accept(ops ...string) (string, bool) {
+	next := strings.ToLower(p.peek())
+	for _, op := range ops {
+		if next == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// binary parses one precedence level of left-associative operators.
+func (p *parser) binary(operand func() (expression, error), combine map[string]func(a, b bool) bool) (expression, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]string, 0, len(combine))
+	for op := range combine {
+		ops = append(ops, op)
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l, r, f := left, right, combine[op]
+		left = func(inputs map[string]bool) bool { return f(l(inputs), r(inputs)) }
+	}
+}
+
+func (p *parser) or() (expression, error) {
+	or := func(a, b bool) bool { return a || b }
+	return p.binary(p.xor, map[string]func(a, b bool) bool{
+		"|":   or,
+		"+":   or,
+		"or":  or,
+		"nor": func(a, b bool) bool { return !(a || b) },
+	})
+}
+
+func (p *parser) xor() (expression, error) {
+	xnor := func(a, b bool) bool { return a == b }
+	return p.binary(p.and, map[string]func(a, b bool) bool{
+		"^":    func(a, b bool) bool { return a != b },
+		"xor":  func(a, b bool) bool { return a != b },
+		"xnor": xnor,
+		"nxor": xnor,
+	})
+}
+
+func (p *parser) and() (expression, error) {
+	and := func(a, b bool) bool { return a && b }
+	return p.binary(p.unary, map[string]func(a, b bool) bool{
+		"&":    and,
+		"*":    and,
+		"and":  and,
+		"nand": func(a, b bool) bool { return !(a && b) },
+	})
+}
+
+func (p *parser) unary() (expression, error) {
+	if _, ok := p.accept("!", "~", "not"); ok {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(inputs map[string]bool) bool { return !inner(inputs) }, nil
+	}
+
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("'"); !ok {
+			return expr, nil
+		}
+		inner := expr
+		expr = func(inputs map[string]bool) bool { return !inner(inputs) }
+	}
+}
+
+func (p *parser) primary() (expression, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("Unexpected end of expression")
+	case token == "(":
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("Missing ) in expression")
+		}
+		return inner, nil
+	case token == "0" || token == "1":
+		p.pos++
+		value := token == "1"
+		return func(map[string]bool) bool { return value }, nil
+	case p.known[token]:
+		p.pos++
+		return func(inputs map[string]bool) bool { return inputs[token] }, nil
+	}
+	return nil, fmt.Errorf("Unknown input %q in expression", token)
+}
@@ -0,0 +1,88 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	inputs := []string{"A", "B", "C"}
+	tests := []struct {
+		source string
+		// want lists the expression's value for rows 0 to 7, A most
+		// significant.
+		want string
+	}{
+		{"A", "00001111"},
+		{"!A", "11110000"},
+		{"~A", "11110000"},
+		{"not A", "11110000"},
+		{"A'", "11110000"},
+		{"A''", "00001111"},
+		{"A & B", "00000011"},
+		{"A * B", "00000011"},
+		{"A AND B", "00000011"},
+		{"A nand B", "11111100"},
+		{"A | C", "01011111"},
+		{"A + C", "01011111"},
+		{"A Or C", "01011111"},
+		{"A nor C", "10100000"},
+		{"A ^ B", "00111100"},
+		{"A xor B", "00111100"},
+		{"A xnor B", "11000011"},
+		{"A nxor B", "11000011"},
+		{"0", "00000000"},
+		{"1 & C", "01010101"},
+		// & binds tighter than ^, which binds tighter than |.
+		{"A | B & C", "00011111"},
+		{"A ^ B & C", "00011110"},
+		{"A | B ^ C", "01101111"},
+		{"(A | B) & C", "00010101"},
+		{"!(A | B)", "11000000"},
+		{"(A & B)'", "11111100"},
+		{"!A & B", "00110000"},
+		{"A ^ B ^ C", "01101001"},
+	}
+	for _, test := range tests {
+		expr, err := parseExpression(test.source, inputs)
+		if err != nil {
+			t.Errorf("parseExpression(%q): %v", test.source, err)
+			continue
+		}
+		var got strings.Builder
+		for row := 0; row < 8; row++ {
+			if expr(assignment(inputs, row)) {
+				got.WriteByte('1')
+			} else {
+				got.WriteByte('0')
+			}
+		}
+		if got.String() != test.want {
+			t.Errorf("parseExpression(%q) = %s, want %s", test.source, got.String(), test.want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"", "Unexpected end of expression"},
+		{"A &", "Unexpected end of expression"},
+		{"!", "Unexpected end of expression"},
+		{"(A | B", "Missing ) in expression"},
+		{"A B", `Unexpected "B" in expression`},
+		{"A )", `Unexpected ")" in expression`},
+		{"A # B", `Unexpected "#" in expression`},
+		{"A & D", `Unknown input "D" in expression`},
+		{"a & B", `Unknown input "a" in expression`},
+		{"& A", `Unknown input "&" in expression`},
+	}
+	for _, test := range tests {
+		_, err := parseExpression(test.source, []string{"A", "B", "C"})
+		if err == nil || err.Error() != test.want {
+			t.Errorf("parseExpression(%q) = %v, want %q", test.source, err, test.want)
+		}
+	}
+}
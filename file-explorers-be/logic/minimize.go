@@ -0,0 +1,249 @@
+package logic
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// implicant is a product term over n inputs. Bits set in mask are "don't
+// care"; the remaining bits of value give each literal's polarity. Bit
+// n-1-i belongs to input i, matching the truth table row order.
+type implicant struct {
+	value, mask int
+}
+
+func (p implicant) covers(row int) bool {
+	return row&^p.mask == p.value
+}
+
+func (p implicant) literals(n int) int {
+	return n - bits.OnesCount(uint(p.mask))
+}
+
+// The exact cover search tries every combination of the primes left after
+// the essential ones, and tracks the rows they cover in a 64-bit mask. Past
+// these sizes the cover is completed greedily.
+const (
+	maxExactPrimes = 16
+	maxExactRows   = 64
+)
+
+// minimize returns a small sum of products for the rows where column is
+// true, using Quine–McCluskey to find the prime implicants. Essential primes
+// are taken first. When few primes remain, every combination of them is
+// tried and the cover is minimal (exact is true); otherwise the remaining
+// rows are covered greedily and the result is only near-minimal.
+func minimize(column []bool, n int) (cover []implicant, exact bool) {
+	var minterms []int
+	for row, on := range column {
+		if on {
+			minterms = append(minterms, row)
+		}
+	}
+	if len(minterms) == 0 {
+		return nil, true
+	}
+	if len(minterms) == len(column) {
+		return []implicant{{value: 0, mask: len(column) - 1}}, true
+	}
+
+	primes := primeImplicants(minterms)
+
+	covered := map[int]bool{}
+	take := func(p implicant) {
+		cover = append(cover, p)
+		for _, m := range minterms {
+			if p.covers(m) {
+				covered[m] = true
+			}
+		}
+	}
+
+	for _, m := range minterms {
+		var only []implicant
+		for _, p := range primes {
+			if p.covers(m) {
+				only = append(only, p)
+			}
+		}
+		if len(only) == 1 && !contains(cover, only[0]) {
+			take(only[0])
+		}
+	}
+
+	var rest []int
+	for _, m := range minterms {
+		if !covered[m] {
+			rest = append(rest, m)
+		}
+	}
+	var candidates []implicant
+	for _, p := range primes {
+		for _, m := range rest {
+			if p.covers(m) {
+				candidates = append(candidates, p)
+				break
+			}
+		}
+	}
+
+	exact = len(candidates) <= maxExactPrimes && len(rest) <= maxExactRows
+	if exact {
+		for _, p := range exactCover(candidates, rest, n) {
+			take(p)
+		}
+	}
+	for len(covered) < len(minterms) {
+		best, bestCount := implicant{}, 0
+		for _, p := range candidates {
+			count := 0
+			for _, m := range minterms {
+				if !covered[m] && p.covers(m) {
+					count++
+				}
+			}
+			if count > bestCount || count == bestCount && count > 0 && p.literals(n) < best.literals(n) {
+				best, bestCount = p, count
+			}
+		}
+		take(best)
+	}
+
+	sort.Slice(cover, func(i, j int) bool {
+		if cover[i].mask != cover[j].mask {
+			return cover[i].mask > cover[j].mask
+		}
+		return cover[i].value > cover[j].value
+	})
+	return cover, exact
+}
+
+// exactCover finds the fewest candidates covering every row, and among those
+// the one with the fewest literals, by trying all subsets of the candidates.
+func exactCover(candidates []implicant, rows []int, n int) (best []implicant) {
+	if len(rows) == 0 {
+		return nil
+	}
+	masks := make([]uint64, len(candidates))
+	for i, p := range candidates {
+		for r, m := range rows {
+			if p.covers(m) {
+				masks[i] |= 1 << r
+			}
+		}
+	}
+	all := ^uint64(0) >> (64 - len(rows))
+
+	bestSize, bestLiterals, bestSet := len(candidates)+1, 0, 0
+	for set := 1; set < 1<<len(candidates); set++ {
+		size := bits.OnesCount(uint(set))
+		if size > bestSize {
+			continue
+		}
+		var union uint64
+		literals := 0
+		for i := range candidates {
+			if set&(1<<i) != 0 {
+				union |= masks[i]
+				literals += candidates[i].literals(n)
+			}
+		}
+		if union != all {
+			continue
+		}
+		if size < bestSize || literals < bestLiterals {
+			bestSize, bestLiterals, bestSet = size, literals, set
+		}
+	}
+
+	for i, p := range candidates {
+		if bestSet&(1<<i) != 0 {
+			best = append(best, p)
+		}
+	}
+	return
+}
+
+// primeImplicants repeatedly merges implicants that differ in one bit until
+// no more merges are possible; the terms never merged are the primes.
+func primeImplicants(minterms []int) (primes []implicant) {
+	current := map[implicant]bool{}
+	for _, m := range minterms {
+		current[implicant{value: m}] = true
+	}
+
+	for len(current) > 0 {
+		next := map[implicant]bool{}
+		merged := map[implicant]bool{}
+		terms := make([]implicant, 0, len(current))
+		for p := range current {
+			terms = append(terms, p)
+		}
+
+		for i, a := range terms {
+			for _, b := range terms[i+1:] {
+				diff := a.value ^ b.value
+				if a.mask != b.mask || bits.OnesCount(uint(diff)) != 1 {
+					continue
+				}
+				next[implicant{value: a.value &^ diff, mask: a.mask | diff}] = true
+				merged[a], merged[b] = true, true
+			}
+		}
+
+		for _, p := range terms {
+			if !merged[p] {
+				primes = append(primes, p)
+			}
+		}
+		current = next
+	}
+
+	sort.Slice(primes, func(i, j int) bool {
+		if primes[i].mask != primes[j].mask {
+			return primes[i].mask > primes[j].mask
+		}
+		return primes[i].value < primes[j].value
+	})
+	return
+}
+
+func contains(list []implicant, p implicant) bool {
+	for _, q := range list {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSOP writes a cover as an expression the level parser accepts, e.g.
+// "A & !B | C".
+func formatSOP(cover []implicant, inputs []string) string {
+	n := len(inputs)
+	if len(cover) == 0 {
+		return "0"
+	}
+
+	terms := make([]string, 0, len(cover))
+	for _, p := range cover {
+		var literals []string
+		for i, name := range inputs {
+			bit := 1 << (n - 1 - i)
+			if p.mask&bit != 0 {
+				continue
+			}
+			if p.value&bit != 0 {
+				literals = append(literals, name)
+			} else {
+				literals = append(literals, "!"+name)
+			}
+		}
+		if len(literals) == 0 {
+			return "1"
+		}
+		terms = append(terms, strings.Join(literals, " & "))
+	}
+	return strings.Join(terms, " | ")
+}
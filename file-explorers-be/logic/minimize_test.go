@@ -0,0 +1,187 @@
+package logic
+
+import (
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// checkCover fails unless the cover is true on exactly the rows of column
+// and every term is a prime implicant.
+func checkCover(t *testing.T, column []bool, n int, cover []implicant) {
+	t.Helper()
+	for row, want := range column {
+		got := false
+		for _, p := range cover {
+			got = got || p.covers(row)
+		}
+		if got != want {
+			t.Fatalf("cover %v of %v is %v on row %d, want %v", cover, column, got, row, want)
+		}
+	}
+	for _, p := range cover {
+		for b := 0; b < n; b++ {
+			bit := 1 << b
+			if p.mask&bit != 0 {
+				continue
+			}
+			wider := implicant{value: p.value &^ bit, mask: p.mask | bit}
+			if implies(wider, column) {
+				t.Fatalf("term %+v of %v is not prime", p, column)
+			}
+		}
+	}
+}
+
+func implies(p implicant, column []bool) bool {
+	for row, on := range column {
+		if p.covers(row) && !on {
+			return false
+		}
+	}
+	return true
+}
+
+func columnOf(f, rows int) []bool {
+	column := make([]bool, rows)
+	for row := range column {
+		column[row] = f&(1<<row) != 0
+	}
+	return column
+}
+
+// Every function of three inputs is minimized to the fewest terms possible,
+// which is found here by trying every set of implicants.
+func TestMinimizeAllThreeInputFunctions(t *testing.T) {
+	const n = 3
+	var all []implicant
+	for mask := 0; mask < 1<<n; mask++ {
+		for value := 0; value < 1<<n; value++ {
+			if value&mask == 0 {
+				all = append(all, implicant{value: value, mask: mask})
+			}
+		}
+	}
+
+	for f := 0; f < 1<<(1<<n); f++ {
+		column := columnOf(f, 1<<n)
+		cover, exact := minimize(column, n)
+		if !exact {
+			t.Errorf("function %08b: cover not exact", f)
+		}
+		checkCover(t, column, n, cover)
+
+		var usable []implicant
+		for _, p := range all {
+			if implies(p, column) {
+				usable = append(usable, p)
+			}
+		}
+		if want := fewestTerms(usable, f); len(cover) != want {
+			t.Errorf("function %08b: got %d terms %v, want %d", f, len(cover), cover, want)
+		}
+	}
+}
+
+// fewestTerms is the size of the smallest set of implicants whose rows are
+// exactly f.
+func fewestTerms(usable []implicant, f int) int {
+	best := -1
+	for set := 0; set < 1<<len(usable); set++ {
+		size := bits.OnesCount(uint(set))
+		if best >= 0 && size >= best {
+			continue
+		}
+		union := 0
+		for i, p := range usable {
+			if set&(1<<i) == 0 {
+				continue
+			}
+			for row := 0; row < 8; row++ {
+				if p.covers(row) {
+					union |= 1 << row
+				}
+			}
+		}
+		if union == f {
+			best = size
+		}
+	}
+	return best
+}
+
+// Rows 0, 1, 2, 5, 6 and 7 form a cycle of six primes with none essential;
+// two covers of three terms exist.
+func TestMinimizeCyclic(t *testing.T) {
+	column := []bool{true, true, true, false, false, true, true, true}
+	cover, exact := minimize(column, 3)
+	if !exact || len(cover) != 3 {
+		t.Fatalf("got %v (exact %v), want three terms", cover, exact)
+	}
+	checkCover(t, column, 3, cover)
+	for _, p := range cover {
+		if p.literals(3) != 2 {
+			t.Errorf("term %+v has %d literals, want 2", p, p.literals(3))
+		}
+	}
+}
+
+// Past the exact search limits the cover is finished greedily; it is still
+// correct and made of primes.
+func TestMinimizeGreedy(t *testing.T) {
+	const n = 8
+	random := rand.New(rand.NewSource(1))
+	greedy := 0
+	for i := 0; i < 50; i++ {
+		column := make([]bool, 1<<n)
+		for row := range column {
+			column[row] = random.Intn(2) == 0
+		}
+		cover, exact := minimize(column, n)
+		if !exact {
+			greedy++
+		}
+		checkCover(t, column, n, cover)
+	}
+	if greedy == 0 {
+		t.Error("no function was large enough to need the greedy cover")
+	}
+}
+
+func TestFormatSOP(t *testing.T) {
+	inputs := []string{"A", "B", "C"}
+	tests := []struct {
+		cover []implicant
+		want  string
+	}{
+		{nil, "0"},
+		{[]implicant{{value: 0, mask: 7}}, "1"},
+		{[]implicant{{value: 4, mask: 0}}, "A & !B & !C"},
+		{[]implicant{{value: 4, mask: 2}, {value: 1, mask: 6}}, "A & !C | C"},
+	}
+	for _, test := range tests {
+		if got := formatSOP(test.cover, inputs); got != test.want {
+			t.Errorf("formatSOP(%v) = %q, want %q", test.cover, got, test.want)
+		}
+	}
+}
+
+// A minimized cover written out with formatSOP parses back into the same
+// function.
+func TestFormatSOPParses(t *testing.T) {
+	inputs := []string{"A", "B", "C", "D"}
+	for f := 0; f < 1<<16; f += 257 {
+		column := columnOf(f, 16)
+		cover, _ := minimize(column, 4)
+		source := formatSOP(cover, inputs)
+		expr, err := parseExpression(source, inputs)
+		if err != nil {
+			t.Fatalf("parseExpression(%q): %v", source, err)
+		}
+		for row, want := range column {
+			if expr(assignment(inputs, row)) != want {
+				t.Errorf("%q is %v on row %d, want %v", source, !want, row, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package logic evaluates boolean gate circuits built in the logic workspace
+// and checks them against a level's truth table.
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const Version = "1.0"
+
+// MaxGates bounds the size of a netlist. Checking it evaluates every gate
+// once per truth table row, up to 4096 times.
+const MaxGates = 500
+
+var (
+	ErrUnsupportedVersion = errors.New("Unsupported netlist version")
+	ErrNoGates            = errors.New("Netlist has no gates")
+	ErrTooManyGates       = fmt.Errorf("Netlist has more than %d gates", MaxGates)
+	// ErrInvalidNetlist wraps the problems found in a netlist's gates and
+	// wiring, so callers can tell a bad submission from a failure.
+	ErrInvalidNetlist = errors.New("Invalid netlist")
+)
+
+const (
+	TypeSwitch = "switch"
+	// TypeOutput is a probe with one input that names a level output. Any
+	// gate named like the output works too.
+	TypeOutput = "output"
+)
+
+// Terminal is a gate input or output, using the workspace's node ids
+// (`<gate>_in0`, `<gate>_out`). Terminals sharing a wireId are connected.
+type Terminal struct {
+	ID     string  `json:"id"`
+	WireID *string `json:"wireId"`
+}
+
+type Gate struct {
+	ID     string     `json:"id"`
+	Type   string     `json:"type"`
+	Name   string     `json:"name,omitempty"`
+	Inputs []Terminal `json:"inputs,omitempty"`
+	Output *Terminal  `json:"output,omitempty"`
+}
+
+type Netlist struct {
+	Version string `json:"version"`
+	Gates   []Gate `json:"gates"`
+}
+
+var arity = map[string]int{
+	"and":  -1,
+	"or":   -1,
+	"xor":  -1,
+	"nand": -1,
+	"nor":  -1,
+	"nxor": -1,
+	"not":  1,
+	// Switches drive a level input and have no inputs of their own.
+	TypeSwitch: 0,
+	TypeOutput: 1,
+}
+
+// Parse decodes a netlist and checks that every gate is known and has a
+// sensible number of inputs.
+func Parse(data []byte) (*Netlist, error) {
+	var n Netlist
+	if err := json.Unmarshal(data, &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNetlist, err)
+	}
+	if n.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+	if len(n.Gates) == 0 {
+		return nil, ErrNoGates
+	}
+	if len(n.Gates) > MaxGates {
+		return nil, ErrTooManyGates
+	}
+
+	for i := range n.Gates {
+		gate := &n.Gates[i]
+		switch gate.Type {
+		case "xnor":
+			gate.Type = "nxor"
+		case "switch-on", "switch-off":
+			gate.Type = TypeSwitch
+		}
+
+		want, ok := arity[gate.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown gate type %q", ErrInvalidNetlist, gate.Type)
+		}
+		if want >= 0 && len(gate.Inputs) != want || want < 0 && len(gate.Inputs) == 0 {
+			return nil, fmt.Errorf("%w: gate %s has %d inputs", ErrInvalidNetlist, gate.DisplayName(), len(gate.Inputs))
+		}
+	}
+	return &n, nil
+}
+
+// Decode loads a netlist that has already been decoded into generic JSON
+// values, as it arrives inside a request body.
+func Decode(v interface{}) (*Netlist, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (g Gate) DisplayName() string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return g.ID
+}
+
+// isLogic reports whether the gate counts towards gate count and depth.
+func (g Gate) isLogic() bool {
+	return g.Type != TypeSwitch && g.Type != TypeOutput
+}
+
+// apply computes the gate's output the way the workspace's BooleanGate does.
+func (g Gate) apply(inputs []bool) bool {
+	all, any, parity := true, false, false
+	for _, in := range inputs {
+		all = all && in
+		any = any || in
+		parity = parity != in
+	}
+
+	switch g.Type {
+	case "and":
+		return all
+	case "or":
+		return any
+	case "xor":
+		return parity
+	case "nand":
+		return !all
+	case "nor":
+		return !any
+	case "nxor":
+		return !parity
+	case "not":
+		return !inputs[0]
+	case TypeOutput:
+		return inputs[0]
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package logic
+
+import (
+	"errors"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+const (
+	GateSetAndOrNot = "and-or-not"
+	GateSetNand     = "nand"
+	GateSetNor      = "nor"
+)
+
+var (
+	ErrUnknownGateSet = fmt.Errorf("Gate set must be %q, %q or %q", GateSetAndOrNot, GateSetNand, GateSetNor)
+	ErrNoInputs       = errors.New("Synthesis needs at least one input")
+)
+
+// MaxSynthesisInputs is the input limit for synthesising arbitrary truth
+// tables. It is lower than the level limit because the number of prime
+// implicants, and with it the minimiser's work, grows exponentially.
+const MaxSynthesisInputs = 8
+
+var ErrTooManySynthesisInputs = fmt.Errorf("Synthesis supports at most %d inputs", MaxSynthesisInputs)
+
+// node is a two-input gate (or a level input) in a circuit being built.
+// Identical nodes are shared, so common subterms become a single gate.
+type node struct {
+	op   string
+	a, b int
+}
+
+const opInput = "input"
+
+type builder struct {
+	nodes []node
+	index map[node]int
+}
+
+func newBuilder() *builder {
+	return &builder{index: map[node]int{}}
+}
+
+func (b *builder) add(n node) int {
+	if n.b < n.a && n.op != opInput && n.op != "not" {
+		n.a, n.b = n.b, n.a
+	}
+	if i, ok := b.index[n]; ok {
+		return i
+	}
+	b.nodes = append(b.nodes, n)
+	b.index[n] = len(b.nodes) - 1
+	return len(b.nodes) - 1
+}
+
+func (b *builder) input(i int) int {
+	return b.add(node{op: opInput, a: i})
+}
+
+// tree combines terms pairwise into a balanced tree of two-input gates, which
+// keeps the circuit shallow.
+func (b *builder) tree(op string, terms []int) int {
+	for len(terms) > 1 {
+		var next []int
+		for i := 0; i+1 < len(terms); i += 2 {
+			next = append(next, b.add(node{op: op, a: terms[i], b: terms[i+1]}))
+		}
+		if len(terms)%2 == 1 {
+			next = append(next, terms[len(terms)-1])
+		}
+		terms = next
+	}
+	return terms[0]
+}
+
+// sop builds a sum of products from AND, OR and NOT gates. Constant outputs
+// are built as A & !A or A | !A, since the workspace has no constant source.
+func (b *builder) sop(cover []implicant, n int) int {
+	not := func(x int) int { return b.add(node{op: "not", a: x}) }
+	if len(cover) == 0 {
+		return b.add(node{op: "and", a: b.input(0), b: not(b.input(0))})
+	}
+
+	var products []int
+	for _, p := range cover {
+		var literals []int
+		for i := 0; i < n; i++ {
+			bit := 1 << (n - 1 - i)
+			if p.mask&bit != 0 {
+				continue
+			}
+			if p.value&bit != 0 {
+				literals = append(literals, b.input(i))
+			} else {
+				literals = append(literals, not(b.input(i)))
+			}
+		}
+		if len(literals) == 0 {
+			return b.add(node{op: "or", a: b.input(0), b: not(b.input(0))})
+		}
+		products = append(products, b.tree("and", literals))
+	}
+	return b.tree("or", products)
+}
+
+// translate rebuilds an AND/OR/NOT circuit from a single universal gate.
+// Double inversions cancel, so a sum of products becomes the familiar
+// NAND-NAND (or NOR-NOR) form.
+func translate(src *builder, roots []int, gateSet string) (*builder, []int) {
+	if gateSet == GateSetAndOrNot {
+		return src, roots
+	}
+
+	universal := "nand"
+	if gateSet == GateSetNor {
+		universal = "nor"
+	}
+
+	dst := newBuilder()
+	not := func(x int) int {
+		if n := dst.nodes[x]; n.op == universal && n.a == n.b {
+			return n.a
+		}
+		return dst.add(node{op: universal, a: x, b: x})
+	}
+
+	memo := map[int]int{}
+	var visit func(i int) int
+	visit = func(i int) int {
+		if out, ok := memo[i]; ok {
+			return out
+		}
+		n := src.nodes[i]
+		var out int
+		switch {
+		case n.op == opInput:
+			out = dst.input(n.a)
+		case n.op == "not":
+			out = not(visit(n.a))
+		case n.op == "and" && universal == "nand", n.op == "or" && universal == "nor":
+			out = not(dst.add(node{op: universal, a: visit(n.a), b: visit(n.b)}))
+		default:
+			// OR from NAND and AND from NOR, by De Morgan.
+			out = dst.add(node{op: universal, a: not(visit(n.a)), b: not(visit(n.b))})
+		}
+		memo[i] = out
+		return out
+	}
+
+	translated := make([]int, len(roots))
+	for i, root := range roots {
+		translated[i] = visit(root)
+	}
+	return dst, translated
+}
+
+// Synthesize minimises every output of the target and builds a netlist from
+// the requested gate set. The netlist is checked against the target before it
+// is returned. Result.Minimal says whether every cover is provably minimal.
+func Synthesize(target models.BooleanTarget, gateSet string) (result models.BooleanSynthesis, err error) {
+	if gateSet == "" {
+		gateSet = GateSetAndOrNot
+	}
+	if gateSet != GateSetAndOrNot && gateSet != GateSetNand && gateSet != GateSetNor {
+		return result, ErrUnknownGateSet
+	}
+	if len(target.Inputs) == 0 {
+		return result, ErrNoInputs
+	}
+
+	rows, err := Table(target)
+	if err != nil {
+		return
+	}
+
+	b := newBuilder()
+	roots := make([]int, len(target.Outputs))
+	result.Expressions = map[string]string{}
+	result.Minimal = true
+	for o, name := range target.Outputs {
+		column := make([]bool, len(rows))
+		for i, row := range rows {
+			column[i] = row[o]
+		}
+		cover, exact := minimize(column, len(target.Inputs))
+		result.Minimal = result.Minimal && exact
+		result.Expressions[name] = formatSOP(cover, target.Inputs)
+		roots[o] = b.sop(cover, len(target.Inputs))
+	}
+
+	b, roots = translate(b, roots, gateSet)
+	netlist := b.netlist(roots, target)
+
+	evaluation, err := Check(netlist, target)
+	if err != nil {
+		return
+	}
+	if !evaluation.Solved {
+		return result, errors.New("Synthesised circuit does not match the truth table")
+	}
+
+	result.GateSet = gateSet
+	result.Netlist = netlist
+	result.GateCount = evaluation.GateCount
+	result.Depth = evaluation.Depth
+	return
+}
+
+// netlist emits the gates reachable from the outputs in the workspace's
+// format: a switch per input, and an output probe per output.
+func (b *builder) netlist(roots []int, target models.BooleanTarget) *Netlist {
+	used := make([]bool, len(b.nodes))
+	var mark func(i int)
+	mark = func(i int) {
+		if used[i] {
+			return
+		}
+		used[i] = true
+		if n := b.nodes[i]; n.op != opInput {
+			mark(n.a)
+			if n.op != "not" {
+				mark(n.b)
+			}
+		}
+	}
+	for _, root := range roots {
+		mark(root)
+	}
+
+	n := &Netlist{Version: Version}
+	wires := make([]string, len(b.nodes))
+	terminal := func(id string, wire string) Terminal {
+		return Terminal{ID: id, WireID: &wire}
+	}
+
+	for i, name := range target.Inputs {
+		id := fmt.Sprintf("sw_%d", i+1)
+		n.Gates = append(n.Gates, Gate{ID: id, Type: TypeSwitch, Name: name, Output: ptr(terminal(id+"_out", "wire_"+id))})
+		if j, ok := b.index[node{op: opInput, a: i}]; ok {
+			wires[j] = "wire_" + id
+		}
+	}
+
+	count := 0
+	for i, nd := range b.nodes {
+		if !used[i] || nd.op == opInput {
+			continue
+		}
+		count++
+		id := fmt.Sprintf("%s_%d", nd.op, count)
+		wires[i] = "wire_" + id
+		gate := Gate{ID: id, Type: nd.op, Output: ptr(terminal(id+"_out", wires[i]))}
+		gate.Inputs = append(gate.Inputs, terminal(id+"_in0", wires[nd.a]))
+		if nd.op != "not" {
+			gate.Inputs = append(gate.Inputs, terminal(id+"_in1", wires[nd.b]))
+		}
+		n.Gates = append(n.Gates, gate)
+	}
+
+	for o, name := range target.Outputs {
+		id := fmt.Sprintf("out_%d", o+1)
+		n.Gates = append(n.Gates, Gate{ID: id, Type: TypeOutput, Name: name, Inputs: []Terminal{terminal(id+"_in0", wires[roots[o]])}})
+	}
+	return n
+}
+
+func ptr(t Terminal) *Terminal {
+	return &t
+}
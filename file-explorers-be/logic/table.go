@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"errors"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+// The limits keep the truth table small enough to enumerate per request.
+const (
+	maxInputs     = 12
+	maxOutputs    = 16
+	maxExpression = 1000
+)
+
+var (
+	ErrTooManyInputs     = fmt.Errorf("Boolean levels support at most %d inputs", maxInputs)
+	ErrTooManyOutputs    = fmt.Errorf("Boolean levels support at most %d outputs", maxOutputs)
+	ErrExpressionTooLong = fmt.Errorf("Expressions are limited to %d characters", maxExpression)
+)
+
+var ErrNoOutputs = errors.New("Boolean level has no outputs")
+
+// Table returns the expected value of every output for each input row.
+func Table(target models.BooleanTarget) (rows [][]bool, err error) {
+	if len(target.Inputs) > maxInputs {
+		return nil, ErrTooManyInputs
+	}
+	if len(target.Outputs) == 0 {
+		return nil, ErrNoOutputs
+	}
+	if len(target.Outputs) > maxOutputs {
+		return nil, ErrTooManyOutputs
+	}
+
+	count := 1 << len(target.Inputs)
+	rows = make([][]bool, count)
+	for i := range rows {
+		rows[i] = make([]bool, len(target.Outputs))
+	}
+
+	for o, name := range target.Outputs {
+		if column, ok := target.TruthTable[name]; ok {
+			if len(column) != count {
+				return nil, fmt.Errorf("Truth table for %s has %d rows, expected %d", name, len(column), count)
+			}
+			for i, value := range column {
+				rows[i][o] = value != 0
+			}
+			continue
+		}
+
+		source, ok := target.Expressions[name]
+		if !ok {
+			return nil, fmt.Errorf("No truth table or expression for output %s", name)
+		}
+		if len(source) > maxExpression {
+			return nil, ErrExpressionTooLong
+		}
+		expr, err := parseExpression(source, target.Inputs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			rows[i][o] = expr(assignment(target.Inputs, i))
+		}
+	}
+	return
+}
+
+// Check enumerates every input combination and compares the netlist's
+// outputs with the target.
+func Check(n *Netlist, target models.BooleanTarget) (evaluation models.BooleanEvaluation, err error) {
+	expected, err := Table(target)
+	if err != nil {
+		return
+	}
+	c, err := Compile(n, target.Inputs, target.Outputs)
+	if err != nil {
+		return
+	}
+
+	evaluation = models.BooleanEvaluation{
+		Inputs:    target.Inputs,
+		Outputs:   target.Outputs,
+		Rows:      make([]models.TruthTableRow, len(expected)),
+		Solved:    true,
+		GateCount: c.GateCount(),
+		Depth:     c.Depth(),
+	}
+	for i, want := range expected {
+		inputs := assignment(target.Inputs, i)
+		got := c.Evaluate(inputs)
+
+		row := models.TruthTableRow{Correct: true}
+		for _, name := range target.Inputs {
+			row.Inputs = append(row.Inputs, bit(inputs[name]))
+		}
+		for o, name := range target.Outputs {
+			row.Expected = append(row.Expected, bit(want[o]))
+			row.Actual = append(row.Actual, bit(got[name]))
+			if want[o] != got[name] {
+				row.Correct = false
+			}
+		}
+		evaluation.Rows[i] = row
+		evaluation.Solved = evaluation.Solved && row.Correct
+	}
+	return
+}
+
+// assignment sets the inputs to the bits of row, first input most significant.
+func assignment(inputs []string, row int) map[string]bool {
+	values := make(map[string]bool, len(inputs))
+	for i, name := range inputs {
+		values[name] = row&(1<<(len(inputs)-1-i)) != 0
+	}
+	return values
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
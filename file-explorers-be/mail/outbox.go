@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMailer writes each message to its own .eml file instead of sending
+// it, so links can be followed without a mail server.
+type OutboxMailer struct {
+	dir  string
+	from string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewOutboxMailer(dir, from string) *OutboxMailer {
+	if dir == "" {
+		dir = "outbox"
+	}
+	return &OutboxMailer{dir: dir, from: from}
+}
+
+func (m *OutboxMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%03d-%s.eml", now.Format("20060102T150405"), len(m.sent)%1000, fileSafe(msg.To))
+	err := os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg, now), 0o644)
+	if err != nil {
+		return err
+	}
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent since the mailer was created.
+func (m *OutboxMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
+
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		case r == '@':
+			return '_'
+		}
+		return -1
+	}, s)
+}
@@ -3,21 +3,32 @@ package main
 import (
 	"database/sql"
 	"file-explorers-be/config"
+	"file-explorers-be/jwk"
+	"file-explorers-be/mail"
 	"file-explorers-be/repository"
 	"file-explorers-be/router"
 	"file-explorers-be/server"
 	"file-explorers-be/service"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
 	cfg := config.NewConfig()
 	cfg.Print()
 
-	db, err := sql.Open("mysql", cfg.DBHost)
+	dsn, err := mysql.ParseDSN(cfg.DBHost)
+	if err != nil {
+		log.Fatal("Invalid database DSN:", err)
+	}
+	// Timestamps are scanned straight into time.Time values.
+	dsn.ParseTime = true
+
+	db, err := sql.Open("mysql", dsn.FormatDSN())
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -29,12 +40,103 @@ func main() {
 
 	authRepo := repository.NewAuthRepository(db)
 	levelRepo := repository.NewLevelRepository(db)
+	terminalRepo := repository.NewTerminalRepository(db)
+	circuitRepo := repository.NewCircuitRepository(db)
+	workspaceRepo := repository.NewWorkspaceRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	accountRepo := repository.NewAccountRepository(db)
+	privacyRepo := repository.NewPrivacyRepository(db)
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+
+	mailer, err := mail.New(mail.Config{
+		Driver:       cfg.MailDriver,
+		From:         cfg.MailFrom,
+		OutboxDir:    cfg.MailOutboxDir,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+	})
+	if err != nil {
+		log.Fatal("Invalid mail configuration:", err)
+	}
+
+	var attemptRepo repository.AttemptRepository
+	switch cfg.LoginThrottleStore {
+	case config.ThrottleMySQL:
+		attemptRepo = repository.NewAttemptRepository(db)
+	case config.ThrottleMemory:
+		attemptRepo = repository.NewMemoryAttemptRepository()
+	default:
+		log.Fatal("Unknown login throttle store:", cfg.LoginThrottleStore)
+	}
+
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
 
-	jwtService := service.NewJwtService(cfg)
-	levelRepoService := service.NewLevelService(levelRepo, jwtService)
-	authService := service.NewAuthService(authRepo, jwtService)
+	auditLogger := service.NewAuditLogger(auditRepo)
+	jwtService := service.NewJwtService(keys, cfg, tokenRepo)
+	loginThrottle := service.NewLoginThrottle(attemptRepo, cfg)
+	levelRepoService := service.NewLevelService(levelRepo, auditLogger)
+	authService := service.NewAuthService(authRepo, tokenRepo, roleRepo, sessionRepo, jwtService, loginThrottle, auditLogger, mailer, cfg)
+	terminalService := service.NewTerminalService(terminalRepo, levelRepo)
+	circuitService := service.NewCircuitService(circuitRepo)
+	logicService := service.NewLogicService(levelRepo)
+	workspaceService := service.NewWorkspaceService(workspaceRepo)
+	roleService := service.NewRoleService(roleRepo, authRepo, tokenRepo, auditLogger)
+	oidcService := service.NewOIDCService(identityRepo, authRepo, authService, auditLogger, cfg)
+	twoFactorService := service.NewTwoFactorService(twoFactorRepo, tokenRepo, authService, jwtService, auditLogger)
+	privacyService := service.NewPrivacyService(privacyRepo, auditLogger)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo, authRepo, roleRepo, auditLogger)
+	sessionService := service.NewSessionService(sessionRepo, tokenRepo, auditLogger)
+	accountService := service.NewAccountService(accountRepo, authRepo, privacyRepo, tokenRepo, authService, auditLogger, mailer, cfg)
+	auditService := service.NewAuditService(auditRepo, auditLogger, cfg)
 
-	srv := server.NewControllers(authService, levelRepoService)
+	if err := authService.SeedAdmin(cfg.AdminUsername, cfg.AdminEmail, cfg.AdminPassword); err != nil {
+		log.Fatal("Failed to create admin user:", err)
+	}
+
+	// Accounts that never verified their email and guests that stopped
+	// playing are cleaned up once an hour, accounts past their deletion date
+	// are erased, and old addresses are removed from the audit log.
+	go func() {
+		for {
+			purged, err := authService.PurgeUnverified()
+			if err != nil {
+				log.Println("Failed to purge unverified accounts:", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d unverified accounts\n", purged)
+			}
+			purged, err = authService.PurgeGuests()
+			if err != nil {
+				log.Println("Failed to purge guest accounts:", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d guest accounts\n", purged)
+			}
+			erased, err := privacyService.ProcessErasures()
+			if err != nil {
+				log.Println("Failed to process erasure requests:", err)
+			} else if erased > 0 {
+				log.Printf("Erased %d accounts\n", erased)
+			}
+			purged, err = auditService.PurgeIPs()
+			if err != nil {
+				log.Println("Failed to purge audit log addresses:", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d audit log addresses\n", purged)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	srv := server.NewControllers(authService, jwtService, levelRepoService, terminalService, circuitService, logicService, workspaceService, roleService, oidcService, twoFactorService, accountService, privacyService, accessTokenService, sessionService, auditService)
 
 	r := router.NewRouter(srv)
 
@@ -43,3 +145,33 @@ func main() {
 		log.Fatal("Server failed to start:", err)
 	}
 }
+
+// loadKeys reads the signing and verification keys. Without a signing key a
+// temporary one is generated, which is fine for development but logs
+// everyone out on restart and does not work with several instances.
+func loadKeys(cfg config.Config) (*jwk.Set, error) {
+	var signing *jwk.Key
+	var err error
+	if cfg.JwtSigningKey == "" {
+		log.Println("JWT_SIGNING_KEY is not set, signing tokens with a temporary key")
+		signing, err = jwk.GenerateKey()
+	} else {
+		signing, err = jwk.LoadKey(cfg.JwtSigningKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("%s holds no private key", cfg.JwtSigningKey)
+	}
+
+	var verification []*jwk.Key
+	for _, path := range cfg.JwtVerificationKeys {
+		key, err := jwk.LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+	return jwk.NewSet(signing, verification...), nil
+}
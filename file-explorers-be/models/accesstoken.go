@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Scopes limit what a personal access token can do. The roles of its owner
+// still apply on top.
+const (
+	ScopeReadProgress = "read:progress"
+	ScopeWriteLevels  = "write:levels"
+	ScopeAdminUsers   = "admin:users"
+)
+
+type AccessToken struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"-"`
+	Name   string `json:"name"`
+	// Prefix is the start of the token, enough to recognise it.
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type AccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreatedAccessToken is the only response that carries the token itself.
+type CreatedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Profile is what the owner of an account sees at /me.
+type Profile struct {
+	User
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Bio         string `json:"bio"`
+	Language    string `json:"language"`
+	// PendingEmail is the new address while it waits to be confirmed.
+	PendingEmail string    `json:"pending_email,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ProfileUpdate changes the fields that are set and leaves the others
+// alone. An empty string clears a field. A new email address has to be
+// confirmed with the password; accounts without one must have just signed
+// in.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+	AvatarURL   *string `json:"avatar_url"`
+	Bio         *string `json:"bio"`
+	Language    *string `json:"language"`
+	Password    string  `json:"password"`
+}
+
+type PasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// DeleteAccountRequest confirms the deletion with the password; accounts
+// without one must have just signed in.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type AccountDeletion struct {
+	DeleteAt time.Time `json:"delete_at"`
+}
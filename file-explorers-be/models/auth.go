@@ -1,8 +1,13 @@
 package models
 
+import "time"
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// GuestToken is the access token of a guest whose progress should be
+	// merged into the account.
+	GuestToken string `json:"guest_token,omitempty"`
 }
 
 type RegisterRequest struct {
@@ -11,6 +16,13 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// UpgradeRequest turns a guest into a full account.
+type UpgradeRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
 type ChangePasswordRequest struct {
 	Username    string `json:"username" binding:"required"`
 	OldPassword string `json:"old_password" binding:"required"`
@@ -22,4 +34,74 @@ type User struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"-"`
+
+	EmailVerified bool `json:"email_verified"`
+
+	// Guest accounts are made by /auth/guest so people can play without
+	// registering. They have no email or password until they are upgraded.
+	Guest bool `json:"guest"`
+
+	// TwoFactorRequired is set when one of the user's roles needs two-factor
+	// authentication that the user has not enabled yet; those roles are
+	// left out of their tokens until they do.
+	TwoFactorEnabled  bool `json:"two_factor_enabled"`
+	TwoFactorRequired bool `json:"two_factor_required"`
+
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+
+	// DeletionRequestedAt is set while the account waits to be deleted;
+	// signing in again cancels the deletion.
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
+
+	// TokenVersion is bumped to invalidate every token issued to the user.
+	TokenVersion int `json:"-"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// AuthTokens is handed out on login, registration and refresh. The access
+// token is short-lived; the refresh token is single use and is exchanged for
+// a new pair at /auth/refresh.
+type AuthTokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	// MFAToken is set instead of the other fields when the password was
+	// right but a second factor is still needed.
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+// RefreshToken is the stored form of a refresh token. Only the SHA-256 hash
+// of the token is kept; every rotation stays in the same family so reuse of
+// an old token can revoke all of them.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// LoginAttempts counts the recent failed logins of one username or address.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
 }
@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+// CircuitTarget is a value a challenge expects to be measured on a component,
+// e.g. the current through R1. Component matches the component's id, name or
+// type.
+type CircuitTarget struct {
+	Component string  `json:"component"`
+	Quantity  string  `json:"quantity"`
+	Value     float64 `json:"value"`
+}
+
+type CircuitChallenge struct {
+	ChallengeID  int             `json:"challenge_id"`
+	Position     int             `json:"position"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	Definition   interface{}     `json:"definition,omitempty"`
+	Targets      []CircuitTarget `json:"targets"`
+	Tolerance    float64         `json:"tolerance"`
+	Points       int             `json:"points"`
+	Completed    bool            `json:"completed"`
+	PointsEarned int             `json:"points_earned"`
+	CompletedAt  *time.Time      `json:"completed_at,omitempty"`
+}
+
+type CircuitProgress struct {
+	CurrentChallengeIndex int                `json:"currentChallengeIndex"`
+	Points                int                `json:"points"`
+	Challenges            []CircuitChallenge `json:"challenges"`
+}
+
+type CircuitSubmission struct {
+	Circuit interface{} `json:"circuit" binding:"required"`
+}
+
+// CircuitComponentResult is the operating point of one component. Current
+// flows from the start terminal to the end terminal; a battery's current is
+// the current it delivers. Resistance is omitted for batteries and open
+// switches.
+type CircuitComponentResult struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Voltage    float64  `json:"voltage"`
+	Current    float64  `json:"current"`
+	Power      float64  `json:"power"`
+	Resistance *float64 `json:"resistance,omitempty"`
+}
+
+type CircuitEvaluation struct {
+	Components []CircuitComponentResult `json:"components"`
+	Short      bool                     `json:"short"`
+	Open       bool                     `json:"open"`
+	Warnings   []string                 `json:"warnings,omitempty"`
+}
+
+type CircuitSimulationRequest struct {
+	Circuit    interface{} `json:"circuit" binding:"required"`
+	SampleRate float64     `json:"sampleRate,omitempty"`
+	Duration   float64     `json:"duration,omitempty"`
+}
+
+// OscilloscopeTrace mirrors the frontend Oscilloscope config so a trace can be
+// plotted by passing it straight to the component and feeding it the
+// measurements.
+type OscilloscopeTrace struct {
+	Name            string    `json:"name"`
+	InputType       string    `json:"inputType"`
+	MaxMeasurements int       `json:"maxMeasurements"`
+	MinVoltage      float64   `json:"minVoltage"`
+	MaxVoltage      float64   `json:"maxVoltage"`
+	Measurements    []float64 `json:"measurements"`
+}
+
+type CircuitTrace struct {
+	ID            string              `json:"id"`
+	Name          string              `json:"name"`
+	Type          string              `json:"type"`
+	VoltagePeak   float64             `json:"voltagePeak"`
+	VoltageRMS    float64             `json:"voltageRms"`
+	CurrentPeak   float64             `json:"currentPeak"`
+	CurrentRMS    float64             `json:"currentRms"`
+	PowerAverage  float64             `json:"powerAverage"`
+	Oscilloscopes []OscilloscopeTrace `json:"oscilloscopes"`
+}
+
+type CircuitSimulation struct {
+	SampleRate float64        `json:"sampleRate"`
+	Duration   float64        `json:"duration"`
+	Times      []float64      `json:"times"`
+	Components []CircuitTrace `json:"components"`
+	Short      bool           `json:"short"`
+	Open       bool           `json:"open"`
+	Warnings   []string       `json:"warnings,omitempty"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Identity links a user to an account at an external OpenID Connect
+// provider, such as a school Google or Microsoft account.
+type Identity struct {
+	UserID    int       `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"linked_at"`
+}
+
+// OIDCState remembers a login that was sent to a provider until the browser
+// comes back. UserID is set when an existing account is linking a provider.
+type OIDCState struct {
+	State     string
+	Provider  string
+	Nonce     string
+	Verifier  string
+	UserID    *int
+	Redirect  *string
+	ExpiresAt time.Time
+
+	// Subject and Email are set instead of the nonce and verifier on a link
+	// that came back from the provider and waits for the user to confirm it.
+	Subject *string
+	Email   *string
+}
+
+// OIDCLogin is the outcome of a provider callback: either a signed-in user
+// or, for the account that started linking, a token to confirm the link.
+// Linked is set when the identity already belongs to that account.
+type OIDCLogin struct {
+	Tokens    AuthTokens
+	User      User
+	Linked    bool
+	LinkToken string
+	Redirect  string
+}
+
+// OIDCLinkRequest confirms a link with the token from the link callback.
+type OIDCLinkRequest struct {
+	LinkToken string `json:"link_token"`
+}
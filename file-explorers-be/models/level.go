@@ -4,8 +4,15 @@ type LevelRequest struct {
 	Level int `json:"level" binding:"required"`
 }
 
+const (
+	LevelTypeGUI      = "gui"
+	LevelTypeTerminal = "terminal"
+	LevelTypeBoolean  = "boolean"
+)
+
 type LevelData struct {
 	LevelID            int         `json:"level_id,omitempty"`
+	Type               string      `json:"type,omitempty"`
 	StartingFileSystem interface{} `json:"startingFileSystem,omitempty"`
 	Solution           interface{} `json:"solution,omitempty"`
 	Name               string      `json:"name,omitempty"`
@@ -19,10 +26,63 @@ type LevelStatus struct {
 	Solved     bool   `json:"solved"`
 	Name       string `json:"name"`
 	Difficulty string `json:"description"`
+	Type       string `json:"type"`
+	Score      *int   `json:"score,omitempty"`
+	GateCount  *int   `json:"gate_count,omitempty"`
+	GateDepth  *int   `json:"gate_depth,omitempty"`
 }
 
 type LeaderboardEntry struct {
-	Username     string `json:"username"`
-	LevelsSolved int    `json:"levels_solved"`
-	TotalTime    int64  `json:"total_time"`
+	Username      string `json:"username"`
+	LevelsSolved  int    `json:"levels_solved"`
+	TotalTime     int64  `json:"total_time"`
+	CircuitPoints int    `json:"circuit_points"`
+}
+
+// BooleanTarget is the solution of a boolean level. Each output is given
+// either as an expression over the inputs or as a truth table column, where
+// row i sets the inputs to the bits of i with the first input as the most
+// significant bit.
+type BooleanTarget struct {
+	Inputs      []string          `json:"inputs"`
+	Outputs     []string          `json:"outputs"`
+	Expressions map[string]string `json:"expressions,omitempty"`
+	TruthTable  map[string][]int  `json:"truthTable,omitempty"`
+}
+
+type BooleanSubmission struct {
+	Netlist interface{} `json:"netlist" binding:"required"`
+}
+
+type TruthTableRow struct {
+	Inputs   []int `json:"inputs"`
+	Expected []int `json:"expected"`
+	Actual   []int `json:"actual"`
+	Correct  bool  `json:"correct"`
+}
+
+type BooleanEvaluation struct {
+	Inputs    []string        `json:"inputs"`
+	Outputs   []string        `json:"outputs"`
+	Rows      []TruthTableRow `json:"rows"`
+	Solved    bool            `json:"solved"`
+	GateCount int             `json:"gateCount"`
+	Depth     int             `json:"depth"`
+}
+
+type SynthesisRequest struct {
+	BooleanTarget
+	GateSet string `json:"gateSet"`
+}
+
+// BooleanSynthesis is a reference circuit. Minimal is false when an output
+// had too many prime implicants to search exhaustively; its expression is
+// then near-minimal.
+type BooleanSynthesis struct {
+	GateSet     string            `json:"gateSet"`
+	Minimal     bool              `json:"minimal"`
+	Expressions map[string]string `json:"expressions"`
+	Netlist     interface{}       `json:"netlist"`
+	GateCount   int               `json:"gateCount"`
+	Depth       int               `json:"depth"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	ErasurePending   = "pending"
+	ErasureCancelled = "cancelled"
+	ErasureCompleted = "completed"
+)
+
+// DataExport holds the records of one user, keyed by the section they
+// belong to, such as "levels" or "workspaces".
+type DataExport map[string][]map[string]interface{}
+
+type ErasureRequest struct {
+	ID     int `json:"id"`
+	UserID int `json:"user_id"`
+	// Username is the current name, anonymised once the erasure completed.
+	Username    string     `json:"username"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requested_at"`
+	EraseAfter  time.Time  `json:"erase_after"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// CompletedBy is the admin who ran the erasure early, if any.
+	CompletedBy *int `json:"completed_by,omitempty"`
+	// Summary counts the rows removed from each table.
+	Summary map[string]int64 `json:"summary,omitempty"`
+}
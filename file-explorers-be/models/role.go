@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	RolePlayer  = "player"
+	RoleTeacher = "teacher"
+	RoleAdmin   = "admin"
+)
+
+const (
+	PermissionAuthorLevels  = "levels.author"
+	PermissionManageClasses = "classes.manage"
+	PermissionModerateUsers = "users.moderate"
+	PermissionManageRoles   = "roles.manage"
+)
+
+type Role struct {
+	Name              string   `json:"name"`
+	Permissions       []string `json:"permissions"`
+	TwoFactorRequired bool     `json:"two_factor_required"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type RoleTwoFactorRequest struct {
+	Required bool `json:"required"`
+}
+
+type UserRole struct {
+	Role      string    `json:"role"`
+	GrantedBy *int      `json:"granted_by,omitempty"`
+	GrantedAt time.Time `json:"granted_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"user_agent"`
+	// Device is a short description of the user agent, such as
+	// "Firefox on Windows".
+	Device     string     `json:"device"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	// Current marks the session the request was made from.
+	Current bool `json:"current"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "encoding/json"
+
+type File struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	IsDirectory       bool   `json:"isDirectory"`
+	ParentDirectoryID *int   `json:"parentDirectoryId"`
+}
+
+// OptionalID distinguishes a missing parentDirectoryId from an explicit null,
+// which in a level solution means "must be in the root folder".
+type OptionalID struct {
+	Set   bool
+	Value *int
+}
+
+func (o *OptionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (o OptionalID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.Value)
+}
+
+type SolutionRequirement struct {
+	ID                *int       `json:"id,omitempty"`
+	Name              *string    `json:"name,omitempty"`
+	ParentDirectoryID OptionalID `json:"parentDirectoryId"`
+	Removed           bool       `json:"removed,omitempty"`
+	IsOpened          bool       `json:"isOpened,omitempty"`
+	Type              string     `json:"type,omitempty"`
+}
+
+type TerminalRequest struct {
+	Command string `json:"command" binding:"required"`
+}
+
+type TerminalState struct {
+	FileSystem []File `json:"fileSystem"`
+	OpenFolder *int   `json:"openFolder"`
+	NextID     int    `json:"nextId"`
+}
+
+type TerminalResult struct {
+	Command    string `json:"command"`
+	Output     string `json:"output"`
+	Error      string `json:"error,omitempty"`
+	Cwd        string `json:"cwd"`
+	OpenFolder *int   `json:"openFolder"`
+	FileSystem []File `json:"fileSystem"`
+	Solved     bool   `json:"solved"`
+}
+
+type TranscriptRequest struct {
+	Commands []string `json:"commands" binding:"required"`
+}
+
+type TranscriptStep struct {
+	Command string `json:"command"`
+	Output  string `json:"output"`
+	Error   string `json:"error,omitempty"`
+}
+
+type TranscriptResult struct {
+	Steps      []TranscriptStep `json:"steps"`
+	Cwd        string           `json:"cwd"`
+	FileSystem []File           `json:"fileSystem"`
+	Solved     bool             `json:"solved"`
+	Commands   int              `json:"commands"`
+	Keystrokes int              `json:"keystrokes"`
+	Score      int              `json:"score"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// TwoFactorSetup is what an authenticator app needs to be enrolled. QRCode
+// is a PNG data URI of the otpauth URI.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qr_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorVerifyRequest struct {
+	MFAToken   string `json:"mfa_token" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	GuestToken string `json:"guest_token,omitempty"`
+}
+
+// TwoFactorEnabled answers enrolment: the recovery codes are shown this once,
+// and the user continues in a new session.
+type TwoFactorEnabled struct {
+	RecoveryCodes []string   `json:"recovery_codes"`
+	Tokens        AuthTokens `json:"-"`
+	User          User       `json:"-"`
+}
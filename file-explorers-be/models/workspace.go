@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+const (
+	WorkspaceKindCircuit = "circuit"
+	WorkspaceKindBoolean = "boolean"
+)
+
+type WorkspaceRequest struct {
+	Name    string      `json:"name"`
+	Kind    string      `json:"kind"`
+	Content interface{} `json:"content"`
+}
+
+type Workspace struct {
+	WorkspaceID int         `json:"workspace_id"`
+	Name        string      `json:"name"`
+	Kind        string      `json:"kind"`
+	Version     int         `json:"version"`
+	Content     interface{} `json:"content,omitempty"`
+	ShareToken  *string     `json:"share_token,omitempty"`
+	Owner       string      `json:"owner,omitempty"`
+	ReadOnly    bool        `json:"read_only"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+type WorkspaceVersion struct {
+	Version   int         `json:"version"`
+	Size      int         `json:"size"`
+	Content   interface{} `json:"content,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
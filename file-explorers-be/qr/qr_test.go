@@ -0,0 +1,113 @@
+package qr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// The 1-M "HELLO WORLD" block worked through in most QR code tutorials.
+func TestReedSolomon(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("error correction = %v, want %v", got, want)
+	}
+}
+
+// helloWorld is "Hello, world!" as drawn by other encoders at level M.
+const helloWorld = `
+#######.....#.#######
+#.....#..#.#..#.....#
+#.###.#.#.###.#.###.#
+#.###.#.#.....#.###.#
+#.###.#.##..#.#.###.#
+#.....#.####..#.....#
+#######.#.#.#.#######
+........#.#..........
+#.#####..###..#####..
+...##..##...##..###.#
+...#..#.###.###..###.
+.##..#.#..####.#.##..
+##.####.#...#.##....#
+........#....#####...
+#######..##.####..##.
+#.....#.#.#.##.#.###.
+#.###.#.##.####.#..##
+#.###.#.#.#....###...
+#.###.#.#####.##..#..
+#.....#...#.##..###..
+#######.##.#..#.#..#.
+`
+
+func TestEncode(t *testing.T) {
+	code, err := Encode("Hello, world!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := grid(code), strings.TrimPrefix(helloWorld, "\n"); got != want {
+		t.Errorf("Encode drew\n%s\nwant\n%s", got, want)
+	}
+}
+
+// A version 7 code also carries the version information blocks. The hash is
+// of the grid other encoders draw for the same URI.
+func TestEncodeVersion7(t *testing.T) {
+	uri := "otpauth://totp/File%20Explorers:user100?algorithm=SHA1&digits=6&issuer=File%20Explorers&period=30&secret=JBSWY3DPEHPK3PXP"
+	code, err := Encode(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Size != 45 {
+		t.Fatalf("size = %d, want 45", code.Size)
+	}
+	sum := sha256.Sum256([]byte(grid(code)))
+	if got, want := hex.EncodeToString(sum[:]), "e68298e88df9f417ade5c6387365a00b8bb30a17017e69cf8e5fd14e1c8b7878"; got != want {
+		t.Errorf("grid hash = %s, want %s", got, want)
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("a", 214)); err != ErrTooLong {
+		t.Errorf("err = %v, want ErrTooLong", err)
+	}
+	if _, err := Encode(strings.Repeat("a", 213)); err != nil {
+		t.Errorf("213 bytes: %v", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("Hello, world!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Dx(); size < code.Size*4 {
+		t.Errorf("image is %d pixels wide, want at least %d", size, code.Size*4)
+	}
+}
+
+func grid(c *Code) string {
+	var b strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
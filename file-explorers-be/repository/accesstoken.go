@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrAccessTokenNotFound = fmt.Errorf("access token not found")
+
+type AccessTokenRepository interface {
+	CreateAccessToken(userId int, name, prefix, hash string, scopes []string, expiresAt time.Time) (tokenId int, err error)
+	ListAccessTokens(userId int) (tokens []models.AccessToken, err error)
+	CountAccessTokens(userId int) (count int, err error)
+	GetAccessToken(hash string) (token models.AccessToken, err error)
+	TouchAccessToken(tokenId int) (err error)
+	RevokeAccessToken(userId, tokenId int) (err error)
+}
+
+const accessTokenColumns = "id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at"
+
+type accessTokenRepo struct {
+	db *sql.DB
+}
+
+func NewAccessTokenRepository(db *sql.DB) AccessTokenRepository {
+	return &accessTokenRepo{
+		db: db,
+	}
+}
+
+func (repo *accessTokenRepo) CreateAccessToken(userId int, name, prefix, hash string, scopes []string, expiresAt time.Time) (tokenId int, err error) {
+	sql := "INSERT INTO personal_access_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)"
+	res, err := repo.db.Exec(sql, userId, name, prefix, hash, strings.Join(scopes, " "), expiresAt)
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// ListAccessTokens returns the tokens that still work, newest first.
+func (repo *accessTokenRepo) ListAccessTokens(userId int) (tokens []models.AccessToken, err error) {
+	sql := "SELECT " + accessTokenColumns + `
+        FROM personal_access_tokens
+        WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY created_at DESC
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	tokens = []models.AccessToken{}
+	for rows.Next() {
+		var token models.AccessToken
+		err = scanAccessToken(rows, &token)
+		if err != nil {
+			return
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (repo *accessTokenRepo) CountAccessTokens(userId int) (count int, err error) {
+	sql := "SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()"
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	err = rows.Scan(&count)
+	return
+}
+
+// GetAccessToken finds a working token by its hash. Tokens of accounts
+// waiting to be deleted do not work until the deletion is called off.
+func (repo *accessTokenRepo) GetAccessToken(hash string) (token models.AccessToken, err error) {
+	sql := `
+        SELECT t.id, t.user_id, t.name, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.created_at
+        FROM personal_access_tokens t
+        JOIN users u ON u.id = t.user_id
+        WHERE t.token_hash = ? AND t.revoked_at IS NULL AND t.expires_at > NOW()
+            AND u.deletion_requested_at IS NULL AND u.erased_at IS NULL
+    `
+	rows, err := repo.db.Query(sql, hash)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = ErrAccessTokenNotFound
+		return
+	}
+	err = scanAccessToken(rows, &token)
+	return
+}
+
+// TouchAccessToken records that the token was used, at most once a minute.
+func (repo *accessTokenRepo) TouchAccessToken(tokenId int) (err error) {
+	sql := "UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)"
+	_, err = repo.db.Exec(sql, tokenId)
+	return
+}
+
+func (repo *accessTokenRepo) RevokeAccessToken(userId, tokenId int) (err error) {
+	sql := "UPDATE personal_access_tokens SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+	res, err := repo.db.Exec(sql, tokenId, userId)
+	if err != nil {
+		return
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+func scanAccessToken(rows *sql.Rows, token *models.AccessToken) error {
+	var scopes string
+	err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return err
+	}
+	token.Scopes = strings.Fields(scopes)
+	return nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"strings"
+)
+
+type AccountRepository interface {
+	GetProfile(userId int) (profile models.Profile, err error)
+	UpdateProfile(userId int, update models.ProfileUpdate) (err error)
+	SetPendingEmail(userId int, email string) (err error)
+	ConfirmEmailChange(userId int) (err error)
+}
+
+type accountRepo struct {
+	db *sql.DB
+}
+
+func NewAccountRepository(db *sql.DB) AccountRepository {
+	return &accountRepo{
+		db: db,
+	}
+}
+
+// GetProfile loads the profile fields; the embedded user is left for the
+// caller to fill in.
+func (repo *accountRepo) GetProfile(userId int) (profile models.Profile, err error) {
+	sql := `
+        SELECT COALESCE(display_name, ''), COALESCE(avatar_url, ''), COALESCE(bio, ''), language,
+            COALESCE(pending_email, ''), created_at
+        FROM users
+        WHERE id = ?
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = ErrUserNotFound
+		return
+	}
+	err = rows.Scan(&profile.DisplayName, &profile.AvatarURL, &profile.Bio, &profile.Language, &profile.PendingEmail, &profile.CreatedAt)
+	return
+}
+
+// UpdateProfile writes the fields that are set. Empty strings are stored as
+// NULL. The email address is not changed here; see SetPendingEmail.
+func (repo *accountRepo) UpdateProfile(userId int, update models.ProfileUpdate) (err error) {
+	columns := []struct {
+		name  string
+		value *string
+	}{
+		{"display_name", update.DisplayName},
+		{"avatar_url", update.AvatarURL},
+		{"bio", update.Bio},
+		{"language", update.Language},
+	}
+
+	set := []string{}
+	args := []interface{}{}
+	for _, column := range columns {
+		if column.value == nil {
+			continue
+		}
+		set = append(set, column.name+" = NULLIF(?, '')")
+		args = append(args, *column.value)
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	sql := "UPDATE users SET " + strings.Join(set, ", ") + " WHERE id = ?"
+	args = append(args, userId)
+
+	_, err = repo.db.Exec(sql, args...)
+	return
+}
+
+func (repo *accountRepo) SetPendingEmail(userId int, email string) (err error) {
+	sql := "UPDATE users SET pending_email = ? WHERE id = ?"
+	_, err = repo.db.Exec(sql, email, userId)
+	return
+}
+
+// ConfirmEmailChange swaps in the pending address, which the link just
+// proved the user owns.
+func (repo *accountRepo) ConfirmEmailChange(userId int) (err error) {
+	sql := `
+        UPDATE users
+        SET email = pending_email, pending_email = NULL, email_verified_at = NOW()
+        WHERE id = ? AND pending_email IS NOT NULL
+    `
+	res, err := repo.db.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		return ErrEmailTokenNotFound
+	}
+	return nil
+}
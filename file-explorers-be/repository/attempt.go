@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"sync"
+	"time"
+)
+
+// AttemptRepository keeps the failed login counters. Failures older than the
+// window are forgotten, so the count starts again at one.
+type AttemptRepository interface {
+	GetAttempts(key string) (attempts models.LoginAttempts, err error)
+	RecordFailure(key string, now time.Time, window time.Duration) (attempts models.LoginAttempts, err error)
+	ClearAttempts(key string) (err error)
+}
+
+type attemptRepo struct {
+	db *sql.DB
+}
+
+// NewAttemptRepository stores the counters in MySQL so every instance
+// behind a load balancer sees the same ones.
+func NewAttemptRepository(db *sql.DB) AttemptRepository {
+	return &attemptRepo{
+		db: db,
+	}
+}
+
+func (repo *attemptRepo) GetAttempts(key string) (attempts models.LoginAttempts, err error) {
+	sql := "SELECT failures, last_failure_at FROM login_attempts WHERE attempt_key = ?"
+	rows, err := repo.db.Query(sql, key)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&attempts.Failures, &attempts.LastFailure)
+	}
+	return
+}
+
+func (repo *attemptRepo) RecordFailure(key string, now time.Time, window time.Duration) (attempts models.LoginAttempts, err error) {
+	// The failures column is assigned first, so it still compares against
+	// the previous failure.
+	sql := `
+        INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+        VALUES (?, 1, ?)
+        ON DUPLICATE KEY UPDATE
+            failures = IF(last_failure_at < ?, 1, failures + 1),
+            last_failure_at = VALUES(last_failure_at)
+    `
+	_, err = repo.db.Exec(sql, key, now, now.Add(-window))
+	if err != nil {
+		return
+	}
+
+	sql = "DELETE FROM login_attempts WHERE last_failure_at < ?"
+	_, err = repo.db.Exec(sql, now.Add(-window))
+	if err != nil {
+		return
+	}
+	return repo.GetAttempts(key)
+}
+
+func (repo *attemptRepo) ClearAttempts(key string) (err error) {
+	sql := "DELETE FROM login_attempts WHERE attempt_key = ?"
+	_, err = repo.db.Exec(sql, key)
+	return
+}
+
+type memoryAttemptRepo struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+	swept    time.Time
+}
+
+// NewMemoryAttemptRepository keeps the counters in the process. They are
+// lost on restart and not shared, which is fine for a single instance.
+func NewMemoryAttemptRepository() AttemptRepository {
+	return &memoryAttemptRepo{
+		attempts: map[string]models.LoginAttempts{},
+	}
+}
+
+func (repo *memoryAttemptRepo) GetAttempts(key string) (attempts models.LoginAttempts, err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return repo.attempts[key], nil
+}
+
+func (repo *memoryAttemptRepo) RecordFailure(key string, now time.Time, window time.Duration) (attempts models.LoginAttempts, err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if now.Sub(repo.swept) > time.Minute {
+		for k, a := range repo.attempts {
+			if a.LastFailure.Before(now.Add(-window)) {
+				delete(repo.attempts, k)
+			}
+		}
+		repo.swept = now
+	}
+
+	attempts = repo.attempts[key]
+	if attempts.LastFailure.Before(now.Add(-window)) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	repo.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (repo *memoryAttemptRepo) ClearAttempts(key string) (err error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.attempts, key)
+	return nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-explorers-be/models"
+	"strings"
+)
+
+type AuditRepository interface {
+	AppendAudit(entry models.AuditEntry) (err error)
+	SearchAudit(filter models.AuditFilter, limit, offset int) (entries []models.AuditEntry, err error)
+	CountAudit(filter models.AuditFilter) (count int, err error)
+	PurgeAuditIPs(days int) (purged int64, err error)
+}
+
+type auditRepo struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepo{
+		db: db,
+	}
+}
+
+// AppendAudit adds an entry. The log only accepts inserts; the address goes
+// to its own table, which can be purged.
+func (repo *auditRepo) AppendAudit(entry models.AuditEntry) (err error) {
+	var details []byte
+	if len(entry.Details) > 0 {
+		details, err = json.Marshal(entry.Details)
+		if err != nil {
+			return
+		}
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := `
+        INSERT INTO audit_log (actor_id, action, target_type, target_id, details)
+        VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)
+    `
+	res, err := tx.Exec(sql, entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, details)
+	if err != nil {
+		return
+	}
+	if entry.IP != "" {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		sql = "INSERT INTO audit_log_ips (audit_id, ip) VALUES (?, ?)"
+		_, err = tx.Exec(sql, id, entry.IP)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SearchAudit returns matching entries, newest first, with the actor's
+// current username.
+func (repo *auditRepo) SearchAudit(filter models.AuditFilter, limit, offset int) (entries []models.AuditEntry, err error) {
+	where, args := auditWhere(filter)
+	sql := `
+        SELECT a.id, a.created_at, a.actor_id, COALESCE(u.username, ''), a.action, COALESCE(a.target_type, ''),
+            COALESCE(a.target_id, ''), COALESCE(i.ip, ''), a.details
+        FROM audit_log a
+        LEFT JOIN audit_log_ips i ON i.audit_id = a.id
+        LEFT JOIN users u ON u.id = a.actor_id
+        ` + where + `
+        ORDER BY a.id DESC
+        LIMIT ? OFFSET ?
+    `
+	rows, err := repo.db.Query(sql, append(args, limit, offset)...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	entries = []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var details []byte
+		err = rows.Scan(&entry.ID, &entry.CreatedAt, &entry.ActorID, &entry.ActorName, &entry.Action, &entry.TargetType,
+			&entry.TargetID, &entry.IP, &details)
+		if err != nil {
+			return
+		}
+		if len(details) > 0 {
+			err = json.Unmarshal(details, &entry.Details)
+			if err != nil {
+				return
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (repo *auditRepo) CountAudit(filter models.AuditFilter) (count int, err error) {
+	where, args := auditWhere(filter)
+	sql := "SELECT COUNT(*) FROM audit_log a LEFT JOIN audit_log_ips i ON i.audit_id = a.id " + where
+	rows, err := repo.db.Query(sql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	err = rows.Scan(&count)
+	return
+}
+
+// PurgeAuditIPs deletes the addresses of entries older than the given
+// number of days. The entries themselves stay.
+func (repo *auditRepo) PurgeAuditIPs(days int) (purged int64, err error) {
+	sql := "DELETE FROM audit_log_ips WHERE created_at < NOW() - INTERVAL ? DAY"
+	res, err := repo.db.Exec(sql, days)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+func auditWhere(filter models.AuditFilter) (where string, args []interface{}) {
+	var conditions []string
+	if filter.ActorID != nil {
+		conditions = append(conditions, "a.actor_id = ?")
+		args = append(args, *filter.ActorID)
+	}
+	if strings.HasSuffix(filter.Action, ".") {
+		conditions = append(conditions, "a.action LIKE ?")
+		args = append(args, filter.Action+"%")
+	} else if filter.Action != "" {
+		conditions = append(conditions, "a.action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "a.target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "a.target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.IP != "" {
+		conditions = append(conditions, "i.ip = ?")
+		args = append(args, filter.IP)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "a.created_at >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "a.created_at < ?")
+		args = append(args, *filter.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -3,14 +3,33 @@ package repository
 import (
 	"database/sql"
 	"file-explorers-be/models"
+	"fmt"
 )
 
 type AuthRepository interface {
 	Authenticate(username string) (data models.User, err error)
 	Register(username, email, password string) (data models.User, err error)
 	PasswordChange(username, password string) (err error)
+	GetUser(id int) (data models.User, err error)
+	GetUserByEmail(email string) (data models.User, err error)
+	MarkEmailVerified(userId int) (err error)
+	PurgeUnverified(days int) (purged int64, err error)
+	CreateGuest(username string) (data models.User, err error)
+	UpgradeGuest(userId int, username, email, password string) (err error)
+	MergeGuest(guestId, userId int) (err error)
+	PurgeGuests(days int) (purged int64, err error)
+	TouchUser(userId int) (err error)
+	CancelDeletion(userId int) (err error)
 }
 
+var (
+	ErrUserNotFound = fmt.Errorf("user not found")
+	ErrNotGuest     = fmt.Errorf("user is not a guest")
+)
+
+// userColumns is scanned by scanUser.
+const userColumns = "id, username, COALESCE(email, ''), password_hash, token_version, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, is_guest, deletion_requested_at"
+
 type authRepo struct {
 	db *sql.DB
 }
@@ -20,7 +39,7 @@ func NewAuthRepository(db *sql.DB) AuthRepository {
 }
 
 func (repo *authRepo) Authenticate(username string) (data models.User, err error) {
-	sql := "SELECT id, username, email, password_hash FROM users WHERE username=?"
+	sql := "SELECT " + userColumns + " FROM users WHERE username=?"
 	rows, err := repo.db.Query(sql, username)
 	if err != nil {
 		return
@@ -28,12 +47,7 @@ func (repo *authRepo) Authenticate(username string) (data models.User, err error
 	defer rows.Close()
 	if rows.Next() {
 		data = models.User{}
-		err = rows.Scan(
-			&data.ID,
-			&data.Username,
-			&data.Email,
-			&data.Password,
-		)
+		err = scanUser(rows, &data)
 	}
 	return
 }
@@ -50,7 +64,182 @@ func (repo *authRepo) Register(username, email, password string) (data models.Us
 }
 
 func (repo *authRepo) PasswordChange(username, password string) (err error) {
-	sql := "UPDATE users SET password_hash=$1 WHERE username=$2"
+	sql := "UPDATE users SET password_hash=? WHERE username=?"
 	_, err = repo.db.Exec(sql, password, username)
 	return
 }
+
+func (repo *authRepo) GetUser(id int) (data models.User, err error) {
+	return repo.getUser("id=?", id)
+}
+
+func (repo *authRepo) GetUserByEmail(email string) (data models.User, err error) {
+	return repo.getUser("email=?", email)
+}
+
+func (repo *authRepo) getUser(where string, arg interface{}) (data models.User, err error) {
+	sql := "SELECT " + userColumns + " FROM users WHERE " + where
+	rows, err := repo.db.Query(sql, arg)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = ErrUserNotFound
+		return
+	}
+	err = scanUser(rows, &data)
+	return
+}
+
+func (repo *authRepo) MarkEmailVerified(userId int) (err error) {
+	sql := "UPDATE users SET email_verified_at=NOW() WHERE id=? AND email_verified_at IS NULL"
+	_, err = repo.db.Exec(sql, userId)
+	return
+}
+
+// PurgeUnverified deletes accounts that never verified their email within
+// the given number of days. Everything they own goes with them.
+func (repo *authRepo) PurgeUnverified(days int) (purged int64, err error) {
+	sql := "DELETE FROM users WHERE email_verified_at IS NULL AND is_guest = FALSE AND created_at < NOW() - INTERVAL ? DAY"
+	res, err := repo.db.Exec(sql, days)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+func (repo *authRepo) CreateGuest(username string) (data models.User, err error) {
+	sql := "INSERT INTO users (username, password_hash, is_guest) VALUES (?, '', TRUE)"
+	_, err = repo.db.Exec(sql, username)
+	if err != nil {
+		return
+	}
+	return repo.Authenticate(username)
+}
+
+// UpgradeGuest gives a guest the username, email and password of a full
+// account. Everything the guest played stays where it is.
+func (repo *authRepo) UpgradeGuest(userId int, username, email, password string) (err error) {
+	sql := "UPDATE users SET username = ?, email = ?, password_hash = ?, is_guest = FALSE WHERE id = ? AND is_guest = TRUE"
+	res, err := repo.db.Exec(sql, username, email, password, userId)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		return ErrNotGuest
+	}
+	return nil
+}
+
+// MergeGuest moves a guest's progress to an existing account and deletes
+// the guest. Levels and challenges the guest finished but the account did
+// not are taken over; where both have progress the account's is kept.
+func (repo *authRepo) MergeGuest(guestId, userId int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "SELECT 1 FROM users WHERE id = ? AND is_guest = TRUE FOR UPDATE"
+	rows, err := tx.Query(sql, guestId)
+	if err != nil {
+		return
+	}
+	found := rows.Next()
+	rows.Close()
+	if !found {
+		return ErrNotGuest
+	}
+
+	moves := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`UPDATE user_levels t
+            JOIN user_levels g ON g.level_id = t.level_id AND g.user_id = ?
+            SET t.solved_at = g.solved_at, t.started_at = g.started_at, t.command_count = g.command_count,
+                t.keystrokes = g.keystrokes, t.score = g.score, t.gate_count = g.gate_count, t.gate_depth = g.gate_depth
+            WHERE t.user_id = ? AND t.solved_at IS NULL AND g.solved_at IS NOT NULL`, []interface{}{guestId, userId}},
+		{"UPDATE IGNORE user_levels SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+		{`UPDATE user_circuit_challenges t
+            JOIN user_circuit_challenges g ON g.challenge_id = t.challenge_id AND g.user_id = ?
+            SET t.completed_at = g.completed_at, t.points = g.points, t.circuit = g.circuit
+            WHERE t.user_id = ? AND t.completed_at IS NULL AND g.completed_at IS NOT NULL`, []interface{}{guestId, userId}},
+		{"UPDATE IGNORE user_circuit_challenges SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+		{"UPDATE IGNORE user_level_terminals SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+		{"UPDATE terminal_commands SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+		{"UPDATE workspaces SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+	}
+	for _, move := range moves {
+		_, err = tx.Exec(move.sql, move.args...)
+		if err != nil {
+			return
+		}
+	}
+
+	sql = "DELETE FROM users WHERE id = ?"
+	_, err = tx.Exec(sql, guestId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// PurgeGuests deletes guests that have not been seen for the given number
+// of days, with everything they played.
+func (repo *authRepo) PurgeGuests(days int) (purged int64, err error) {
+	sql := "DELETE FROM users WHERE is_guest = TRUE AND COALESCE(last_seen_at, created_at) < NOW() - INTERVAL ? DAY"
+	res, err := repo.db.Exec(sql, days)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+func (repo *authRepo) TouchUser(userId int) (err error) {
+	sql := "UPDATE users SET last_seen_at = NOW() WHERE id = ?"
+	_, err = repo.db.Exec(sql, userId)
+	return
+}
+
+// CancelDeletion keeps an account whose owner asked for it to be deleted,
+// and closes the pending erasure request.
+func (repo *authRepo) CancelDeletion(userId int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE users SET deletion_requested_at = NULL WHERE id = ?"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+	sql = "UPDATE erasure_requests SET cancelled_at = NOW() WHERE user_id = ? AND completed_at IS NULL AND cancelled_at IS NULL"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+func scanUser(rows *sql.Rows, data *models.User) error {
+	return rows.Scan(
+		&data.ID,
+		&data.Username,
+		&data.Email,
+		&data.Password,
+		&data.TokenVersion,
+		&data.EmailVerified,
+		&data.TwoFactorEnabled,
+		&data.Guest,
+		&data.DeletionRequestedAt,
+	)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+type CircuitRepository interface {
+	GetChallenges(userId int) (challenges []models.CircuitChallenge, err error)
+	GetChallenge(userId, challengeId int) (challenge models.CircuitChallenge, err error)
+	CompleteChallenge(userId, challengeId int, circuit interface{}) (err error)
+}
+
+type circuitRepo struct {
+	db *sql.DB
+}
+
+func NewCircuitRepository(db *sql.DB) CircuitRepository {
+	return &circuitRepo{
+		db: db,
+	}
+}
+
+const circuitChallengeColumns = `
+        c.challenge_id, c.position, c.name, c.description, c.definition, c.targets, c.tolerance, c.points,
+        ucc.completed_at, COALESCE(ucc.points, 0)
+    `
+
+func (repo *circuitRepo) GetChallenges(userId int) (challenges []models.CircuitChallenge, err error) {
+	sql := `
+        SELECT` + circuitChallengeColumns + `
+        FROM circuit_challenges c
+        LEFT JOIN user_circuit_challenges ucc ON c.challenge_id = ucc.challenge_id AND ucc.user_id = ?
+        ORDER BY c.position, c.challenge_id
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var challenge models.CircuitChallenge
+		challenge, err = scanCircuitChallenge(rows)
+		if err != nil {
+			return
+		}
+		challenges = append(challenges, challenge)
+	}
+	return
+}
+
+func (repo *circuitRepo) GetChallenge(userId, challengeId int) (challenge models.CircuitChallenge, err error) {
+	sql := `
+        SELECT` + circuitChallengeColumns + `
+        FROM circuit_challenges c
+        LEFT JOIN user_circuit_challenges ucc ON c.challenge_id = ucc.challenge_id AND ucc.user_id = ?
+        WHERE c.challenge_id = ?
+    `
+	rows, err := repo.db.Query(sql, userId, challengeId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = fmt.Errorf("circuit challenge not found")
+		return
+	}
+	return scanCircuitChallenge(rows)
+}
+
+// CompleteChallenge records a completed challenge together with the circuit
+// that solved it. Points are only awarded the first time.
+func (repo *circuitRepo) CompleteChallenge(userId, challengeId int, circuit interface{}) (err error) {
+	circuitJSON, err := json.Marshal(circuit)
+	if err != nil {
+		return
+	}
+
+	sql := `
+        INSERT INTO user_circuit_challenges (user_id, challenge_id, completed_at, points, circuit)
+        SELECT ?, challenge_id, NOW(), points, ? FROM circuit_challenges WHERE challenge_id = ?
+        ON DUPLICATE KEY UPDATE
+            points = IF(completed_at IS NULL, VALUES(points), points),
+            completed_at = COALESCE(completed_at, NOW()),
+            circuit = VALUES(circuit)
+    `
+	_, err = repo.db.Exec(sql, userId, circuitJSON, challengeId)
+	return
+}
+
+func scanCircuitChallenge(rows *sql.Rows) (challenge models.CircuitChallenge, err error) {
+	var description sql.NullString
+	var definition []byte
+	var targets []byte
+
+	err = rows.Scan(
+		&challenge.ChallengeID,
+		&challenge.Position,
+		&challenge.Name,
+		&description,
+		&definition,
+		&targets,
+		&challenge.Tolerance,
+		&challenge.Points,
+		&challenge.CompletedAt,
+		&challenge.PointsEarned,
+	)
+	if err != nil {
+		return
+	}
+
+	challenge.Description = description.String
+	challenge.Completed = challenge.CompletedAt != nil
+	if len(definition) > 0 {
+		err = json.Unmarshal(definition, &challenge.Definition)
+		if err != nil {
+			return
+		}
+	}
+	err = json.Unmarshal(targets, &challenge.Targets)
+	return
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+var (
+	ErrIdentityNotFound  = fmt.Errorf("identity not found")
+	ErrOIDCStateNotFound = fmt.Errorf("login session not found")
+)
+
+type IdentityRepository interface {
+	CreateState(state models.OIDCState) (err error)
+	TakeState(state string) (data models.OIDCState, err error)
+	GetIdentity(provider, subject string) (identity models.Identity, err error)
+	ListIdentities(userId int) (identities []models.Identity, err error)
+	LinkIdentity(userId int, provider, subject, email string) (err error)
+	UnlinkIdentity(userId int, provider string) (err error)
+}
+
+type identityRepo struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepo{
+		db: db,
+	}
+}
+
+func (repo *identityRepo) CreateState(state models.OIDCState) (err error) {
+	sql := `
+        INSERT INTO oidc_states (state, provider, nonce, code_verifier, user_id, redirect, subject, email, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err = repo.db.Exec(sql, state.State, state.Provider, state.Nonce, state.Verifier, state.UserID, state.Redirect,
+		state.Subject, state.Email, state.ExpiresAt)
+	if err != nil {
+		return
+	}
+
+	// Logins that were abandoned at the provider are never taken.
+	sql = "DELETE FROM oidc_states WHERE expires_at < NOW()"
+	_, err = repo.db.Exec(sql)
+	return
+}
+
+// TakeState returns a pending login and deletes it, so a callback can only
+// be completed once.
+func (repo *identityRepo) TakeState(state string) (data models.OIDCState, err error) {
+	sql := `
+        SELECT state, provider, nonce, code_verifier, user_id, redirect, subject, email, expires_at
+        FROM oidc_states
+        WHERE state = ?
+    `
+	rows, err := repo.db.Query(sql, state)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = ErrOIDCStateNotFound
+		return
+	}
+	err = rows.Scan(&data.State, &data.Provider, &data.Nonce, &data.Verifier, &data.UserID, &data.Redirect,
+		&data.Subject, &data.Email, &data.ExpiresAt)
+	if err != nil {
+		return
+	}
+	rows.Close()
+
+	sql = "DELETE FROM oidc_states WHERE state = ?"
+	res, err := repo.db.Exec(sql, state)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrOIDCStateNotFound
+	}
+	return
+}
+
+func (repo *identityRepo) GetIdentity(provider, subject string) (identity models.Identity, err error) {
+	sql := `
+        SELECT user_id, provider, subject, email, created_at
+        FROM user_identities
+        WHERE provider = ? AND subject = ?
+    `
+	rows, err := repo.db.Query(sql, provider, subject)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = ErrIdentityNotFound
+		return
+	}
+	err = rows.Scan(&identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	return
+}
+
+func (repo *identityRepo) ListIdentities(userId int) (identities []models.Identity, err error) {
+	sql := `
+        SELECT user_id, provider, subject, email, created_at
+        FROM user_identities
+        WHERE user_id = ?
+        ORDER BY provider
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	identities = []models.Identity{}
+	for rows.Next() {
+		var identity models.Identity
+		err = rows.Scan(&identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return
+		}
+		identities = append(identities, identity)
+	}
+	return
+}
+
+func (repo *identityRepo) LinkIdentity(userId int, provider, subject, email string) (err error) {
+	var address *string
+	if email != "" {
+		address = &email
+	}
+
+	sql := "INSERT INTO user_identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)"
+	_, err = repo.db.Exec(sql, userId, provider, subject, address)
+	return
+}
+
+func (repo *identityRepo) UnlinkIdentity(userId int, provider string) (err error) {
+	sql := "DELETE FROM user_identities WHERE user_id = ? AND provider = ?"
+	res, err := repo.db.Exec(sql, userId, provider)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrIdentityNotFound
+	}
+	return
+}
@@ -8,12 +8,19 @@ import (
 	"log"
 )
 
+var ErrLevelNotFound = fmt.Errorf("level not found")
+
 type LevelRepository interface {
 	GetLevelsWithSolved(userId int) (levels []models.LevelStatus, err error)
 	GetLevelData(level int) (data models.LevelData, err error)
 	StartedLevel(userId, level int) (err error)
 	MarkLevelSolved(userId, level int) (err error)
+	RecordTerminalSolve(userId, level, commands, keystrokes, score int) (err error)
+	RecordBooleanSolve(userId, level, gateCount, depth int) (err error)
+	IsLevelSolved(userId, level int) (solved bool, err error)
 	GetLeaderboard(timeFilter string) (leaderboard []models.LeaderboardEntry, err error)
+	CreateLevel(data models.LevelData) (id int, err error)
+	UpdateLevel(data models.LevelData) (err error)
 }
 
 type levelRepo struct {
@@ -30,7 +37,7 @@ func (repo *levelRepo) GetLevelsWithSolved(userId int) (levels []models.LevelSta
 	sql := `
         SELECT l.level_Id, 
                CASE WHEN ul.level_id IS NOT NULL THEN TRUE ELSE FALSE END AS solved, 
-			   l.name, l.difficulty
+			   l.name, l.difficulty, l.level_type, ul.score, ul.gate_count, ul.gate_depth
         FROM levels l
         LEFT JOIN user_levels ul ON l.level_Id = ul.level_id AND ul.user_id = ?
     `
@@ -47,6 +54,10 @@ func (repo *levelRepo) GetLevelsWithSolved(userId int) (levels []models.LevelSta
 			&ls.Solved,
 			&ls.Name,
 			&ls.Difficulty,
+			&ls.Type,
+			&ls.Score,
+			&ls.GateCount,
+			&ls.GateDepth,
 		)
 		if err != nil {
 			return
@@ -61,7 +72,7 @@ func (repo *levelRepo) GetLevelData(level int) (data models.LevelData, err error
 	
 	// NOTE: database schema defines the solution column as `level_solution`.
 	// Use that column name to avoid "Unknown column 'solution'" errors.
-	sql := "SELECT level_id, starting_file_system, level_solution, name, description, difficulty, instructions  FROM levels WHERE level_id=?"
+	sql := "SELECT level_id, level_type, starting_file_system, level_solution, name, description, difficulty, instructions  FROM levels WHERE level_id=?"
 	rows, err := repo.db.Query(sql, level)
 	if err != nil {
 		log.Println("[DEBUG levelRepo.GetLevelData] Database query error:", err)
@@ -75,6 +86,7 @@ func (repo *levelRepo) GetLevelData(level int) (data models.LevelData, err error
 	if rows.Next() {
 		err = rows.Scan(
 			&data.LevelID,
+			&data.Type,
 			&startingFileSystem,
 			&solution,
 			&data.Name,
@@ -84,7 +96,7 @@ func (repo *levelRepo) GetLevelData(level int) (data models.LevelData, err error
 		)
 		log.Println("[DEBUG levelRepo.GetLevelData] Row scanned successfully, level:", data.LevelID)
 	} else {
-		err = fmt.Errorf("level not found")
+		err = ErrLevelNotFound
 		log.Println("[DEBUG levelRepo.GetLevelData] Level not found in database")
 	}
 
@@ -110,29 +122,78 @@ func (repo *levelRepo) GetLevelData(level int) (data models.LevelData, err error
 }
 
 func (repo *levelRepo) StartedLevel(userId, level int) (err error) {
-	sql := "INSERT INTO user_levels (user_id, level_id) VALUES (?, ?)"
+	sql := "INSERT IGNORE INTO user_levels (user_id, level_id) VALUES (?, ?)"
 	_, err = repo.db.Exec(sql, userId, level)
 	return
 }
 
+// MarkLevelSolved records when the level was first solved. Solving it again
+// keeps the original time, which the leaderboard filters rely on.
 func (repo *levelRepo) MarkLevelSolved(userId, level int) (err error) {
-	sql := "UPDATE user_levels SET solved_at = NOW() WHERE user_id = ? AND level_id = ?"
+	sql := "UPDATE user_levels SET solved_at = COALESCE(solved_at, NOW()) WHERE user_id = ? AND level_id = ?"
 	_, err = repo.db.Exec(sql, userId, level)
 	return
 }
 
+// RecordTerminalSolve marks a level solved from a replayed terminal transcript
+// and keeps the user's best score along with the command and keystroke counts
+// that earned it.
+func (repo *levelRepo) RecordTerminalSolve(userId, level, commands, keystrokes, score int) (err error) {
+	sql := `
+        INSERT INTO user_levels (user_id, level_id, solved_at, command_count, keystrokes, score)
+        VALUES (?, ?, NOW(), ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            solved_at = COALESCE(solved_at, NOW()),
+            command_count = IF(VALUES(score) > COALESCE(score, -1), VALUES(command_count), command_count),
+            keystrokes = IF(VALUES(score) > COALESCE(score, -1), VALUES(keystrokes), keystrokes),
+            score = GREATEST(COALESCE(score, -1), VALUES(score))
+    `
+	_, err = repo.db.Exec(sql, userId, level, commands, keystrokes, score)
+	return
+}
+
+// RecordBooleanSolve marks a boolean level solved and keeps the user's best
+// circuit: fewest gates first, then the shallowest.
+func (repo *levelRepo) RecordBooleanSolve(userId, level, gateCount, depth int) (err error) {
+	sql := `
+        INSERT INTO user_levels (user_id, level_id, solved_at, gate_count, gate_depth)
+        VALUES (?, ?, NOW(), ?, ?)
+        ON DUPLICATE KEY UPDATE
+            solved_at = COALESCE(solved_at, NOW()),
+            gate_depth = IF(gate_count IS NULL OR VALUES(gate_count) < gate_count
+                OR (VALUES(gate_count) = gate_count AND VALUES(gate_depth) < gate_depth), VALUES(gate_depth), gate_depth),
+            gate_count = LEAST(COALESCE(gate_count, VALUES(gate_count)), VALUES(gate_count))
+    `
+	_, err = repo.db.Exec(sql, userId, level, gateCount, depth)
+	return
+}
+
+func (repo *levelRepo) IsLevelSolved(userId, level int) (solved bool, err error) {
+	sql := "SELECT 1 FROM user_levels WHERE user_id = ? AND level_id = ? AND solved_at IS NOT NULL"
+	rows, err := repo.db.Query(sql, userId, level)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
 func (repo *levelRepo) GetLeaderboard(timeFilter string) (leaderboard []models.LeaderboardEntry, err error) {
 	// Build the time filter condition based on timeFilter
 	timeCondition := "1=1"
+	circuitCondition := "1=1"
 	switch timeFilter {
 	case "week":
 		timeCondition = "ul.solved_at >= DATE_SUB(NOW(), INTERVAL 7 DAY)"
+		circuitCondition = "ucc.completed_at >= DATE_SUB(NOW(), INTERVAL 7 DAY)"
 	case "month":
 		timeCondition = "ul.solved_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)"
+		circuitCondition = "ucc.completed_at >= DATE_SUB(NOW(), INTERVAL 30 DAY)"
 	case "all":
 		fallthrough
 	default:
 		timeCondition = "1=1" // No filter for all time
+		circuitCondition = "1=1"
 	}
 
 	sql := fmt.Sprintf(`
@@ -145,13 +206,19 @@ func (repo *levelRepo) GetLeaderboard(timeFilter string) (leaderboard []models.L
                     THEN TIMESTAMPDIFF(SECOND, ul.started_at, ul.solved_at)
                     ELSE 0
                 END
-            ), 0) AS total_time
+            ), 0) AS total_time,
+            COALESCE((
+                SELECT SUM(ucc.points)
+                FROM user_circuit_challenges ucc
+                WHERE ucc.user_id = u.id AND ucc.completed_at IS NOT NULL AND (%s)
+            ), 0) AS circuit_points
         FROM users u
         LEFT JOIN user_levels ul ON u.id = ul.user_id
+        WHERE u.is_guest = FALSE AND u.deletion_requested_at IS NULL
         GROUP BY u.id, u.username
         HAVING levels_solved >= 0
-        ORDER BY levels_solved DESC, total_time ASC
-    `, timeCondition, timeCondition)
+        ORDER BY levels_solved DESC, circuit_points DESC, total_time ASC
+    `, timeCondition, timeCondition, circuitCondition)
 
 	rows, err := repo.db.Query(sql)
 	if err != nil {
@@ -161,7 +228,7 @@ func (repo *levelRepo) GetLeaderboard(timeFilter string) (leaderboard []models.L
 
 	for rows.Next() {
 		var entry models.LeaderboardEntry
-		err = rows.Scan(&entry.Username, &entry.LevelsSolved, &entry.TotalTime)
+		err = rows.Scan(&entry.Username, &entry.LevelsSolved, &entry.TotalTime, &entry.CircuitPoints)
 		if err != nil {
 			return
 		}
@@ -169,3 +236,71 @@ func (repo *levelRepo) GetLeaderboard(timeFilter string) (leaderboard []models.L
 	}
 	return
 }
+
+func (repo *levelRepo) CreateLevel(data models.LevelData) (id int, err error) {
+	startingFileSystem, err := json.Marshal(data.StartingFileSystem)
+	if err != nil {
+		return
+	}
+	solution, err := json.Marshal(data.Solution)
+	if err != nil {
+		return
+	}
+
+	sql := `
+        INSERT INTO levels (level_type, starting_file_system, level_solution, name, description, difficulty, instructions)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+	res, err := repo.db.Exec(sql, data.Type, startingFileSystem, solution, data.Name, data.Description, data.Difficulty,
+		data.Instructions)
+	if err != nil {
+		return
+	}
+	lastId, err := res.LastInsertId()
+	return int(lastId), err
+}
+
+// UpdateLevel replaces every field of an existing level. Progress on the
+// level is kept.
+func (repo *levelRepo) UpdateLevel(data models.LevelData) (err error) {
+	startingFileSystem, err := json.Marshal(data.StartingFileSystem)
+	if err != nil {
+		return
+	}
+	solution, err := json.Marshal(data.Solution)
+	if err != nil {
+		return
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// Rows that are updated to the same values count as unaffected, so the
+	// level is looked up first.
+	sql := "SELECT level_Id FROM levels WHERE level_Id = ? FOR UPDATE"
+	rows, err := tx.Query(sql, data.LevelID)
+	if err != nil {
+		return
+	}
+	found := rows.Next()
+	rows.Close()
+	if !found {
+		return ErrLevelNotFound
+	}
+
+	sql = `
+        UPDATE levels
+        SET level_type = ?, starting_file_system = ?, level_solution = ?, name = ?, description = ?,
+            difficulty = ?, instructions = ?
+        WHERE level_Id = ?
+    `
+	_, err = tx.Exec(sql, data.Type, startingFileSystem, solution, data.Name, data.Description, data.Difficulty,
+		data.Instructions, data.LevelID)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-explorers-be/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type PrivacyRepository interface {
+	Export(userId int) (export models.DataExport, err error)
+	RequestErasure(userId int, eraseAfter time.Time) (err error)
+	ListErasureRequests(status string) (requests []models.ErasureRequest, err error)
+	DueErasures() (ids []int, err error)
+	Erase(requestId int, username string, completedBy *int) (summary map[string]int64, err error)
+}
+
+var ErrErasureRequestNotFound = fmt.Errorf("erasure request not found")
+
+// exportSections lists what a data export contains. Each query takes the
+// user id once per placeholder.
+var exportSections = []struct {
+	name string
+	sql  string
+}{
+	{"account", `
+        SELECT id, username, email, display_name, avatar_url, bio, language, pending_email,
+            email_verified_at, totp_enabled_at IS NOT NULL AS two_factor_enabled, is_guest,
+            last_seen_at, deletion_requested_at, created_at
+        FROM users WHERE id = ?`},
+	{"roles", `
+        SELECT r.name AS role, ur.granted_at
+        FROM user_roles ur JOIN roles r ON r.role_id = ur.role_id
+        WHERE ur.user_id = ?`},
+	{"identities", "SELECT provider, subject, email, created_at FROM user_identities WHERE user_id = ?"},
+	{"sessions", "SELECT user_agent, ip, created_at, last_seen_at, revoked_at FROM sessions WHERE user_id = ? ORDER BY created_at"},
+	{"access_tokens", "SELECT name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at FROM personal_access_tokens WHERE user_id = ?"},
+	{"levels", `
+        SELECT ul.level_id, l.name AS level_name, ul.started_at, ul.solved_at, ul.command_count,
+            ul.keystrokes, ul.score, ul.gate_count, ul.gate_depth
+        FROM user_levels ul JOIN levels l ON l.level_id = ul.level_id
+        WHERE ul.user_id = ? ORDER BY ul.started_at`},
+	{"terminal_commands", `
+        SELECT level_id, command, output, error, cwd, replayed, created_at
+        FROM terminal_commands WHERE user_id = ? ORDER BY id`},
+	{"terminal_state", "SELECT level_id, file_system, open_folder, updated_at FROM user_level_terminals WHERE user_id = ?"},
+	{"circuit_challenges", `
+        SELECT uc.challenge_id, c.name AS challenge_name, uc.completed_at, uc.points, uc.circuit
+        FROM user_circuit_challenges uc JOIN circuit_challenges c ON c.challenge_id = uc.challenge_id
+        WHERE uc.user_id = ?`},
+	{"workspaces", `
+        SELECT workspace_id, name, kind, current_version, share_token IS NOT NULL AS shared, created_at, updated_at
+        FROM workspaces WHERE user_id = ? ORDER BY workspace_id`},
+	{"workspace_versions", `
+        SELECT v.workspace_id, v.version, v.content, v.created_at
+        FROM workspace_versions v JOIN workspaces w ON w.workspace_id = v.workspace_id
+        WHERE w.user_id = ? ORDER BY v.workspace_id, v.version`},
+	{"erasure_requests", "SELECT requested_at, erase_after, cancelled_at, completed_at FROM erasure_requests WHERE user_id = ?"},
+}
+
+type privacyRepo struct {
+	db *sql.DB
+}
+
+func NewPrivacyRepository(db *sql.DB) PrivacyRepository {
+	return &privacyRepo{
+		db: db,
+	}
+}
+
+// Export collects every record tied to the user.
+func (repo *privacyRepo) Export(userId int) (export models.DataExport, err error) {
+	export = models.DataExport{}
+	for _, section := range exportSections {
+		records, err := repo.records(section.sql, userId)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", section.name, err)
+		}
+		export[section.name] = records
+	}
+	if len(export["account"]) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return export, nil
+}
+
+// RequestErasure marks the account for erasure once eraseAfter has passed.
+// A request that is already pending is left as it is.
+func (repo *privacyRepo) RequestErasure(userId int, eraseAfter time.Time) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE users SET deletion_requested_at = NOW() WHERE id = ? AND deletion_requested_at IS NULL AND erased_at IS NULL"
+	res, err := tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return
+	}
+
+	sql = "INSERT INTO erasure_requests (user_id, erase_after) VALUES (?, ?)"
+	_, err = tx.Exec(sql, userId, eraseAfter)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+func (repo *privacyRepo) ListErasureRequests(status string) (requests []models.ErasureRequest, err error) {
+	var where, order string
+	switch status {
+	case models.ErasurePending:
+		where, order = "r.completed_at IS NULL AND r.cancelled_at IS NULL", "r.erase_after"
+	case models.ErasureCancelled:
+		where, order = "r.cancelled_at IS NOT NULL", "r.cancelled_at DESC"
+	case models.ErasureCompleted:
+		where, order = "r.completed_at IS NOT NULL", "r.completed_at DESC"
+	default:
+		return nil, fmt.Errorf("unknown erasure status %q", status)
+	}
+
+	sql := `
+        SELECT r.id, r.user_id, u.username, r.requested_at, r.erase_after, r.cancelled_at,
+            r.completed_at, r.completed_by, r.summary
+        FROM erasure_requests r
+        JOIN users u ON u.id = r.user_id
+        WHERE ` + where + `
+        ORDER BY ` + order
+	rows, err := repo.db.Query(sql)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	requests = []models.ErasureRequest{}
+	for rows.Next() {
+		var request models.ErasureRequest
+		var summary []byte
+		err = rows.Scan(&request.ID, &request.UserID, &request.Username, &request.RequestedAt, &request.EraseAfter,
+			&request.CancelledAt, &request.CompletedAt, &request.CompletedBy, &summary)
+		if err != nil {
+			return
+		}
+		if len(summary) > 0 {
+			err = json.Unmarshal(summary, &request.Summary)
+			if err != nil {
+				return
+			}
+		}
+		request.Status = status
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+func (repo *privacyRepo) DueErasures() (ids []int, err error) {
+	sql := "SELECT id FROM erasure_requests WHERE completed_at IS NULL AND cancelled_at IS NULL AND erase_after <= NOW()"
+	rows, err := repo.db.Query(sql)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Erase carries out a pending request. Everything the user wrote or that
+// identifies them is deleted, and the account is renamed to the given
+// anonymous username. Level results and challenge points stay, so the
+// leaderboard and level statistics keep their totals.
+func (repo *privacyRepo) Erase(requestId int, username string, completedBy *int) (summary map[string]int64, err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := `
+        SELECT r.user_id, u.username
+        FROM erasure_requests r
+        JOIN users u ON u.id = r.user_id
+        WHERE r.id = ? AND r.completed_at IS NULL AND r.cancelled_at IS NULL
+        FOR UPDATE
+    `
+	rows, err := tx.Query(sql, requestId)
+	if err != nil {
+		return
+	}
+	var userId int
+	var oldUsername string
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&userId, &oldUsername)
+	}
+	rows.Close()
+	if err != nil {
+		return
+	}
+	if !found {
+		return nil, ErrErasureRequestNotFound
+	}
+
+	removals := []struct {
+		name string
+		sql  string
+		arg  interface{}
+	}{
+		{"terminal_commands", "DELETE FROM terminal_commands WHERE user_id = ?", userId},
+		{"terminal_state", "DELETE FROM user_level_terminals WHERE user_id = ?", userId},
+		{"workspaces", "DELETE FROM workspaces WHERE user_id = ?", userId},
+		{"circuit_designs", "UPDATE user_circuit_challenges SET circuit = NULL WHERE user_id = ? AND circuit IS NOT NULL", userId},
+		{"identities", "DELETE FROM user_identities WHERE user_id = ?", userId},
+		{"oidc_states", "DELETE FROM oidc_states WHERE user_id = ?", userId},
+		{"refresh_tokens", "DELETE FROM refresh_tokens WHERE user_id = ?", userId},
+		{"sessions", "DELETE FROM sessions WHERE user_id = ?", userId},
+		{"access_tokens", "DELETE FROM personal_access_tokens WHERE user_id = ?", userId},
+		{"email_tokens", "DELETE FROM email_tokens WHERE user_id = ?", userId},
+		{"recovery_codes", "DELETE FROM user_recovery_codes WHERE user_id = ?", userId},
+		{"roles", "DELETE FROM user_roles WHERE user_id = ?", userId},
+		{"audit_ips", "DELETE i FROM audit_log_ips i JOIN audit_log a ON a.id = i.audit_id WHERE a.actor_id = ?", userId},
+		{"login_attempts", "DELETE FROM login_attempts WHERE attempt_key = ?", "user:" + strings.ToLower(oldUsername)},
+	}
+	summary = map[string]int64{}
+	for _, removal := range removals {
+		res, err := tx.Exec(removal.sql, removal.arg)
+		if err != nil {
+			return nil, fmt.Errorf("erase %s: %w", removal.name, err)
+		}
+		summary[removal.name], err = res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sql = `
+        UPDATE users
+        SET username = ?, email = NULL, password_hash = '', token_version = token_version + 1,
+            totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL,
+            display_name = NULL, avatar_url = NULL, bio = NULL, pending_email = NULL,
+            last_seen_at = NULL, deletion_requested_at = NULL, erased_at = NOW()
+        WHERE id = ?
+    `
+	_, err = tx.Exec(sql, username, userId)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+	sql = "UPDATE erasure_requests SET completed_at = NOW(), completed_by = ?, summary = ? WHERE id = ?"
+	_, err = tx.Exec(sql, completedBy, data, requestId)
+	if err != nil {
+		return
+	}
+	return summary, tx.Commit()
+}
+
+// records scans any query into maps keyed by column name. JSON columns are
+// kept as JSON, other text becomes strings.
+func (repo *privacyRepo) records(sql string, args ...interface{}) (records []map[string]interface{}, err error) {
+	rows, err := repo.db.Query(sql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return
+	}
+	records = []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(types))
+		pointers := make([]interface{}, len(types))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return
+		}
+
+		record := make(map[string]interface{}, len(types))
+		for i, t := range types {
+			value := values[i]
+			if b, ok := value.([]byte); ok {
+				if t.DatabaseTypeName() == "JSON" {
+					value = json.RawMessage(b)
+				} else {
+					value = string(b)
+				}
+			}
+			record[t.Name()] = value
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
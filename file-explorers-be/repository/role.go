@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+var ErrRoleNotFound = fmt.Errorf("role not found")
+
+type RoleRepository interface {
+	ListRoles() (roles []models.Role, err error)
+	UserRoles(userId int) (roles []models.UserRole, err error)
+	UserPermissions(userId int, twoFactor bool) (roles, permissions []string, err error)
+	RequiresTwoFactor(userId int) (required bool, err error)
+	SetRoleTwoFactor(role string, required bool) (err error)
+	GrantRole(userId int, role string, grantedBy *int) (err error)
+	RevokeRole(userId int, role string) (err error)
+	CountRoleMembers(role string) (count int, err error)
+}
+
+type roleRepo struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) RoleRepository {
+	return &roleRepo{
+		db: db,
+	}
+}
+
+func (repo *roleRepo) ListRoles() (roles []models.Role, err error) {
+	sql := `
+        SELECT r.name, r.requires_2fa, p.name
+        FROM roles r
+        LEFT JOIN role_permissions rp ON rp.role_id = r.role_id
+        LEFT JOIN permissions p ON p.permission_id = rp.permission_id
+        ORDER BY r.role_id, p.name
+    `
+	rows, err := repo.db.Query(sql)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var twoFactor bool
+		var permission *string
+		err = rows.Scan(&name, &twoFactor, &permission)
+		if err != nil {
+			return
+		}
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, models.Role{Name: name, Permissions: []string{}, TwoFactorRequired: twoFactor})
+		}
+		if permission != nil {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, *permission)
+		}
+	}
+	return
+}
+
+func (repo *roleRepo) UserRoles(userId int) (roles []models.UserRole, err error) {
+	sql := `
+        SELECT r.name, ur.granted_by, ur.granted_at
+        FROM user_roles ur
+        JOIN roles r ON r.role_id = ur.role_id
+        WHERE ur.user_id = ?
+        ORDER BY r.role_id
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	roles = []models.UserRole{}
+	for rows.Next() {
+		var role models.UserRole
+		err = rows.Scan(&role.Role, &role.GrantedBy, &role.GrantedAt)
+		if err != nil {
+			return
+		}
+		roles = append(roles, role)
+	}
+	return
+}
+
+// UserPermissions returns the names of the user's roles and every permission
+// those roles carry, without duplicates. Roles that require two-factor
+// authentication only count when twoFactor is set.
+func (repo *roleRepo) UserPermissions(userId int, twoFactor bool) (roles, permissions []string, err error) {
+	sql := `
+        SELECT r.name, p.name
+        FROM user_roles ur
+        JOIN roles r ON r.role_id = ur.role_id
+        LEFT JOIN role_permissions rp ON rp.role_id = r.role_id
+        LEFT JOIN permissions p ON p.permission_id = rp.permission_id
+        WHERE ur.user_id = ? AND (? OR r.requires_2fa = FALSE)
+        ORDER BY r.role_id, p.name
+    `
+	rows, err := repo.db.Query(sql, userId, twoFactor)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	roles = []string{}
+	permissions = []string{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var permission *string
+		err = rows.Scan(&name, &permission)
+		if err != nil {
+			return
+		}
+		if len(roles) == 0 || roles[len(roles)-1] != name {
+			roles = append(roles, name)
+		}
+		if permission != nil && !seen[*permission] {
+			seen[*permission] = true
+			permissions = append(permissions, *permission)
+		}
+	}
+	return
+}
+
+func (repo *roleRepo) RequiresTwoFactor(userId int) (required bool, err error) {
+	sql := `
+        SELECT 1
+        FROM user_roles ur
+        JOIN roles r ON r.role_id = ur.role_id
+        WHERE ur.user_id = ? AND r.requires_2fa = TRUE
+        LIMIT 1
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+func (repo *roleRepo) SetRoleTwoFactor(role string, required bool) (err error) {
+	exists, err := repo.roleExists(role)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	sql := "UPDATE roles SET requires_2fa = ? WHERE name = ?"
+	_, err = repo.db.Exec(sql, required, role)
+	return
+}
+
+func (repo *roleRepo) GrantRole(userId int, role string, grantedBy *int) (err error) {
+	sql := `
+        INSERT IGNORE INTO user_roles (user_id, role_id, granted_by)
+        SELECT ?, role_id, ? FROM roles WHERE name = ?
+    `
+	res, err := repo.db.Exec(sql, userId, grantedBy, role)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return
+	}
+
+	// Nothing was inserted: either the user already has the role or it
+	// does not exist.
+	exists, err := repo.roleExists(role)
+	if err == nil && !exists {
+		err = ErrRoleNotFound
+	}
+	return
+}
+
+func (repo *roleRepo) RevokeRole(userId int, role string) (err error) {
+	sql := `
+        DELETE ur FROM user_roles ur
+        JOIN roles r ON r.role_id = ur.role_id
+        WHERE ur.user_id = ? AND r.name = ?
+    `
+	res, err := repo.db.Exec(sql, userId, role)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrRoleNotFound
+	}
+	return
+}
+
+func (repo *roleRepo) CountRoleMembers(role string) (count int, err error) {
+	sql := `
+        SELECT COUNT(*)
+        FROM user_roles ur
+        JOIN roles r ON r.role_id = ur.role_id
+        WHERE r.name = ?
+    `
+	rows, err := repo.db.Query(sql, role)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+	return
+}
+
+func (repo *roleRepo) roleExists(role string) (exists bool, err error) {
+	sql := "SELECT 1 FROM roles WHERE name = ?"
+	rows, err := repo.db.Query(sql, role)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
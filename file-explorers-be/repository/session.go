@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"fmt"
+	"time"
+)
+
+var ErrSessionNotFound = fmt.Errorf("session not found")
+
+type SessionRepository interface {
+	CreateSession(sessionId string, userId int) (err error)
+	TouchSession(sessionId, ip, userAgent string) (err error)
+	ListSessions(userId int) (sessions []models.Session, err error)
+	RevokeSession(userId int, sessionId string) (err error)
+	SessionStarted(userId int, sessionId string) (startedAt time.Time, err error)
+}
+
+type sessionRepo struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepo{
+		db: db,
+	}
+}
+
+func (repo *sessionRepo) CreateSession(sessionId string, userId int) (err error) {
+	sql := "INSERT INTO sessions (id, user_id, last_seen_at) VALUES (?, ?, NOW())"
+	_, err = repo.db.Exec(sql, sessionId, userId)
+	if err != nil {
+		return
+	}
+
+	// Ended sessions, and old ones whose refresh tokens have all been
+	// cleaned up, are only kept until the user's next login.
+	sql = `
+        DELETE FROM sessions
+        WHERE user_id = ? AND id <> ?
+            AND (revoked_at IS NOT NULL OR (created_at < NOW() - INTERVAL 1 DAY
+                AND NOT EXISTS (SELECT 1 FROM refresh_tokens t WHERE t.family_id = sessions.id)))
+    `
+	_, err = repo.db.Exec(sql, userId, sessionId)
+	return
+}
+
+// TouchSession records where the session was last used from. It writes at
+// most once a minute unless the address or browser changed.
+func (repo *sessionRepo) TouchSession(sessionId, ip, userAgent string) (err error) {
+	sql := `
+        UPDATE sessions
+        SET last_seen_at = NOW(), ip = ?, user_agent = ?
+        WHERE id = ? AND revoked_at IS NULL
+            AND (last_seen_at IS NULL OR last_seen_at < NOW() - INTERVAL 1 MINUTE
+                OR NOT (ip <=> ?) OR NOT (user_agent <=> ?))
+    `
+	_, err = repo.db.Exec(sql, ip, userAgent, sessionId, ip, userAgent)
+	return
+}
+
+// ListSessions returns the sessions that can still be refreshed, most
+// recently used first.
+func (repo *sessionRepo) ListSessions(userId int) (sessions []models.Session, err error) {
+	sql := `
+        SELECT s.id, COALESCE(s.user_agent, ''), COALESCE(s.ip, ''), s.created_at, s.last_seen_at
+        FROM sessions s
+        WHERE s.user_id = ? AND s.revoked_at IS NULL
+            AND EXISTS (
+                SELECT 1 FROM refresh_tokens t
+                WHERE t.family_id = s.id AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW()
+            )
+        ORDER BY COALESCE(s.last_seen_at, s.created_at) DESC
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	sessions = []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// SessionStarted returns when the user signed in to a session that has not
+// been ended.
+func (repo *sessionRepo) SessionStarted(userId int, sessionId string) (startedAt time.Time, err error) {
+	sql := "SELECT created_at FROM sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+	rows, err := repo.db.Query(sql, sessionId, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = ErrSessionNotFound
+		return
+	}
+	err = rows.Scan(&startedAt)
+	return
+}
+
+// RevokeSession ends one session of the user, refresh tokens included.
+func (repo *sessionRepo) RevokeSession(userId int, sessionId string) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE sessions SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+	res, err := tx.Exec(sql, sessionId, userId)
+	if err != nil {
+		return
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	sql = "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = ? AND revoked_at IS NULL"
+	_, err = tx.Exec(sql, sessionId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+type TerminalRepository interface {
+	GetLevelSetup(level int) (state models.TerminalState, solution []models.SolutionRequirement, err error)
+	GetState(userId, level int) (state models.TerminalState, found bool, err error)
+	SaveState(userId, level int, state models.TerminalState) (err error)
+	DeleteState(userId, level int) (err error)
+	LogCommand(userId, level int, result models.TerminalResult, keep int) (err error)
+	LogTranscript(userId, level int, result models.TranscriptResult, keep int) (err error)
+}
+
+type terminalRepo struct {
+	db *sql.DB
+}
+
+func NewTerminalRepository(db *sql.DB) TerminalRepository {
+	return &terminalRepo{
+		db: db,
+	}
+}
+
+func (repo *terminalRepo) GetLevelSetup(level int) (state models.TerminalState, solution []models.SolutionRequirement, err error) {
+	sql := "SELECT starting_file_system, level_solution FROM levels WHERE level_id=?"
+	rows, err := repo.db.Query(sql, level)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = fmt.Errorf("level not found")
+		return
+	}
+
+	var startingFileSystem []byte
+	var levelSolution []byte
+	err = rows.Scan(&startingFileSystem, &levelSolution)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(startingFileSystem, &state.FileSystem)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(levelSolution, &solution)
+	return
+}
+
+func (repo *terminalRepo) GetState(userId, level int) (state models.TerminalState, found bool, err error) {
+	sql := "SELECT file_system, open_folder, next_id FROM user_level_terminals WHERE user_id=? AND level_id=?"
+	rows, err := repo.db.Query(sql, userId, level)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return
+	}
+
+	var fileSystem []byte
+	err = rows.Scan(&fileSystem, &state.OpenFolder, &state.NextID)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(fileSystem, &state.FileSystem)
+	return state, err == nil, err
+}
+
+func (repo *terminalRepo) SaveState(userId, level int, state models.TerminalState) (err error) {
+	fileSystem, err := json.Marshal(state.FileSystem)
+	if err != nil {
+		return
+	}
+
+	sql := `
+        INSERT INTO user_level_terminals (user_id, level_id, file_system, open_folder, next_id)
+        VALUES (?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE file_system = VALUES(file_system), open_folder = VALUES(open_folder), next_id = VALUES(next_id)
+    `
+	_, err = repo.db.Exec(sql, userId, level, fileSystem, state.OpenFolder, state.NextID)
+	return
+}
+
+func (repo *terminalRepo) DeleteState(userId, level int) (err error) {
+	sql := "DELETE FROM user_level_terminals WHERE user_id=? AND level_id=?"
+	_, err = repo.db.Exec(sql, userId, level)
+	return
+}
+
+// pruneCommands keeps only the newest commands of a user in a level. The
+// inner query is wrapped in a derived table, as MySQL does not allow a
+// DELETE to select from its own table directly.
+const pruneCommands = `
+        DELETE FROM terminal_commands
+        WHERE user_id = ? AND level_id = ? AND id <= (
+            SELECT id FROM (
+                SELECT id FROM terminal_commands
+                WHERE user_id = ? AND level_id = ?
+                ORDER BY id DESC
+                LIMIT 1 OFFSET ?
+            ) oldest
+        )
+    `
+
+// LogCommand records a command and drops the user's oldest commands in the
+// level beyond the newest keep.
+func (repo *terminalRepo) LogCommand(userId, level int, result models.TerminalResult, keep int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "INSERT INTO terminal_commands (user_id, level_id, command, output, error, cwd) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(sql, userId, level, result.Command, result.Output, result.Error, result.Cwd)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(pruneCommands, userId, level, userId, level, keep)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// LogTranscript records the steps of a replay, keeping at most keep
+// commands of the user in the level like LogCommand.
+func (repo *terminalRepo) LogTranscript(userId, level int, result models.TranscriptResult, keep int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "INSERT INTO terminal_commands (user_id, level_id, command, output, error, cwd, replayed) VALUES (?, ?, ?, ?, ?, ?, TRUE)"
+	for _, step := range result.Steps {
+		_, err = tx.Exec(sql, userId, level, step.Command, step.Output, step.Error, result.Cwd)
+		if err != nil {
+			return
+		}
+	}
+	_, err = tx.Exec(pruneCommands, userId, level, userId, level, keep)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
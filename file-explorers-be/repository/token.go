@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"database/sql"
+	"file-explorers-be/models"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrRefreshTokenNotFound = fmt.Errorf("refresh token not found")
+	ErrEmailTokenNotFound   = fmt.Errorf("email token not found")
+)
+
+type TokenRepository interface {
+	CreateRefreshToken(userId int, familyId, hash string, expiresAt time.Time) (err error)
+	GetRefreshToken(hash string) (token models.RefreshToken, err error)
+	UseRefreshToken(id int) (used bool, err error)
+	RevokeTokenFamily(familyId string) (err error)
+	RevokeUserTokens(userId int) (err error)
+	BumpTokenVersion(userId int) (err error)
+	RevokeToken(jti string, expiresAt time.Time) (err error)
+	UseToken(jti string, expiresAt time.Time) (used bool, err error)
+	TokenState(userId int, jti, sessionId string) (version int, revoked bool, err error)
+	CreateEmailToken(userId int, purpose, hash string, expiresAt time.Time) (err error)
+	UseEmailToken(purpose, hash string) (userId int, err error)
+	EmailTokenStats(userId int, purpose string, since time.Time) (count int, last *time.Time, err error)
+}
+
+type tokenRepo struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) TokenRepository {
+	return &tokenRepo{
+		db: db,
+	}
+}
+
+func (repo *tokenRepo) CreateRefreshToken(userId int, familyId, hash string, expiresAt time.Time) (err error) {
+	sql := "INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?)"
+	_, err = repo.db.Exec(sql, userId, familyId, hash, expiresAt)
+	if err != nil {
+		return
+	}
+
+	// Rotated and expired tokens are only kept long enough to catch reuse.
+	sql = "DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < NOW()"
+	_, err = repo.db.Exec(sql, userId)
+	return
+}
+
+func (repo *tokenRepo) GetRefreshToken(hash string) (token models.RefreshToken, err error) {
+	sql := `
+        SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+        FROM refresh_tokens
+        WHERE token_hash = ?
+    `
+	rows, err := repo.db.Query(sql, hash)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = ErrRefreshTokenNotFound
+		return
+	}
+	err = rows.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	return
+}
+
+// UseRefreshToken marks the token as spent. It reports false when another
+// request got there first, which is treated the same as reuse.
+func (repo *tokenRepo) UseRefreshToken(id int) (used bool, err error) {
+	sql := "UPDATE refresh_tokens SET used_at = NOW() WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL"
+	res, err := repo.db.Exec(sql, id)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RevokeTokenFamily ends one session: its refresh tokens stop working, and
+// so do the access tokens that carry it as their sid.
+func (repo *tokenRepo) RevokeTokenFamily(familyId string) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = ? AND revoked_at IS NULL"
+	_, err = tx.Exec(sql, familyId)
+	if err != nil {
+		return
+	}
+
+	sql = "UPDATE sessions SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL"
+	_, err = tx.Exec(sql, familyId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// RevokeUserTokens ends every session of the user: refresh tokens are revoked
+// and the token version is bumped so outstanding access tokens stop working.
+func (repo *tokenRepo) RevokeUserTokens(userId int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE users SET token_version = token_version + 1 WHERE id = ?"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+
+	sql = "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+
+	sql = "UPDATE sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// BumpTokenVersion makes the user's access tokens stale without ending their
+// sessions: the next refresh issues a token with up to date claims.
+func (repo *tokenRepo) BumpTokenVersion(userId int) (err error) {
+	sql := "UPDATE users SET token_version = token_version + 1 WHERE id = ?"
+	_, err = repo.db.Exec(sql, userId)
+	return
+}
+
+// RevokeToken blocks a single access token until it would have expired anyway.
+func (repo *tokenRepo) RevokeToken(jti string, expiresAt time.Time) (err error) {
+	sql := "INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	_, err = repo.db.Exec(sql, jti, expiresAt)
+	if err != nil {
+		return
+	}
+
+	sql = "DELETE FROM revoked_tokens WHERE expires_at < NOW()"
+	_, err = repo.db.Exec(sql)
+	return
+}
+
+// UseToken revokes a single-use token. Used is false when the token had
+// already been revoked, so of two requests racing with the same token only
+// one gets through.
+func (repo *tokenRepo) UseToken(jti string, expiresAt time.Time) (used bool, err error) {
+	sql := "INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	res, err := repo.db.Exec(sql, jti, expiresAt)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// TokenState returns what an access token is checked against: the user's
+// current token version and whether the token itself, or the session it
+// belongs to, has been revoked.
+func (repo *tokenRepo) TokenState(userId int, jti, sessionId string) (version int, revoked bool, err error) {
+	sql := `
+        SELECT u.token_version,
+            EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)
+            OR (? <> '' AND NOT EXISTS (SELECT 1 FROM sessions WHERE id = ? AND revoked_at IS NULL))
+        FROM users u
+        WHERE u.id = ?
+    `
+	rows, err := repo.db.Query(sql, jti, sessionId, sessionId, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = fmt.Errorf("user not found")
+		return
+	}
+	err = rows.Scan(&version, &revoked)
+	return
+}
+
+func (repo *tokenRepo) CreateEmailToken(userId int, purpose, hash string, expiresAt time.Time) (err error) {
+	sql := "INSERT INTO email_tokens (user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?)"
+	_, err = repo.db.Exec(sql, userId, purpose, hash, expiresAt)
+	return
+}
+
+// UseEmailToken spends a token sent by email and returns whose it was. A
+// token works once and only for the purpose it was sent for.
+func (repo *tokenRepo) UseEmailToken(purpose, hash string) (userId int, err error) {
+	sql := `
+        SELECT id, user_id
+        FROM email_tokens
+        WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > NOW()
+    `
+	rows, err := repo.db.Query(sql, hash, purpose)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = ErrEmailTokenNotFound
+		return
+	}
+	var id int
+	err = rows.Scan(&id, &userId)
+	if err != nil {
+		return
+	}
+	rows.Close()
+
+	sql = "UPDATE email_tokens SET used_at = NOW() WHERE id = ? AND used_at IS NULL"
+	res, err := repo.db.Exec(sql, id)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrEmailTokenNotFound
+	}
+	return
+}
+
+// EmailTokenStats counts the tokens of one purpose sent to the user since the
+// given time and returns when the latest one was sent.
+func (repo *tokenRepo) EmailTokenStats(userId int, purpose string, since time.Time) (count int, last *time.Time, err error) {
+	sql := `
+        SELECT COUNT(*), MAX(created_at)
+        FROM email_tokens
+        WHERE user_id = ? AND purpose = ? AND created_at >= ?
+    `
+	rows, err := repo.db.Query(sql, userId, purpose, since)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&count, &last)
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+)
+
+type TwoFactorRepository interface {
+	GetTOTPSecret(userId int) (secret *string, enabled bool, err error)
+	SetTOTPSecret(userId int, secret string) (err error)
+	EnableTOTP(userId int) (err error)
+	DisableTOTP(userId int) (err error)
+	UseTOTPStep(userId int, step int64) (used bool, err error)
+	ReplaceRecoveryCodes(userId int, hashes []string) (err error)
+	UseRecoveryCode(userId int, hash string) (used bool, err error)
+}
+
+type twoFactorRepo struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) TwoFactorRepository {
+	return &twoFactorRepo{
+		db: db,
+	}
+}
+
+func (repo *twoFactorRepo) GetTOTPSecret(userId int) (secret *string, enabled bool, err error) {
+	sql := "SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = ?"
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&secret, &enabled)
+	}
+	return
+}
+
+// SetTOTPSecret stores a secret that is still being enrolled. It never
+// replaces the secret of an enabled authenticator.
+func (repo *twoFactorRepo) SetTOTPSecret(userId int, secret string) (err error) {
+	sql := "UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ? AND totp_enabled_at IS NULL"
+	_, err = repo.db.Exec(sql, secret, userId)
+	return
+}
+
+func (repo *twoFactorRepo) EnableTOTP(userId int) (err error) {
+	sql := "UPDATE users SET totp_enabled_at = NOW() WHERE id = ? AND totp_secret IS NOT NULL"
+	_, err = repo.db.Exec(sql, userId)
+	return
+}
+
+func (repo *twoFactorRepo) DisableTOTP(userId int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = ?"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+
+	sql = "DELETE FROM user_recovery_codes WHERE user_id = ?"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted password. It reports
+// false when that step or a later one was already used, so a password
+// cannot be replayed.
+func (repo *twoFactorRepo) UseTOTPStep(userId int, step int64) (used bool, err error) {
+	sql := "UPDATE users SET totp_last_step = ? WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)"
+	res, err := repo.db.Exec(sql, step, userId, step)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (repo *twoFactorRepo) ReplaceRecoveryCodes(userId int, hashes []string) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "DELETE FROM user_recovery_codes WHERE user_id = ?"
+	_, err = tx.Exec(sql, userId)
+	if err != nil {
+		return
+	}
+
+	sql = "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)"
+	for _, hash := range hashes {
+		_, err = tx.Exec(sql, userId, hash)
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+func (repo *twoFactorRepo) UseRecoveryCode(userId int, hash string) (used bool, err error) {
+	sql := "UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+	res, err := repo.db.Exec(sql, userId, hash)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"file-explorers-be/models"
+	"fmt"
+)
+
+var (
+	ErrWorkspaceNotFound = fmt.Errorf("workspace not found")
+	ErrWorkspaceLimit    = fmt.Errorf("workspace limit reached")
+)
+
+type WorkspaceRepository interface {
+	ListWorkspaces(userId int) (workspaces []models.Workspace, err error)
+	GetWorkspace(userId, workspaceId int) (workspace models.Workspace, err error)
+	GetSharedWorkspace(token string) (workspace models.Workspace, err error)
+	CreateWorkspace(userId int, name, kind string, content []byte, maxWorkspaces int) (workspaceId int, err error)
+	UpdateWorkspace(userId, workspaceId int, name string, content []byte, maxVersions int) (err error)
+	DeleteWorkspace(userId, workspaceId int) (err error)
+	ListVersions(userId, workspaceId int) (versions []models.WorkspaceVersion, err error)
+	GetVersion(userId, workspaceId, version int) (v models.WorkspaceVersion, err error)
+	SetShareToken(userId, workspaceId int, token *string) (err error)
+}
+
+type workspaceRepo struct {
+	db *sql.DB
+}
+
+func NewWorkspaceRepository(db *sql.DB) WorkspaceRepository {
+	return &workspaceRepo{
+		db: db,
+	}
+}
+
+func (repo *workspaceRepo) ListWorkspaces(userId int) (workspaces []models.Workspace, err error) {
+	sql := `
+        SELECT workspace_id, name, kind, current_version, share_token, created_at, updated_at
+        FROM workspaces
+        WHERE user_id = ?
+        ORDER BY updated_at DESC
+    `
+	rows, err := repo.db.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w models.Workspace
+		err = rows.Scan(&w.WorkspaceID, &w.Name, &w.Kind, &w.Version, &w.ShareToken, &w.CreatedAt, &w.UpdatedAt)
+		if err != nil {
+			return
+		}
+		workspaces = append(workspaces, w)
+	}
+	return
+}
+
+func (repo *workspaceRepo) GetWorkspace(userId, workspaceId int) (workspace models.Workspace, err error) {
+	return repo.getWorkspace("w.user_id = ? AND w.workspace_id = ?", userId, workspaceId)
+}
+
+// GetSharedWorkspace loads the latest version of a workspace by its share
+// token, for any user holding the link.
+func (repo *workspaceRepo) GetSharedWorkspace(token string) (workspace models.Workspace, err error) {
+	workspace, err = repo.getWorkspace("w.share_token = ?", token)
+	workspace.ShareToken = nil
+	workspace.ReadOnly = true
+	return
+}
+
+func (repo *workspaceRepo) getWorkspace(condition string, args ...interface{}) (workspace models.Workspace, err error) {
+	sql := `
+        SELECT w.workspace_id, w.name, w.kind, w.current_version, w.share_token, u.username,
+               w.created_at, w.updated_at, v.content
+        FROM workspaces w
+        JOIN users u ON u.id = w.user_id
+        JOIN workspace_versions v ON v.workspace_id = w.workspace_id AND v.version = w.current_version
+        WHERE ` + condition
+	rows, err := repo.db.Query(sql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = ErrWorkspaceNotFound
+		return
+	}
+
+	var content []byte
+	err = rows.Scan(
+		&workspace.WorkspaceID,
+		&workspace.Name,
+		&workspace.Kind,
+		&workspace.Version,
+		&workspace.ShareToken,
+		&workspace.Owner,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+		&content,
+	)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &workspace.Content)
+	return
+}
+
+// CreateWorkspace stores a new workspace unless the user already has
+// maxWorkspaces. The user's row is locked while counting, so concurrent
+// creates cannot go over the limit.
+func (repo *workspaceRepo) CreateWorkspace(userId int, name, kind string, content []byte, maxWorkspaces int) (workspaceId int, err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "SELECT id FROM users WHERE id = ? FOR UPDATE"
+	rows, err := tx.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	rows.Close()
+
+	sql = "SELECT COUNT(*) FROM workspaces WHERE user_id = ?"
+	rows, err = tx.Query(sql, userId)
+	if err != nil {
+		return
+	}
+	var count int
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+	rows.Close()
+	if err != nil {
+		return
+	}
+	if count >= maxWorkspaces {
+		return 0, ErrWorkspaceLimit
+	}
+
+	sql = "INSERT INTO workspaces (user_id, name, kind, current_version) VALUES (?, ?, ?, 1)"
+	res, err := tx.Exec(sql, userId, name, kind)
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+
+	sql = "INSERT INTO workspace_versions (workspace_id, version, content, size) VALUES (?, 1, ?, ?)"
+	_, err = tx.Exec(sql, id, content, len(content))
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return int(id), err
+}
+
+// UpdateWorkspace renames a workspace and, when content is given, stores it as
+// a new version. Only the newest maxVersions versions are kept.
+func (repo *workspaceRepo) UpdateWorkspace(userId, workspaceId int, name string, content []byte, maxVersions int) (err error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	sql := "SELECT current_version FROM workspaces WHERE user_id = ? AND workspace_id = ? FOR UPDATE"
+	rows, err := tx.Query(sql, userId, workspaceId)
+	if err != nil {
+		return
+	}
+	var version int
+	if rows.Next() {
+		err = rows.Scan(&version)
+	} else {
+		err = ErrWorkspaceNotFound
+	}
+	rows.Close()
+	if err != nil {
+		return
+	}
+
+	if content != nil {
+		version++
+		sql = "INSERT INTO workspace_versions (workspace_id, version, content, size) VALUES (?, ?, ?, ?)"
+		_, err = tx.Exec(sql, workspaceId, version, content, len(content))
+		if err != nil {
+			return
+		}
+
+		sql = "DELETE FROM workspace_versions WHERE workspace_id = ? AND version <= ?"
+		_, err = tx.Exec(sql, workspaceId, version-maxVersions)
+		if err != nil {
+			return
+		}
+	}
+
+	sql = "UPDATE workspaces SET name = COALESCE(NULLIF(?, ''), name), current_version = ?, updated_at = NOW() WHERE workspace_id = ?"
+	_, err = tx.Exec(sql, name, version, workspaceId)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+func (repo *workspaceRepo) DeleteWorkspace(userId, workspaceId int) (err error) {
+	sql := "DELETE FROM workspaces WHERE user_id = ? AND workspace_id = ?"
+	res, err := repo.db.Exec(sql, userId, workspaceId)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrWorkspaceNotFound
+	}
+	return
+}
+
+func (repo *workspaceRepo) ListVersions(userId, workspaceId int) (versions []models.WorkspaceVersion, err error) {
+	sql := `
+        SELECT v.version, v.size, v.created_at
+        FROM workspace_versions v
+        JOIN workspaces w ON w.workspace_id = v.workspace_id
+        WHERE w.user_id = ? AND w.workspace_id = ?
+        ORDER BY v.version DESC
+    `
+	rows, err := repo.db.Query(sql, userId, workspaceId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.WorkspaceVersion
+		err = rows.Scan(&v.Version, &v.Size, &v.CreatedAt)
+		if err != nil {
+			return
+		}
+		versions = append(versions, v)
+	}
+	if err == nil && len(versions) == 0 {
+		err = ErrWorkspaceNotFound
+	}
+	return
+}
+
+func (repo *workspaceRepo) GetVersion(userId, workspaceId, version int) (v models.WorkspaceVersion, err error) {
+	sql := `
+        SELECT v.version, v.size, v.created_at, v.content
+        FROM workspace_versions v
+        JOIN workspaces w ON w.workspace_id = v.workspace_id
+        WHERE w.user_id = ? AND w.workspace_id = ? AND v.version = ?
+    `
+	rows, err := repo.db.Query(sql, userId, workspaceId, version)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = fmt.Errorf("workspace version not found")
+		return
+	}
+
+	var content []byte
+	err = rows.Scan(&v.Version, &v.Size, &v.CreatedAt, &content)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &v.Content)
+	return
+}
+
+func (repo *workspaceRepo) SetShareToken(userId, workspaceId int, token *string) (err error) {
+	_, err = repo.GetWorkspace(userId, workspaceId)
+	if err != nil {
+		return
+	}
+
+	sql := "UPDATE workspaces SET share_token = ? WHERE user_id = ? AND workspace_id = ?"
+	_, err = repo.db.Exec(sql, token, userId, workspaceId)
+	return
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"file-explorers-be/models"
 	"file-explorers-be/server"
 
 	"github.com/go-chi/chi/v5"
@@ -14,11 +15,12 @@ func NewRouter(srv server.Server) *chi.Mux {
 	// Middleware
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
+	router.Use(srv.ClientAddress)
 	
 	// CORS middleware
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:8081", "http://localhost:8082", "http://localhost:8080"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
@@ -29,20 +31,166 @@ func NewRouter(srv server.Server) *chi.Mux {
 	router.Route("/auth", func(r chi.Router) {
 		r.Post("/login", srv.Login)
 		r.Post("/register", srv.Register)
+		r.Post("/guest", srv.CreateGuest)
+		r.Post("/refresh", srv.RefreshToken)
 		r.Post("/change-password", srv.ChangePassword)
+		r.Get("/verify", srv.VerifyEmail)
+		r.Post("/verify/resend", srv.ResendVerification)
+		r.Post("/forgot-password", srv.ForgotPassword)
+		r.Post("/reset-password", srv.ResetPassword)
+		r.Post("/2fa/verify", srv.VerifyTwoFactor)
+		r.Get("/unlock", srv.UnlockAccount)
+		r.Get("/confirm-email", srv.ConfirmEmailChange)
+
+		r.Get("/oidc/providers", srv.GetOIDCProviders)
+		r.Get("/oidc/{provider}/login", srv.OIDCLogin)
+		r.Get("/oidc/{provider}/callback", srv.OIDCCallback)
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.Authenticate)
+			r.Post("/logout", srv.Logout)
+			r.Post("/logout-all", srv.LogoutAll)
+			r.Post("/upgrade", srv.UpgradeGuest)
+			r.Post("/oidc/{provider}/link", srv.LinkOIDCIdentity)
+			r.Post("/oidc/{provider}/link/confirm", srv.ConfirmOIDCLink)
+			r.Get("/identities", srv.GetIdentities)
+			r.Delete("/identities/{provider}", srv.UnlinkIdentity)
+			r.Post("/2fa/setup", srv.SetupTwoFactor)
+			r.Get("/2fa/qr.png", srv.GetTwoFactorQRCode)
+			r.Post("/2fa/enable", srv.EnableTwoFactor)
+			r.Post("/2fa/disable", srv.DisableTwoFactor)
+			r.Post("/2fa/recovery-codes", srv.RegenerateRecoveryCodes)
+		})
+	})
+
+	// The signed-in user's own account. Scripts can read the profile with a
+	// personal access token; everything else needs a login.
+	router.Route("/me", func(r chi.Router) {
+		r.With(srv.AuthenticateScoped(models.ScopeReadProgress)).Get("/", srv.GetMe)
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.Authenticate)
+			r.Patch("/", srv.UpdateMe)
+			r.Delete("/", srv.DeleteMe)
+			r.Post("/password", srv.ChangeMyPassword)
+			r.Get("/export", srv.ExportMe)
+			r.Get("/sessions", srv.GetSessions)
+			r.Delete("/sessions/{sessionId}", srv.RevokeSession)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.Authenticate)
+			r.Use(srv.RequireVerified)
+			r.Get("/tokens", srv.GetAccessTokens)
+			r.Post("/tokens", srv.CreateAccessToken)
+			r.Delete("/tokens/{tokenId}", srv.RevokeAccessToken)
+		})
 	})
 
 	// Level routes
 	router.Route("/level", func(r chi.Router) {
-		r.Get("/{levelId}", srv.GetLevelData)
-		r.Post("/{levelId}", srv.StartLevel)
-		r.Put("/{levelId}", srv.SolvedLevel)
-		r.Get("/", srv.GetLevels)
+		r.Group(func(r chi.Router) {
+			r.Use(srv.AuthenticateScoped(models.ScopeReadProgress))
+			r.Get("/{levelId}", srv.GetLevelData)
+			r.Get("/{levelId}/boolean/solution", srv.GetBooleanSolution)
+			r.Get("/", srv.GetLevels)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.AuthenticateScoped(models.ScopeWriteLevels))
+			r.Post("/{levelId}", srv.StartLevel)
+			r.Put("/{levelId}", srv.SolvedLevel)
+			r.Post("/{levelId}/terminal", srv.RunTerminalCommand)
+			r.Delete("/{levelId}/terminal", srv.ResetTerminal)
+			r.Post("/{levelId}/transcript", srv.SubmitTranscript)
+			r.Post("/{levelId}/boolean", srv.SubmitBooleanCircuit)
+		})
+	})
+
+	// Circuit builder routes. Evaluating a circuit does not need an account;
+	// simulating one is heavier and does, as does challenge progress.
+	router.Route("/circuit", func(r chi.Router) {
+		r.Post("/evaluate", srv.EvaluateCircuit)
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.Authenticate)
+			r.Post("/simulate", srv.SimulateCircuit)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.AuthenticateScoped(models.ScopeReadProgress))
+			r.Get("/challenges", srv.GetCircuitProgress)
+			r.Get("/challenges/{challengeId}", srv.GetCircuitChallenge)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.AuthenticateScoped(models.ScopeWriteLevels))
+			r.Post("/challenges/{challengeId}/complete", srv.CompleteCircuitChallenge)
+		})
+	})
+
+	// Logic gate tools
+	router.Route("/logic", func(r chi.Router) {
+		r.Use(srv.AuthenticateScoped(models.ScopeReadProgress))
+		r.Post("/synthesize", srv.SynthesizeCircuit)
+	})
+
+	// Saved circuit and boolean designs
+	router.Route("/workspaces", func(r chi.Router) {
+		r.Use(srv.Authenticate)
+		r.Use(srv.RequireVerified)
+		r.Get("/", srv.ListWorkspaces)
+		r.Post("/", srv.CreateWorkspace)
+		r.Get("/shared/{token}", srv.GetSharedWorkspace)
+		r.Post("/import/spice", srv.ImportWorkspaceSPICE)
+		r.Get("/{workspaceId}", srv.GetWorkspace)
+		r.Put("/{workspaceId}", srv.UpdateWorkspace)
+		r.Delete("/{workspaceId}", srv.DeleteWorkspace)
+		r.Get("/{workspaceId}/versions", srv.GetWorkspaceVersions)
+		r.Get("/{workspaceId}/versions/{version}", srv.GetWorkspaceVersion)
+		r.Post("/{workspaceId}/share", srv.ShareWorkspace)
+		r.Delete("/{workspaceId}/share", srv.UnshareWorkspace)
+		r.Get("/{workspaceId}/netlist.cir", srv.ExportWorkspaceSPICE)
+	})
+
+	// Administration. Personal access tokens need the admin:users scope on
+	// top of the permission.
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(srv.AuthenticateScoped(models.ScopeAdminUsers))
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.RequirePermission(models.PermissionManageRoles))
+			r.Get("/roles", srv.GetRoles)
+			r.Put("/roles/{role}/two-factor", srv.SetRoleTwoFactor)
+			r.Get("/users/{userId}/roles", srv.GetUserRoles)
+			r.Post("/users/{userId}/roles", srv.GrantUserRole)
+			r.Delete("/users/{userId}/roles/{role}", srv.RevokeUserRole)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.RequirePermission(models.PermissionModerateUsers))
+			r.Delete("/users/{userId}/lockout", srv.UnlockUser)
+			r.Get("/users/{userId}/sessions", srv.GetUserSessions)
+			r.Delete("/users/{userId}/sessions", srv.RevokeUserSessions)
+			r.Delete("/users/{userId}/sessions/{sessionId}", srv.RevokeUserSession)
+			r.Get("/erasure-requests", srv.GetErasureRequests)
+			r.Post("/erasure-requests/{requestId}/erase", srv.EraseNow)
+			r.Get("/audit", srv.GetAuditLog)
+			r.Get("/audit.csv", srv.ExportAuditLog)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(srv.RequirePermission(models.PermissionAuthorLevels))
+			r.Post("/levels", srv.CreateLevel)
+			r.Put("/levels/{levelId}", srv.UpdateLevel)
+		})
 	})
 
+	// Public routes
 	router.Route("/", func(r chi.Router) {
 		r.Get("/leaderboard", srv.GetLeaderboard)
 		r.Get("/health", srv.HealthCheck)
+		r.Get("/.well-known/jwks.json", srv.GetJWKS)
 	})
 	return router
 }
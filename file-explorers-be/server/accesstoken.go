@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/service"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (c Server) GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.accessTokenService.List(ctx)
+	if err != nil {
+		writeAccessTokenError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Access tokens retrieved successfully")
+}
+
+func (c Server) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	var req models.AccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.accessTokenService.Create(ctx, req)
+	if err != nil {
+		writeAccessTokenError(w, err)
+		return
+	}
+
+	WriteCreated(w, data, "Access token created, copy it now as it will not be shown again")
+}
+
+func (c Server) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	tokenId, err := strconv.Atoi(chi.URLParam(r, "tokenId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid tokenId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.accessTokenService.Revoke(ctx, tokenId)
+	if err != nil {
+		writeAccessTokenError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Access token revoked")
+}
+
+func writeAccessTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrAccessTokenNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrScopeNotAllowed) {
+		WriteError(w, http.StatusForbidden, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrTooManyAccessTokens) {
+		WriteError(w, http.StatusConflict, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
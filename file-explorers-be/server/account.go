@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/service"
+	"net/http"
+)
+
+func (c Server) GetMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	profile, err := c.accountService.Me(ctx)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	WriteSuccess(w, profile, "Profile retrieved successfully")
+}
+
+func (c Server) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	var req models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	profile, err := c.accountService.Update(ctx, req, clientIP(r))
+	if writeThrottleError(w, err) {
+		return
+	}
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	message := "Profile updated successfully"
+	if req.Email != nil && profile.PendingEmail != "" {
+		message = "Profile updated, confirm the new email address with the link we sent to it"
+	}
+	WriteSuccess(w, profile, message)
+}
+
+func (c Server) ChangeMyPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	err := c.accountService.ChangePassword(ctx, req.OldPassword, req.NewPassword, clientIP(r))
+	if writeThrottleError(w, err) {
+		return
+	}
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Password changed successfully, please log in again")
+}
+
+func (c Server) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	deletion, err := c.accountService.Delete(ctx, req.Password, clientIP(r))
+	if writeThrottleError(w, err) {
+		return
+	}
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	WriteSuccess(w, deletion, "Your account will be deleted, log in again before then to keep it")
+}
+
+func (c Server) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	err := c.accountService.ConfirmEmail(r.URL.Query().Get("token"), clientIP(r))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "Email address changed, please log in again")
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		WriteError(w, http.StatusUnauthorized, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrGuestAccount) || errors.Is(err, service.ErrReauthRequired) {
+		WriteError(w, http.StatusForbidden, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrEmailTaken) {
+		WriteError(w, http.StatusConflict, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrTooManyEmails) {
+		WriteError(w, http.StatusTooManyRequests, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (c Server) GetRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.roleService.Roles(ctx)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Roles retrieved successfully")
+}
+
+func (c Server) SetRoleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.RoleTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.roleService.SetTwoFactor(ctx, chi.URLParam(r, "role"), req.Required)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Two-factor policy updated successfully")
+}
+
+func (c Server) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.roleService.UserRoles(ctx, userId)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "User roles retrieved successfully")
+}
+
+func (c Server) GrantUserRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.roleService.Grant(ctx, userId, req.Role)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Role granted successfully")
+}
+
+func (c Server) RevokeUserRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.roleService.Revoke(ctx, userId, chi.URLParam(r, "role"))
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Role revoked successfully")
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrRoleNotFound) || errors.Is(err, repository.ErrUserNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
+
+func (c Server) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.authService.UnlockUser(ctx, userId)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "User unlocked successfully")
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"file-explorers-be/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func (c Server) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.auditService.Search(ctx, filter)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Audit log retrieved successfully")
+}
+
+func (c Server) ExportAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.auditService.ExportCSV(ctx, filter)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// auditFilter reads the audit log filter from the query string. Times are
+// RFC 3339 or plain dates; a plain date for "to" includes the whole day.
+func auditFilter(query url.Values) (filter models.AuditFilter, err error) {
+	filter.Action = query.Get("action")
+	filter.TargetType = query.Get("target_type")
+	filter.TargetID = query.Get("target_id")
+	filter.IP = query.Get("ip")
+
+	if v := query.Get("actor_id"); v != "" {
+		actorId, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid actor_id")
+		}
+		filter.ActorID = &actorId
+	}
+	if v := query.Get("from"); v != "" {
+		from, _, err := parseAuditTime(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid from, use RFC 3339 or YYYY-MM-DD")
+		}
+		filter.From = &from
+	}
+	if v := query.Get("to"); v != "" {
+		to, date, err := parseAuditTime(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid to, use RFC 3339 or YYYY-MM-DD")
+		}
+		if date {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+	if v := query.Get("page"); v != "" {
+		filter.Page, err = strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid page")
+		}
+	}
+	if v := query.Get("per_page"); v != "" {
+		filter.PerPage, err = strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid per_page")
+		}
+	}
+	return filter, nil
+}
+
+func parseAuditTime(value string) (t time.Time, date bool, err error) {
+	t, err = time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, false, nil
+	}
+	t, err = time.Parse("2006-01-02", value)
+	return t, true, err
+}
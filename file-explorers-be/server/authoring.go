@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"file-explorers-be/service"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxLevelBody fits a level with a full filesystem of shell.MaxFiles files.
+const maxLevelBody = 1 << 20
+
+func (c Server) CreateLevel(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLevelBody)
+	var req models.LevelData
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.levelService.CreateLevel(ctx, req)
+	if err != nil {
+		writeLevelAuthorError(w, err)
+		return
+	}
+
+	WriteCreated(w, data, "Level created successfully")
+}
+
+func (c Server) UpdateLevel(w http.ResponseWriter, r *http.Request) {
+	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid levelId")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxLevelBody)
+	var req models.LevelData
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+	req.LevelID = levelId
+
+	ctx := r.Context()
+	data, err := c.levelService.UpdateLevel(ctx, req)
+	if err != nil {
+		writeLevelAuthorError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Level updated successfully")
+}
+
+func writeLevelAuthorError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrLevelNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	for _, invalid := range []error{service.ErrLevelType, service.ErrLevelName, service.ErrLevelDifficulty,
+		service.ErrLevelTooLarge, service.ErrNoLevelSolution, service.ErrInvalidLevel} {
+		if errors.Is(err, invalid) {
+			WriteError(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+	}
+	WriteError(w, http.StatusInternalServerError, err, "Failed to save level")
+}
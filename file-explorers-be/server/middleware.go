@@ -0,0 +1,165 @@
+package server
+
+import (
+	"file-explorers-be/service"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientAddress stores the caller's address in the request context, so
+// services can record where an action came from.
+func (c Server) ClientAddress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := service.WithClientIP(r.Context(), clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authenticate verifies the bearer token once per request and stores the
+// principal in the request context. Requests without a valid token never
+// reach the handlers of a group that uses it. Personal access tokens are
+// refused; see AuthenticateScoped.
+func (c Server) Authenticate(next http.Handler) http.Handler {
+	return c.authenticate("", next)
+}
+
+// AuthenticateScoped is Authenticate for routes that scripts may call as
+// well: a personal access token with the given scope is also accepted.
+func (c Server) AuthenticateScoped(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return c.authenticate(scope, next)
+	}
+}
+
+func (c Server) authenticate(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err, service.ErrUnauthenticated.Error())
+			return
+		}
+
+		if service.IsAccessToken(token) {
+			if scope == "" {
+				WriteError(w, http.StatusForbidden, service.ErrAccessTokenNotAccepted, service.ErrAccessTokenNotAccepted.Error())
+				return
+			}
+			principal, err := c.accessTokenService.Authenticate(token)
+			if err != nil {
+				WriteError(w, http.StatusUnauthorized, err, "Invalid or expired token")
+				return
+			}
+			if !principal.HasScope(scope) {
+				WriteError(w, http.StatusForbidden, service.ErrMissingScope, service.ErrMissingScope.Error())
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(service.WithPrincipal(r.Context(), principal)))
+			return
+		}
+
+		claims, err := c.jwtService.VerifyToken(token)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err, "Invalid or expired token")
+			return
+		}
+
+		if claims.SessionID != "" {
+			if err := c.sessionService.Touch(claims.SessionID, clientIP(r), r.UserAgent()); err != nil {
+				log.Println("Failed to record session activity:", err)
+			}
+		}
+
+		ctx := service.WithPrincipal(r.Context(), service.Principal{
+			UserID:        claims.UserID,
+			Username:      claims.Username,
+			Roles:         claims.Roles,
+			Permissions:   claims.Permissions,
+			EmailVerified: claims.EmailVerified,
+			Guest:         claims.Guest,
+			SessionID:     claims.SessionID,
+			TokenID:       claims.ID,
+			ExpiresAt:     claims.ExpiresAt.Time,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole lets the request through when the principal has any of the
+// given roles. It must run after Authenticate.
+func (c Server) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return c.require(func(principal service.Principal) bool {
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePermission lets the request through when one of the principal's
+// roles grants the permission. It must run after Authenticate.
+func (c Server) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return c.require(func(principal service.Principal) bool {
+		return principal.HasPermission(permission)
+	})
+}
+
+// RequireVerified keeps guests and accounts without a confirmed email
+// address out, unless the unverified account policy allows the latter in.
+// It must run after Authenticate.
+func (c Server) RequireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := service.PrincipalFromCtx(r.Context())
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err, err.Error())
+			return
+		}
+		if err := c.authService.CheckVerified(principal); err != nil {
+			WriteError(w, http.StatusForbidden, err, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c Server) require(allowed func(service.Principal) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := service.PrincipalFromCtx(r.Context())
+			if err != nil {
+				WriteError(w, http.StatusUnauthorized, err, err.Error())
+				return
+			}
+			if !allowed(principal) {
+				WriteError(w, http.StatusForbidden, service.ErrForbidden, service.ErrForbidden.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("no Authorization header")
+	}
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", fmt.Errorf("invalid Authorization header format")
+	}
+	return parts[1], nil
+}
+
+// clientIP is the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
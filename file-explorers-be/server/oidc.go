@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/oidc"
+	"file-explorers-be/repository"
+	"file-explorers-be/service"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// oidcStateCookie ties a sign-in at a provider to the browser that started
+// it, so a callback URL from someone else's sign-in can't be replayed in a
+// victim's browser.
+const oidcStateCookie = "oidc_state"
+
+func setOIDCState(w http.ResponseWriter, r *http.Request, state string) {
+	maxAge := 600
+	if state == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (c Server) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	WriteSuccess(w, c.oidcService.Providers(), "Providers retrieved successfully")
+}
+
+func (c Server) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	target, state, err := c.oidcService.LoginURL(ctx, chi.URLParam(r, "provider"), r.URL.Query().Get("redirect"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	setOIDCState(w, r, state)
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback is where the provider sends the browser back. Logins started
+// with a redirect continue in the app with the tokens in the URL fragment,
+// which never reaches a server; the others get the usual JSON response. A
+// link comes back with a link_token that the signed-in user has to confirm.
+func (c Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	var browserState string
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		browserState = cookie.Value
+	}
+	setOIDCState(w, r, "")
+
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		err := errors.New(q.Get("error"))
+		WriteError(w, http.StatusBadRequest, err, "Sign-in was cancelled or refused: "+q.Get("error_description"))
+		return
+	}
+
+	ctx := r.Context()
+	login, err := c.oidcService.Callback(ctx, chi.URLParam(r, "provider"), q.Get("code"), q.Get("state"), browserState)
+	if login.Redirect != "" {
+		fragment := url.Values{}
+		switch {
+		case err != nil:
+			fragment.Set("error", err.Error())
+		case login.Linked:
+			fragment.Set("linked", chi.URLParam(r, "provider"))
+		case login.LinkToken != "":
+			fragment.Set("link_token", login.LinkToken)
+		case login.Tokens.MFAToken != "":
+			fragment.Set("mfa_token", login.Tokens.MFAToken)
+		default:
+			fragment.Set("token", login.Tokens.AccessToken)
+			fragment.Set("refresh_token", login.Tokens.RefreshToken)
+			fragment.Set("expires_in", strconv.Itoa(login.Tokens.ExpiresIn))
+		}
+		http.Redirect(w, r, login.Redirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	if login.Linked {
+		WriteSuccess(w, nil, "Account linked successfully")
+		return
+	}
+	if login.LinkToken != "" {
+		WriteSuccess(w, map[string]interface{}{
+			"link_token": login.LinkToken,
+		}, "Confirm the link to finish linking your account")
+		return
+	}
+	if login.Tokens.MFAToken != "" {
+		WriteSuccess(w, authResponse(login.Tokens, login.User), "Enter the code from your authenticator app")
+		return
+	}
+	w.Header().Set("Authorization", "Bearer "+login.Tokens.AccessToken)
+	WriteSuccess(w, authResponse(login.Tokens, login.User), "Login successful")
+}
+
+// LinkOIDCIdentity hands out the provider URL to link an account with. The
+// app has to call it with credentials so the browser keeps the state cookie.
+func (c Server) LinkOIDCIdentity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	target, state, err := c.oidcService.LinkURL(ctx, chi.URLParam(r, "provider"), r.URL.Query().Get("redirect"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	setOIDCState(w, r, state)
+	WriteSuccess(w, map[string]interface{}{
+		"url": target,
+	}, "Continue at the provider to link your account")
+}
+
+func (c Server) ConfirmOIDCLink(w http.ResponseWriter, r *http.Request) {
+	var req models.OIDCLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	err := c.oidcService.ConfirmLink(ctx, chi.URLParam(r, "provider"), req.LinkToken)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Account linked successfully")
+}
+
+func (c Server) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.oidcService.Identities(ctx)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Linked accounts retrieved successfully")
+}
+
+func (c Server) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := c.oidcService.Unlink(ctx, chi.URLParam(r, "provider"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Account unlinked successfully")
+}
+
+func writeOIDCError(w http.ResponseWriter, err error) {
+	if errors.Is(err, oidc.ErrUnknownProvider) || errors.Is(err, repository.ErrIdentityNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrLinkOtherUser) {
+		WriteError(w, http.StatusForbidden, err, err.Error())
+		return
+	}
+	if errors.Is(err, oidc.ErrInvalidIDToken) {
+		WriteError(w, http.StatusUnauthorized, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"file-explorers-be/service"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (c Server) ExportMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	archive, filename, err := c.privacyService.Export(ctx)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(archive)
+}
+
+func (c Server) GetErasureRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.privacyService.ErasureRequests(ctx, r.URL.Query().Get("status"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Erasure requests retrieved successfully")
+}
+
+func (c Server) EraseNow(w http.ResponseWriter, r *http.Request) {
+	requestId, err := strconv.Atoi(chi.URLParam(r, "requestId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid requestId")
+		return
+	}
+
+	ctx := r.Context()
+	summary, err := c.privacyService.Erase(ctx, requestId)
+	if errors.Is(err, service.ErrErasureNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, map[string]interface{}{
+		"summary": summary,
+	}, "Account erased")
+}
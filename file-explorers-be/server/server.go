@@ -1,29 +1,82 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"file-explorers-be/logic"
 	"file-explorers-be/models"
+	"file-explorers-be/repository"
 	"file-explorers-be/service"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// maxCircuitBody bounds the request body of the circuit endpoints, which is
+// read before the circuit's own limits can be checked.
+const maxCircuitBody = 512 << 10
+
+// maxSynthesisBody fits a full truth table for every output.
+const maxSynthesisBody = 64 << 10
+
+// maxTerminalBody fits one command and maxTranscriptBody a full transcript;
+// the terminal service checks the command and transcript limits themselves.
+const (
+	maxTerminalBody   = 8 << 10
+	maxTranscriptBody = 1 << 20
+)
+
+// maxNetlistBody fits a boolean circuit of logic.MaxGates gates.
+const maxNetlistBody = 256 << 10
+
 type Server struct {
-	authService  service.AuthService
-	levelService service.LevelService
+	authService        service.AuthService
+	jwtService         service.JwtService
+	levelService       service.LevelService
+	terminalService    service.TerminalService
+	circuitService     service.CircuitService
+	logicService       service.LogicService
+	workspaceService   service.WorkspaceService
+	roleService        service.RoleService
+	oidcService        service.OIDCService
+	twoFactorService   service.TwoFactorService
+	accountService     service.AccountService
+	privacyService     service.PrivacyService
+	accessTokenService service.AccessTokenService
+	sessionService     service.SessionService
+	auditService       service.AuditService
 }
 
-func NewControllers(authService service.AuthService, levelService service.LevelService) Server {
+func NewControllers(authService service.AuthService, jwtService service.JwtService, levelService service.LevelService, terminalService service.TerminalService, circuitService service.CircuitService, logicService service.LogicService, workspaceService service.WorkspaceService, roleService service.RoleService, oidcService service.OIDCService, twoFactorService service.TwoFactorService, accountService service.AccountService, privacyService service.PrivacyService, accessTokenService service.AccessTokenService, sessionService service.SessionService, auditService service.AuditService) Server {
 	return Server{
-		authService:  authService,
-		levelService: levelService,
+		authService:        authService,
+		jwtService:         jwtService,
+		levelService:       levelService,
+		terminalService:    terminalService,
+		circuitService:     circuitService,
+		logicService:       logicService,
+		workspaceService:   workspaceService,
+		roleService:        roleService,
+		oidcService:        oidcService,
+		twoFactorService:   twoFactorService,
+		accountService:     accountService,
+		privacyService:     privacyService,
+		accessTokenService: accessTokenService,
+		sessionService:     sessionService,
+		auditService:       auditService,
 	}
 }
 
+// GetJWKS publishes the public keys access tokens are signed with in the
+// standard key set format, without the usual response envelope.
+func (c Server) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	WriteJSON(w, http.StatusOK, c.jwtService.JWKS())
+}
+
 func (c Server) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -31,17 +84,79 @@ func (c Server) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwt, user, err := c.authService.Authenticate(req.Username, req.Password)
+	tokens, user, err := c.authService.Authenticate(req.Username, req.Password, clientIP(r))
+	if writeThrottleError(w, err) {
+		return
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		WriteError(w, http.StatusForbidden, err, err.Error())
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusUnauthorized, err, err.Error())
 		return
 	}
+	if tokens.MFAToken != "" {
+		WriteSuccess(w, authResponse(tokens, user), "Enter the code from your authenticator app")
+		return
+	}
 
-	w.Header().Set("Authorization", "Bearer "+jwt)
-	WriteSuccess(w, map[string]interface{}{
-		"token": jwt,
-		"user":  user,
-	}, "Login successful")
+	response := authResponse(tokens, user)
+	if req.GuestToken != "" {
+		response["guest_merged"] = c.mergeGuest(user.ID, req.GuestToken)
+	}
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	WriteSuccess(w, response, "Login successful")
+}
+
+func (c Server) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	tokens, user, err := c.authService.Guest()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err, "Could not create a guest account")
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	WriteCreated(w, authResponse(tokens, user), "Playing as a guest")
+}
+
+func (c Server) UpgradeGuest(w http.ResponseWriter, r *http.Request) {
+	var req models.UpgradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	tokens, user, err := c.authService.Upgrade(ctx, req.Username, req.Email, req.Password)
+	if errors.Is(err, service.ErrNotGuest) {
+		WriteError(w, http.StatusConflict, err, err.Error())
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+	if tokens.AccessToken == "" {
+		WriteSuccess(w, map[string]interface{}{
+			"user": user,
+		}, "Account created, check your email to verify it")
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	WriteSuccess(w, authResponse(tokens, user), "Account created, your progress is saved")
+}
+
+// mergeGuest moves a guest's progress into the account that just signed
+// in. A failed merge does not fail the login; the response says whether it
+// worked.
+func (c Server) mergeGuest(userId int, guestToken string) bool {
+	if err := c.authService.MergeGuest(userId, guestToken); err != nil {
+		log.Println("Failed to merge guest account:", err)
+		return false
+	}
+	return true
 }
 
 func (c Server) Register(w http.ResponseWriter, r *http.Request) {
@@ -51,17 +166,159 @@ func (c Server) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwt, user, err := c.authService.Register(req.Username, req.Email, req.Password)
+	tokens, user, err := c.authService.Register(req.Username, req.Email, req.Password, clientIP(r))
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err, err.Error())
 		return
 	}
+	if tokens.AccessToken == "" {
+		WriteCreated(w, map[string]interface{}{
+			"user": user,
+		}, "Registration successful, check your email to verify your account")
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	WriteCreated(w, authResponse(tokens, user), "Registration successful")
+}
+
+func (c Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	tokens, user, err := c.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, err, err.Error())
+		return
+	}
 
-	w.Header().Set("Authorization", "Bearer "+jwt)
-	WriteCreated(w, map[string]interface{}{
-		"token": jwt,
-		"user":  user,
-	}, "Registration successful")
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	WriteSuccess(w, authResponse(tokens, user), "Token refreshed successfully")
+}
+
+func (c Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := c.authService.VerifyEmail(r.URL.Query().Get("token"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, map[string]interface{}{
+		"user": user,
+	}, "Email verified successfully")
+}
+
+func (c Server) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req models.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	err := c.authService.ResendVerification(req.Email)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "If the address belongs to an unverified account, a new link is on its way")
+}
+
+func (c Server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	// The outcome is logged rather than returned so the response is the
+	// same whether or not the address has an account.
+	if err := c.authService.ForgotPassword(req.Email); err != nil {
+		log.Println("Failed to send password reset email:", err)
+	}
+
+	WriteSuccess(w, nil, "If the address belongs to an account, a reset link is on its way")
+}
+
+func (c Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	err := c.authService.ResetPassword(req.Token, req.NewPassword, clientIP(r))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "Password reset successfully, please log in again")
+}
+
+func (c Server) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	err := c.authService.UnlockAccount(r.URL.Query().Get("token"), clientIP(r))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "Account unlocked, you can log in again")
+}
+
+func (c Server) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := c.authService.Logout(ctx)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "Logged out successfully")
+}
+
+func (c Server) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := c.authService.LogoutAll(ctx)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "Logged out of all sessions successfully")
+}
+
+// writeThrottleError answers 429 with a Retry-After header when the login
+// throttle refused the attempt, and reports whether it did.
+func writeThrottleError(w http.ResponseWriter, err error) bool {
+	var throttled *service.ThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(throttled.Seconds()))
+	WriteError(w, http.StatusTooManyRequests, err, err.Error())
+	return true
+}
+
+// authResponse is the body of every response that signs a user in. When a
+// second factor is still needed it only carries the MFA token.
+func authResponse(tokens models.AuthTokens, user models.User) map[string]interface{} {
+	if tokens.MFAToken != "" {
+		return map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    tokens.MFAToken,
+			"user":         user,
+		}
+	}
+	return map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          user,
+	}
 }
 
 func (c Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
@@ -71,17 +328,20 @@ func (c Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := c.authService.PasswordChange(req.Username, req.OldPassword, req.NewPassword)
+	err := c.authService.PasswordChange(req.Username, req.OldPassword, req.NewPassword, clientIP(r))
+	if writeThrottleError(w, err) {
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err, err.Error())
 		return
 	}
 
-	WriteSuccess(w, nil, "Password changed successfully")
+	WriteSuccess(w, nil, "Password changed successfully, please log in again")
 }
 
 func (c Server) GetLevelData(w http.ResponseWriter, r *http.Request) {
-	ctx := context.WithValue(r.Context(), service.ContextKeyHttpRequest, r)
+	ctx := r.Context()
 	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
 	if err != nil {
 		fmt.Println("[DEBUG GetLevelData] Invalid levelId:", err)
@@ -102,7 +362,7 @@ func (c Server) GetLevelData(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c Server) GetLevels(w http.ResponseWriter, r *http.Request) {
-	ctx := context.WithValue(r.Context(), service.ContextKeyHttpRequest, r)
+	ctx := r.Context()
 	data, err := c.levelService.GetLevels(ctx)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err, err.Error())
@@ -119,7 +379,7 @@ func (c Server) StartLevel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(r.Context(), service.ContextKeyHttpRequest, r)
+	ctx := r.Context()
 	data, err := c.levelService.SolvedLevel(ctx, levelId)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err, err.Error())
@@ -136,7 +396,7 @@ func (c Server) SolvedLevel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(r.Context(), service.ContextKeyHttpRequest, r)
+	ctx := r.Context()
 	data, err := c.levelService.SolvedLevel(ctx, levelId)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err, err.Error())
@@ -146,8 +406,245 @@ func (c Server) SolvedLevel(w http.ResponseWriter, r *http.Request) {
 	WriteSuccess(w, data, "Level marked as solved successfully")
 }
 
+func (c Server) RunTerminalCommand(w http.ResponseWriter, r *http.Request) {
+	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid levelId")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTerminalBody)
+	var req models.TerminalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.terminalService.Run(ctx, levelId, req.Command)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Command executed")
+}
+
+func (c Server) SubmitTranscript(w http.ResponseWriter, r *http.Request) {
+	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid levelId")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTranscriptBody)
+	var req models.TranscriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.terminalService.Replay(ctx, levelId, req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Transcript replayed")
+}
+
+func (c Server) SubmitBooleanCircuit(w http.ResponseWriter, r *http.Request) {
+	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid levelId")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxNetlistBody)
+	var req models.BooleanSubmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.logicService.Submit(ctx, levelId, req)
+	if err != nil {
+		writeBooleanError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit evaluated")
+}
+
+func (c Server) GetBooleanSolution(w http.ResponseWriter, r *http.Request) {
+	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid levelId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.logicService.Solution(ctx, levelId, r.URL.Query().Get("gateSet"))
+	if err != nil {
+		writeBooleanError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Reference circuit retrieved successfully")
+}
+
+func writeBooleanError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrLevelNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrLevelNotSolved) {
+		WriteError(w, http.StatusForbidden, err, err.Error())
+		return
+	}
+	for _, invalid := range []error{service.ErrNotBooleanLevel, service.ErrMissingNetlist, logic.ErrInvalidNetlist,
+		logic.ErrUnsupportedVersion, logic.ErrNoGates, logic.ErrTooManyGates, logic.ErrUnknownGateSet,
+		logic.ErrNoInputs, logic.ErrTooManyInputs, logic.ErrTooManyOutputs, logic.ErrNoOutputs,
+		logic.ErrExpressionTooLong} {
+		if errors.Is(err, invalid) {
+			WriteError(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+	}
+	WriteError(w, http.StatusInternalServerError, err, "Failed to process the circuit")
+}
+
+func (c Server) SynthesizeCircuit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSynthesisBody)
+	var req models.SynthesisRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.logicService.Synthesize(ctx, req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+	if !data.Minimal {
+		WriteSuccess(w, data, "Near-minimal circuit synthesised successfully")
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit synthesised successfully")
+}
+
+func (c Server) ResetTerminal(w http.ResponseWriter, r *http.Request) {
+	levelId, err := strconv.Atoi(chi.URLParam(r, "levelId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid levelId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.terminalService.Reset(ctx, levelId)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, nil, "Terminal reset successfully")
+}
+
+func (c Server) GetCircuitProgress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.circuitService.GetProgress(ctx)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit challenges retrieved successfully")
+}
+
+func (c Server) GetCircuitChallenge(w http.ResponseWriter, r *http.Request) {
+	challengeId, err := strconv.Atoi(chi.URLParam(r, "challengeId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid challengeId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.circuitService.GetChallenge(ctx, challengeId)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit challenge retrieved successfully")
+}
+
+func (c Server) CompleteCircuitChallenge(w http.ResponseWriter, r *http.Request) {
+	challengeId, err := strconv.Atoi(chi.URLParam(r, "challengeId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid challengeId")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCircuitBody)
+	var req models.CircuitSubmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.circuitService.CompleteChallenge(ctx, challengeId, req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit challenge completed successfully")
+}
+
+func (c Server) EvaluateCircuit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCircuitBody)
+	var req models.CircuitSubmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.circuitService.Evaluate(ctx, req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit evaluated successfully")
+}
+
+func (c Server) SimulateCircuit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCircuitBody)
+	var req models.CircuitSimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.circuitService.Simulate(ctx, req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Circuit simulated successfully")
+}
+
 func (c Server) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
-	ctx := context.WithValue(r.Context(), service.ContextKeyHttpRequest, r)
+	ctx := r.Context()
 
 	// Get timeFilter query parameter (default to "all")
 	timeFilter := r.URL.Query().Get("timeFilter")
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"file-explorers-be/service"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (c Server) GetSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.sessionService.List(ctx)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Sessions retrieved successfully")
+}
+
+func (c Server) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := c.sessionService.Revoke(ctx, chi.URLParam(r, "sessionId"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Session ended")
+}
+
+func (c Server) GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.sessionService.UserSessions(ctx, userId)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Sessions retrieved successfully")
+}
+
+func (c Server) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.sessionService.RevokeUserSession(ctx, userId, chi.URLParam(r, "sessionId"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Session ended")
+}
+
+func (c Server) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid userId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.sessionService.RevokeUserSessions(ctx, userId)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "All sessions of the user ended")
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrSessionNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/service"
+	"net/http"
+)
+
+func (c Server) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.twoFactorService.Setup(ctx)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Scan the code with your authenticator app, then confirm with a code from it")
+}
+
+func (c Server) GetTwoFactorQRCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	png, err := c.twoFactorService.QRCode(ctx)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+func (c Server) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.twoFactorService.Enable(ctx, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	response := authResponse(data.Tokens, data.User)
+	response["recovery_codes"] = data.RecoveryCodes
+	w.Header().Set("Authorization", "Bearer "+data.Tokens.AccessToken)
+	WriteSuccess(w, response, "Two-factor authentication enabled, store the recovery codes somewhere safe")
+}
+
+func (c Server) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	tokens, user, err := c.twoFactorService.Verify(req.MFAToken, req.Code, clientIP(r))
+	if writeThrottleError(w, err) {
+		return
+	}
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	response := authResponse(tokens, user)
+	if req.GuestToken != "" {
+		response["guest_merged"] = c.mergeGuest(user.ID, req.GuestToken)
+	}
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	WriteSuccess(w, response, "Login successful")
+}
+
+func (c Server) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	err := c.twoFactorService.Disable(ctx, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Two-factor authentication disabled")
+}
+
+func (c Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid request")
+		return
+	}
+
+	ctx := r.Context()
+	codes, err := c.twoFactorService.RecoveryCodes(ctx, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	WriteSuccess(w, map[string]interface{}{
+		"recovery_codes": codes,
+	}, "New recovery codes generated, the old ones no longer work")
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrInvalidTwoFactorCode) || errors.Is(err, service.ErrInvalidMFAToken) {
+		WriteError(w, http.StatusUnauthorized, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrTwoFactorEnabled) {
+		WriteError(w, http.StatusConflict, err, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		WriteError(w, http.StatusForbidden, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"file-explorers-be/service"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWorkspaceBody leaves room for the name and kind next to the content,
+// whose own limit is checked once it is decoded.
+const maxWorkspaceBody = service.MaxWorkspaceSize + 4<<10
+
+func (c Server) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.workspaceService.List(ctx)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Workspaces retrieved successfully")
+}
+
+func (c Server) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxWorkspaceBody)
+	var req models.WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeWorkspaceBodyError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.Create(ctx, req)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteCreated(w, data, "Workspace created successfully")
+}
+
+func (c Server) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.Get(ctx, workspaceId)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Workspace retrieved successfully")
+}
+
+func (c Server) UpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWorkspaceBody)
+	var req models.WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeWorkspaceBodyError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.Update(ctx, workspaceId, req)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Workspace saved successfully")
+}
+
+func (c Server) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.workspaceService.Delete(ctx, workspaceId)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Workspace deleted successfully")
+}
+
+func (c Server) GetWorkspaceVersions(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.Versions(ctx, workspaceId)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Workspace versions retrieved successfully")
+}
+
+func (c Server) GetWorkspaceVersion(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid version")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.Version(ctx, workspaceId, version)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+
+	WriteSuccess(w, data, "Workspace version retrieved successfully")
+}
+
+func (c Server) ShareWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.Share(ctx, workspaceId)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Share link created successfully")
+}
+
+func (c Server) UnshareWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	ctx := r.Context()
+	err = c.workspaceService.Unshare(ctx, workspaceId)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, nil, "Share link removed successfully")
+}
+
+func (c Server) GetSharedWorkspace(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	data, err := c.workspaceService.GetShared(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	WriteSuccess(w, data, "Shared workspace retrieved successfully")
+}
+
+func (c Server) ExportWorkspaceSPICE(w http.ResponseWriter, r *http.Request) {
+	workspaceId, err := strconv.Atoi(chi.URLParam(r, "workspaceId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, "Invalid workspaceId")
+		return
+	}
+
+	ctx := r.Context()
+	name, deck, err := c.workspaceService.ExportSPICE(ctx, workspaceId)
+	if err != nil {
+		writeWorkspaceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".cir"}))
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, deck)
+}
+
+// ImportWorkspaceSPICE takes the deck as the raw request body; the workspace
+// name can be given with ?name=.
+func (c Server) ImportWorkspaceSPICE(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxWorkspaceSize+1)
+	deck, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeWorkspaceBodyError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	data, err := c.workspaceService.ImportSPICE(ctx, r.URL.Query().Get("name"), string(deck))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	WriteCreated(w, data, "SPICE netlist imported successfully")
+}
+
+func writeWorkspaceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrWorkspaceNotFound) {
+		WriteError(w, http.StatusNotFound, err, err.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, err.Error())
+}
+
+// writeWorkspaceBodyError answers a request body that could not be read,
+// telling an oversized workspace apart from malformed input.
+func writeWorkspaceBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(w, http.StatusRequestEntityTooLarge, err, service.ErrWorkspaceTooLarge.Error())
+		return
+	}
+	WriteError(w, http.StatusBadRequest, err, "Invalid request")
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidAccessToken     = fmt.Errorf("Invalid, expired or revoked access token")
+	ErrAccessTokenNotFound    = fmt.Errorf("Access token not found")
+	ErrAccessTokenNotAccepted = fmt.Errorf("Personal access tokens cannot be used here, log in instead")
+	ErrMissingScope           = fmt.Errorf("The access token does not have the scope for this")
+	ErrInvalidTokenName       = fmt.Errorf("Give the token a name of up to 100 characters")
+	ErrInvalidScope           = fmt.Errorf("Unknown scope, use read:progress, write:levels or admin:users")
+	ErrScopeNotAllowed        = fmt.Errorf("Your roles do not allow the admin:users scope")
+	ErrInvalidTokenExpiry     = fmt.Errorf("Tokens expire after 1 to 365 days")
+	ErrTooManyAccessTokens    = fmt.Errorf("You have too many access tokens, revoke one first")
+)
+
+const (
+	// accessTokenPrefix tells personal access tokens apart from JWTs, and
+	// makes them easy to spot by secret scanners.
+	accessTokenPrefix = "fe_pat_"
+	// accessTokenShownPrefix is how much of a token is kept to recognise it.
+	accessTokenShownPrefix = len(accessTokenPrefix) + 5
+
+	defaultAccessTokenDays = 30
+	maxAccessTokenDays     = 365
+	maxAccessTokens        = 20
+	maxTokenName           = 100
+)
+
+// IsAccessToken reports whether a bearer token is a personal access token
+// rather than a JWT.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+type AccessTokenService interface {
+	Create(ctx context.Context, req models.AccessTokenRequest) (created models.CreatedAccessToken, err error)
+	List(ctx context.Context) (tokens []models.AccessToken, err error)
+	Revoke(ctx context.Context, tokenId int) (err error)
+	Authenticate(token string) (principal Principal, err error)
+}
+
+type accessTokenService struct {
+	repo     repository.AccessTokenRepository
+	authRepo repository.AuthRepository
+	roleRepo repository.RoleRepository
+	audit    AuditLogger
+}
+
+func NewAccessTokenService(repo repository.AccessTokenRepository, authRepo repository.AuthRepository, roleRepo repository.RoleRepository, audit AuditLogger) AccessTokenService {
+	return &accessTokenService{
+		repo:     repo,
+		authRepo: authRepo,
+		roleRepo: roleRepo,
+		audit:    audit,
+	}
+}
+
+// Create issues a personal access token. The token is returned once; only
+// its hash is stored.
+func (s *accessTokenService) Create(ctx context.Context, req models.AccessTokenRequest) (created models.CreatedAccessToken, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxTokenName {
+		return created, ErrInvalidTokenName
+	}
+	scopes, err := checkScopes(principal, req.Scopes)
+	if err != nil {
+		return
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAccessTokenDays
+	}
+	if days < 1 || days > maxAccessTokenDays {
+		return created, ErrInvalidTokenExpiry
+	}
+
+	count, err := s.repo.CountAccessTokens(principal.UserID)
+	if err != nil {
+		return
+	}
+	if count >= maxAccessTokens {
+		return created, ErrTooManyAccessTokens
+	}
+
+	token, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+	token = accessTokenPrefix + token
+	expiresAt := time.Now().AddDate(0, 0, days)
+
+	id, err := s.repo.CreateAccessToken(principal.UserID, name, token[:accessTokenShownPrefix], hashToken(token), scopes, expiresAt)
+	if err != nil {
+		return
+	}
+	entry := auditEntry(ctx, models.AuditTokenCreate, models.AuditTargetToken, strconv.Itoa(id))
+	entry.Details = map[string]interface{}{"name": name, "scopes": scopes, "expires_at": expiresAt}
+	s.audit.Log(entry)
+	return models.CreatedAccessToken{
+		AccessToken: models.AccessToken{
+			ID:        id,
+			UserID:    principal.UserID,
+			Name:      name,
+			Prefix:    token[:accessTokenShownPrefix],
+			Scopes:    scopes,
+			ExpiresAt: expiresAt,
+			CreatedAt: time.Now(),
+		},
+		Token: token,
+	}, nil
+}
+
+func (s *accessTokenService) List(ctx context.Context) (tokens []models.AccessToken, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.ListAccessTokens(principal.UserID)
+}
+
+func (s *accessTokenService) Revoke(ctx context.Context, tokenId int) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	err = s.repo.RevokeAccessToken(principal.UserID, tokenId)
+	if err == repository.ErrAccessTokenNotFound {
+		return ErrAccessTokenNotFound
+	}
+	if err != nil {
+		return
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditTokenRevoke, models.AuditTargetToken, strconv.Itoa(tokenId)))
+	return nil
+}
+
+// Authenticate turns a personal access token into a principal. Roles are
+// read fresh on every request, so revoking a role takes effect at once.
+func (s *accessTokenService) Authenticate(token string) (principal Principal, err error) {
+	data, err := s.repo.GetAccessToken(hashToken(token))
+	if err == repository.ErrAccessTokenNotFound {
+		return principal, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return
+	}
+	user, err := s.authRepo.GetUser(data.UserID)
+	if err != nil {
+		return
+	}
+	roles, permissions, err := s.roleRepo.UserPermissions(user.ID, user.TwoFactorEnabled)
+	if err != nil {
+		return
+	}
+	if err := s.repo.TouchAccessToken(data.ID); err != nil {
+		log.Println("Failed to record access token use:", err)
+	}
+
+	return Principal{
+		UserID:        user.ID,
+		Username:      user.Username,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerified,
+		Guest:         user.Guest,
+		AccessTokenID: data.ID,
+		Scopes:        data.Scopes,
+		ExpiresAt:     data.ExpiresAt,
+	}, nil
+}
+
+// checkScopes drops duplicates and refuses unknown scopes, and scopes the
+// caller's roles could not use anyway.
+func checkScopes(principal Principal, requested []string) (scopes []string, err error) {
+	seen := map[string]bool{}
+	for _, scope := range requested {
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+
+		switch scope {
+		case models.ScopeReadProgress, models.ScopeWriteLevels:
+		case models.ScopeAdminUsers:
+			if !principal.HasPermission(models.PermissionModerateUsers) && !principal.HasPermission(models.PermissionManageRoles) {
+				return nil, ErrScopeNotAllowed
+			}
+		default:
+			return nil, ErrInvalidScope
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	return scopes, nil
+}
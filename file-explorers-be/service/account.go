@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"file-explorers-be/config"
+	"file-explorers-be/mail"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidDisplayName = fmt.Errorf("Display names can be up to 50 characters")
+	ErrInvalidBio         = fmt.Errorf("The bio can be up to 500 characters")
+	ErrInvalidAvatar      = fmt.Errorf("The avatar must be an https URL")
+	ErrInvalidLanguage    = fmt.Errorf("Unknown language")
+	ErrInvalidEmail       = fmt.Errorf("Invalid email address")
+	ErrEmailTaken         = fmt.Errorf("This email address is already in use")
+)
+
+const (
+	purposeChangeEmail = "change_email"
+
+	maxDisplayName = 50
+	maxBio         = 500
+	maxAvatarURL   = 255
+	maxEmail       = 100
+)
+
+// languagePattern accepts language tags such as "en" or "sl-SI".
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+type AccountService interface {
+	Me(ctx context.Context) (profile models.Profile, err error)
+	Update(ctx context.Context, update models.ProfileUpdate, ip string) (profile models.Profile, err error)
+	ConfirmEmail(token, ip string) (err error)
+	ChangePassword(ctx context.Context, old, password, ip string) (err error)
+	Delete(ctx context.Context, password, ip string) (deletion models.AccountDeletion, err error)
+}
+
+type accountService struct {
+	repo         repository.AccountRepository
+	authRepo     repository.AuthRepository
+	privacyRepo  repository.PrivacyRepository
+	tokenRepo    repository.TokenRepository
+	authService  AuthService
+	audit        AuditLogger
+	mailer       mail.Mailer
+	publicURL    string
+	deletionDays int
+}
+
+func NewAccountService(repo repository.AccountRepository, authRepo repository.AuthRepository, privacyRepo repository.PrivacyRepository, tokenRepo repository.TokenRepository, authService AuthService, audit AuditLogger, mailer mail.Mailer, cfg config.Config) AccountService {
+	return &accountService{
+		repo:         repo,
+		authRepo:     authRepo,
+		privacyRepo:  privacyRepo,
+		tokenRepo:    tokenRepo,
+		authService:  authService,
+		audit:        audit,
+		mailer:       mailer,
+		publicURL:    cfg.PublicURL,
+		deletionDays: cfg.AccountDeletionDays,
+	}
+}
+
+func (s *accountService) Me(ctx context.Context) (profile models.Profile, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	user, err := s.authRepo.GetUser(principal.UserID)
+	if err != nil {
+		return
+	}
+	profile, err = s.repo.GetProfile(principal.UserID)
+	if err != nil {
+		return
+	}
+	user.Roles = principal.Roles
+	user.Permissions = principal.Permissions
+	profile.User = user
+	return profile, nil
+}
+
+// Update changes the profile. A new email address needs the password, since
+// whoever controls the address can reset it; it only takes effect once the
+// link sent to it is opened, and the old address is told about the change.
+func (s *accountService) Update(ctx context.Context, update models.ProfileUpdate, ip string) (profile models.Profile, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	err = validateProfile(&update)
+	if err != nil {
+		return
+	}
+	if update.Email != nil && !principal.Guest {
+		user, err := s.authRepo.GetUser(principal.UserID)
+		if err != nil {
+			return profile, err
+		}
+		if !strings.EqualFold(*update.Email, user.Email) {
+			_, err = s.authService.Reauthenticate(principal, update.Password, ip)
+			if err != nil {
+				return profile, err
+			}
+		}
+	}
+
+	err = s.repo.UpdateProfile(principal.UserID, update)
+	if err != nil {
+		return
+	}
+	if update.Email != nil {
+		err = s.changeEmail(principal, *update.Email)
+		if err != nil {
+			return
+		}
+	}
+	return s.Me(ctx)
+}
+
+// ConfirmEmail switches to the new address with the link from the email.
+// Tokens carry the address, so they are made stale.
+func (s *accountService) ConfirmEmail(token, ip string) (err error) {
+	userId, err := s.tokenRepo.UseEmailToken(purposeChangeEmail, hashToken(token))
+	if err == repository.ErrEmailTokenNotFound {
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		return
+	}
+
+	err = s.repo.ConfirmEmailChange(userId)
+	if err == repository.ErrEmailTokenNotFound {
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		return
+	}
+	user, err := s.authRepo.GetUser(userId)
+	if err != nil {
+		return
+	}
+	s.audit.Log(userAuditEntry(user, models.AuditEmailChange, ip))
+	return s.tokenRepo.BumpTokenVersion(userId)
+}
+
+// ChangePassword is the password change for the signed-in user. Like the
+// other password changes it signs out every session.
+func (s *accountService) ChangePassword(ctx context.Context, old, password, ip string) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	user, err := s.authRepo.GetUser(principal.UserID)
+	if err != nil {
+		return
+	}
+	return s.authService.PasswordChange(user.Username, old, password, ip)
+}
+
+// Delete files an erasure request for the account and signs it out
+// everywhere. Signing in again before the grace period ends keeps the
+// account.
+func (s *accountService) Delete(ctx context.Context, password, ip string) (deletion models.AccountDeletion, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	user, err := s.authService.Reauthenticate(principal, password, ip)
+	if err != nil {
+		return
+	}
+
+	deletion.DeleteAt = time.Now().AddDate(0, 0, s.deletionDays)
+	err = s.privacyRepo.RequestErasure(user.ID, deletion.DeleteAt)
+	if err != nil {
+		return
+	}
+	entry := userAuditEntry(user, models.AuditDeleteRequest, ip)
+	entry.Details = map[string]interface{}{"erase_after": deletion.DeleteAt}
+	s.audit.Log(entry)
+	err = s.tokenRepo.RevokeUserTokens(user.ID)
+	if err != nil {
+		return
+	}
+
+	if user.Email != "" {
+		err := s.mailer.Send(mail.Message{
+			To:      user.Email,
+			Subject: "Your File Explorers account will be deleted",
+			Body: fmt.Sprintf("Hi %s,\n\n"+
+				"your account and everything you made will be deleted on %s. "+
+				"If you change your mind, just log in again before then.\n",
+				user.Username, deletion.DeleteAt.Format("2 January 2006")),
+		})
+		if err != nil {
+			log.Println("Failed to send account deletion email:", err)
+		}
+	}
+	return deletion, nil
+}
+
+func (s *accountService) changeEmail(principal Principal, email string) (err error) {
+	if principal.Guest {
+		return ErrGuestAccount
+	}
+	user, err := s.authRepo.GetUser(principal.UserID)
+	if err != nil {
+		return
+	}
+	if strings.EqualFold(email, user.Email) {
+		return s.repo.SetPendingEmail(user.ID, "")
+	}
+	if existing, err := s.authRepo.GetUserByEmail(email); err == nil && existing.ID != 0 {
+		return ErrEmailTaken
+	}
+
+	count, last, err := s.tokenRepo.EmailTokenStats(user.ID, purposeChangeEmail, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= maxVerificationsPerDay || (last != nil && time.Since(*last) < verificationResendDelay) {
+		return ErrTooManyEmails
+	}
+
+	err = s.repo.SetPendingEmail(user.ID, email)
+	if err != nil {
+		return
+	}
+
+	token, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+	err = s.tokenRepo.CreateEmailToken(user.ID, purposeChangeEmail, hashToken(token), time.Now().Add(verificationTTL))
+	if err != nil {
+		return
+	}
+
+	link := s.publicURL + "/auth/confirm-email?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Confirm your new File Explorers email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"please confirm your new email address by opening this link:\n\n%s\n\n"+
+			"The link expires in 24 hours. Until then your old address stays in use.\n",
+			user.Username, link),
+	})
+	if err != nil {
+		return
+	}
+
+	if user.Email != "" {
+		err := s.mailer.Send(mail.Message{
+			To:      user.Email,
+			Subject: "Your File Explorers email address is being changed",
+			Body: fmt.Sprintf("Hi %s,\n\n"+
+				"someone asked to change the email address of your account to %s. "+
+				"If it was not you, reset your password right away.\n",
+				user.Username, email),
+		})
+		if err != nil {
+			log.Println("Failed to send email change notice:", err)
+		}
+	}
+	return nil
+}
+
+// validateProfile trims the update and checks every field that is set.
+func validateProfile(update *models.ProfileUpdate) error {
+	for _, field := range []*string{update.DisplayName, update.Email, update.AvatarURL, update.Bio, update.Language} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+
+	if update.DisplayName != nil && utf8.RuneCountInString(*update.DisplayName) > maxDisplayName {
+		return ErrInvalidDisplayName
+	}
+	if update.Bio != nil && utf8.RuneCountInString(*update.Bio) > maxBio {
+		return ErrInvalidBio
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		u, err := url.Parse(*update.AvatarURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(*update.AvatarURL) > maxAvatarURL {
+			return ErrInvalidAvatar
+		}
+	}
+	if update.Language != nil && !languagePattern.MatchString(*update.Language) {
+		return ErrInvalidLanguage
+	}
+	if update.Email != nil {
+		at := strings.LastIndex(*update.Email, "@")
+		if at < 1 || at == len(*update.Email)-1 || len(*update.Email) > maxEmail {
+			return ErrInvalidEmail
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"file-explorers-be/config"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditPerPage = 50
+	maxAuditPerPage     = 200
+	// maxAuditExport caps a CSV export; narrow the filter for more.
+	maxAuditExport = 10000
+)
+
+// AuditLogger records security relevant events. Writing the log never fails
+// the action that is logged; problems go to the server log instead.
+type AuditLogger interface {
+	Log(entry models.AuditEntry)
+}
+
+type auditLogger struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditLogger(repo repository.AuditRepository) AuditLogger {
+	return &auditLogger{
+		repo: repo,
+	}
+}
+
+func (l *auditLogger) Log(entry models.AuditEntry) {
+	if err := l.repo.AppendAudit(entry); err != nil {
+		log.Printf("Failed to write audit entry %s: %v\n", entry.Action, err)
+	}
+}
+
+// auditEntry starts an entry for something the signed-in user did, from the
+// address the request came from. The target may be left empty.
+func auditEntry(ctx context.Context, action, targetType, targetId string) models.AuditEntry {
+	entry := models.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetId,
+		IP:         ClientIPFromCtx(ctx),
+	}
+	if principal, err := PrincipalFromCtx(ctx); err == nil {
+		entry.ActorID = &principal.UserID
+	}
+	return entry
+}
+
+// userAuditEntry starts an entry for something a user did before they were
+// signed in, such as logging in.
+func userAuditEntry(user models.User, action, ip string) models.AuditEntry {
+	userId := user.ID
+	return models.AuditEntry{
+		ActorID:    &userId,
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		IP:         ip,
+	}
+}
+
+type AuditService interface {
+	Search(ctx context.Context, filter models.AuditFilter) (page models.AuditPage, err error)
+	ExportCSV(ctx context.Context, filter models.AuditFilter) (data []byte, err error)
+	PurgeIPs() (purged int64, err error)
+}
+
+type auditService struct {
+	repo        repository.AuditRepository
+	audit       AuditLogger
+	ipRetention int
+}
+
+func NewAuditService(repo repository.AuditRepository, audit AuditLogger, cfg config.Config) AuditService {
+	return &auditService{
+		repo:        repo,
+		audit:       audit,
+		ipRetention: cfg.AuditIPRetentionDays,
+	}
+}
+
+func (s *auditService) Search(ctx context.Context, filter models.AuditFilter) (page models.AuditPage, err error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PerPage < 1 {
+		filter.PerPage = defaultAuditPerPage
+	}
+	if filter.PerPage > maxAuditPerPage {
+		filter.PerPage = maxAuditPerPage
+	}
+
+	total, err := s.repo.CountAudit(filter)
+	if err != nil {
+		return
+	}
+	entries, err := s.repo.SearchAudit(filter, filter.PerPage, (filter.Page-1)*filter.PerPage)
+	if err != nil {
+		return
+	}
+	return models.AuditPage{
+		Entries: entries,
+		Page:    filter.Page,
+		PerPage: filter.PerPage,
+		Total:   total,
+	}, nil
+}
+
+// ExportCSV writes the matching entries, newest first, as CSV. Exports are
+// logged too, since they copy other users' data out of the system.
+func (s *auditService) ExportCSV(ctx context.Context, filter models.AuditFilter) (data []byte, err error) {
+	entries, err := s.repo.SearchAudit(filter, maxAuditExport, 0)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err = w.Write([]string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "ip", "details"})
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		actorId := ""
+		if entry.ActorID != nil {
+			actorId = strconv.Itoa(*entry.ActorID)
+		}
+		details := ""
+		if len(entry.Details) > 0 {
+			b, err := json.Marshal(entry.Details)
+			if err != nil {
+				return nil, err
+			}
+			details = string(b)
+		}
+		err = w.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+			actorId,
+			csvSafe(entry.ActorName),
+			entry.Action,
+			entry.TargetType,
+			csvSafe(entry.TargetID),
+			entry.IP,
+			csvSafe(details),
+		})
+		if err != nil {
+			return
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return
+	}
+
+	entry := auditEntry(ctx, models.AuditLogExport, "", "")
+	entry.Details = map[string]interface{}{"rows": len(entries)}
+	s.audit.Log(entry)
+	return buf.Bytes(), nil
+}
+
+// PurgeIPs forgets the addresses of entries past the retention window.
+func (s *auditService) PurgeIPs() (purged int64, err error) {
+	if s.ipRetention == 0 {
+		return 0, nil
+	}
+	return s.repo.PurgeAuditIPs(s.ipRetention)
+}
+
+// csvSafe keeps spreadsheet programs from running user supplied text, such
+// as a username, as a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -1,74 +1,252 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"file-explorers-be/config"
+	"file-explorers-be/mail"
 	"file-explorers-be/models"
 	"file-explorers-be/repository"
 	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrInvalidCredentials = fmt.Errorf("Invalid username or password")
+	ErrInvalidCredentials  = fmt.Errorf("Invalid username or password")
+	ErrInvalidRefreshToken = fmt.Errorf("Invalid or expired refresh token")
+	ErrRefreshTokenReused  = fmt.Errorf("Refresh token was already used, please log in again")
+	ErrEmailNotVerified    = fmt.Errorf("Please verify your email address first")
+	ErrInvalidEmailToken   = fmt.Errorf("This link is invalid or has expired")
+	ErrTooManyEmails       = fmt.Errorf("Too many emails sent, please try again later")
+	ErrEmailInUse          = fmt.Errorf("An account with this email already exists, sign in and link your account from there")
+	ErrMissingEmail        = fmt.Errorf("The provider did not share an email address")
+	ErrGuestAccount        = fmt.Errorf("Create an account to use this feature")
+	ErrNotGuest            = fmt.Errorf("Only guest accounts can be upgraded or merged")
+	ErrReauthRequired      = fmt.Errorf("Sign in again to confirm this change")
+)
+
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+	purposeUnlockAccount = "unlock_account"
+
+	verificationTTL         = 24 * time.Hour
+	verificationResendDelay = time.Minute
+	maxVerificationsPerDay  = 5
+
+	resetTTL         = time.Hour
+	resetResendDelay = time.Minute
+	maxResetsPerDay  = 5
+
+	unlockTTL        = 24 * time.Hour
+	maxUnlocksPerDay = 5
+
+	// reauthWindow is how recently an account without a password must have
+	// signed in to confirm a sensitive change.
+	reauthWindow = 5 * time.Minute
 )
 
 type AuthService interface {
-	Authenticate(username, password string) (jwt string, user models.User, err error)
-	Register(username, email, password string) (jwt string, user models.User, err error)
-	PasswordChange(username, old, password string) (err error)
+	Authenticate(username, password, ip string) (tokens models.AuthTokens, user models.User, err error)
+	Register(username, email, password, ip string) (tokens models.AuthTokens, user models.User, err error)
+	Refresh(refreshToken string) (tokens models.AuthTokens, user models.User, err error)
+	Logout(ctx context.Context) (err error)
+	LogoutAll(ctx context.Context) (err error)
+	PasswordChange(username, old, password, ip string) (err error)
+	SeedAdmin(username, email, password string) (err error)
+	VerifyEmail(token string) (user models.User, err error)
+	ResendVerification(email string) (err error)
+	CheckVerified(principal Principal) (err error)
+	PurgeUnverified() (purged int64, err error)
+	ForgotPassword(email string) (err error)
+	ResetPassword(token, password, ip string) (err error)
+	SignIn(userId int) (tokens models.AuthTokens, user models.User, err error)
+	StartSession(userId int) (tokens models.AuthTokens, user models.User, err error)
+	CreateExternalUser(name, email string, verified bool) (user models.User, err error)
+	CheckLogin(ip, username string) (err error)
+	LoginFailed(ip, username string) (err error)
+	UnlockAccount(token, ip string) (err error)
+	UnlockUser(ctx context.Context, userId int) (err error)
+	Guest() (tokens models.AuthTokens, user models.User, err error)
+	Upgrade(ctx context.Context, username, email, password string) (tokens models.AuthTokens, user models.User, err error)
+	MergeGuest(userId int, guestToken string) (err error)
+	PurgeGuests() (purged int64, err error)
+	Reauthenticate(principal Principal, password, ip string) (user models.User, err error)
 }
 
 type authService struct {
-	jwtService JwtService
-	repo       repository.AuthRepository
+	jwtService  JwtService
+	repo        repository.AuthRepository
+	tokenRepo   repository.TokenRepository
+	roleRepo    repository.RoleRepository
+	sessionRepo repository.SessionRepository
+	throttle    LoginThrottle
+	audit       AuditLogger
+	mailer      mail.Mailer
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	publicURL   string
+	appURL      string
+	policy      string
+	purgeDays   int
+	guestDays   int
 }
 
-func NewAuthService(repo repository.AuthRepository, jwtService JwtService) AuthService {
+func NewAuthService(repo repository.AuthRepository, tokenRepo repository.TokenRepository, roleRepo repository.RoleRepository, sessionRepo repository.SessionRepository, jwtService JwtService, throttle LoginThrottle, audit AuditLogger, mailer mail.Mailer, cfg config.Config) AuthService {
 	return &authService{
-		repo:       repo,
-		jwtService: jwtService,
+		repo:        repo,
+		tokenRepo:   tokenRepo,
+		roleRepo:    roleRepo,
+		sessionRepo: sessionRepo,
+		jwtService:  jwtService,
+		throttle:    throttle,
+		audit:       audit,
+		accessTTL:   cfg.AccessTokenTTL,
+		refreshTTL:  cfg.RefreshTokenTTL,
+		mailer:      mailer,
+		publicURL:   cfg.PublicURL,
+		appURL:      cfg.AppURL,
+		policy:      cfg.UnverifiedPolicy,
+		purgeDays:   cfg.UnverifiedPurgeDays,
+		guestDays:   cfg.GuestPurgeDays,
 	}
 }
 
-func (s *authService) Authenticate(username, password string) (jwt string, user models.User, err error) {
-	data, err := s.repo.Authenticate(username)
+// Authenticate checks the password from the login form. Attempts from the
+// same address or on the same account are throttled.
+func (s *authService) Authenticate(username, password, ip string) (tokens models.AuthTokens, user models.User, err error) {
+	data, err := s.verifyThrottled(username, password, ip)
 	if err != nil {
 		return
 	}
+	tokens, user, err = s.login(data)
+	if err == nil && tokens.AccessToken != "" {
+		entry := userAuditEntry(user, models.AuditLogin, ip)
+		entry.Details = map[string]interface{}{"method": "password"}
+		s.audit.Log(entry)
+	}
+	return
+}
 
-	if !s.checkPasswordHash(password, data.Password) {
-		return "", models.User{}, ErrInvalidCredentials
+func (s *authService) Register(username, email, password, ip string) (tokens models.AuthTokens, user models.User, err error) {
+	data, err := s.createUser(username, email, password)
+	if err != nil {
+		return
+	}
+	s.audit.Log(userAuditEntry(data, models.AuditRegister, ip))
+	if err := s.sendVerification(data); err != nil {
+		log.Println("Failed to send verification email:", err)
+	}
+	data, err = s.withRoles(data)
+	if err != nil {
+		return
+	}
+	if s.blocked(data) {
+		return tokens, data, nil
 	}
 
-	token, err := s.jwtService.GenerateToken(data)
+	tokens, err = s.issueTokens(data, "")
 	if err != nil {
-		return "", models.User{}, err
+		return models.AuthTokens{}, models.User{}, err
 	}
 
-	return token, data, nil
+	return tokens, data, nil
 }
 
-func (s *authService) Register(username, email, password string) (jwt string, user models.User, err error) {
-	hashedPassword, err := s.hashPassword(password)
+// Refresh exchanges a refresh token for a new access and refresh token. Each
+// refresh token works once; presenting one that was already exchanged means
+// it leaked, so every token descended from the same login is revoked.
+func (s *authService) Refresh(refreshToken string) (tokens models.AuthTokens, user models.User, err error) {
+	stored, err := s.tokenRepo.GetRefreshToken(hashToken(refreshToken))
+	if err == repository.ErrRefreshTokenNotFound {
+		return tokens, user, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return tokens, user, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return tokens, user, s.revokeFamily(stored.FamilyID)
+	}
+
+	used, err := s.tokenRepo.UseRefreshToken(stored.ID)
 	if err != nil {
 		return
 	}
+	if !used {
+		return tokens, user, s.revokeFamily(stored.FamilyID)
+	}
 
-	data, err := s.repo.Register(username, email, hashedPassword)
+	data, err := s.repo.GetUser(stored.UserID)
+	if err != nil {
+		return
+	}
+	if s.blocked(data) {
+		return tokens, user, ErrEmailNotVerified
+	}
+	data, err = s.withRoles(data)
 	if err != nil {
 		return
 	}
 
-	token, err := s.jwtService.GenerateToken(data)
+	tokens, err = s.issueTokens(data, stored.FamilyID)
 	if err != nil {
-		return "", models.User{}, err
+		return models.AuthTokens{}, models.User{}, err
 	}
 
-	return token, data, nil
+	return tokens, data, nil
+}
+
+// Logout ends the current session: the access token is revoked and so is
+// the refresh token family it was issued with.
+func (s *authService) Logout(ctx context.Context) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	err = s.tokenRepo.RevokeToken(principal.TokenID, principal.ExpiresAt)
+	if err != nil {
+		return
+	}
+	if principal.SessionID == "" {
+		s.audit.Log(auditEntry(ctx, models.AuditLogout, "", ""))
+		return nil
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditLogout, models.AuditTargetSession, principal.SessionID))
+	return s.tokenRepo.RevokeTokenFamily(principal.SessionID)
+}
+
+// LogoutAll signs the user out everywhere.
+func (s *authService) LogoutAll(ctx context.Context) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	err = s.tokenRepo.RevokeUserTokens(principal.UserID)
+	if err != nil {
+		return
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditLogoutAll, "", ""))
+	return nil
 }
 
-func (s *authService) PasswordChange(username, old, password string) (err error) {
-	_, _, err = s.Authenticate(username, old)
+// PasswordChange also signs the user out of every session, so whoever knew
+// the old password loses access straight away.
+func (s *authService) PasswordChange(username, old, password, ip string) (err error) {
+	user, err := s.verifyThrottled(username, old, ip)
 	if err != nil {
 		return err
 	}
@@ -78,7 +256,656 @@ func (s *authService) PasswordChange(username, old, password string) (err error)
 		return err
 	}
 
-	return s.repo.PasswordChange(username, hashedPassword)
+	err = s.repo.PasswordChange(username, hashedPassword)
+	if err != nil {
+		return err
+	}
+	s.audit.Log(userAuditEntry(user, models.AuditPasswordChange, ip))
+	return s.tokenRepo.RevokeUserTokens(user.ID)
+}
+
+// SeedAdmin makes sure the configured admin account exists and has the admin
+// role. An existing account keeps its password.
+func (s *authService) SeedAdmin(username, email, password string) (err error) {
+	if username == "" {
+		return nil
+	}
+
+	data, err := s.repo.Authenticate(username)
+	if err != nil {
+		return
+	}
+	if data.ID == 0 {
+		if email == "" || password == "" {
+			return fmt.Errorf("admin %s does not exist and no email or password is configured", username)
+		}
+		data, err = s.createUser(username, email, password)
+		if err != nil {
+			return
+		}
+	}
+
+	err = s.repo.MarkEmailVerified(data.ID)
+	if err != nil {
+		return
+	}
+	return s.roleRepo.GrantRole(data.ID, models.RoleAdmin, nil)
+}
+
+// VerifyEmail confirms the address the verification link was sent to. The
+// user's access token is made stale so the next refresh carries the change.
+func (s *authService) VerifyEmail(token string) (user models.User, err error) {
+	userId, err := s.tokenRepo.UseEmailToken(purposeVerifyEmail, hashToken(token))
+	if err == repository.ErrEmailTokenNotFound {
+		return user, ErrInvalidEmailToken
+	}
+	if err != nil {
+		return
+	}
+
+	err = s.repo.MarkEmailVerified(userId)
+	if err != nil {
+		return
+	}
+	err = s.tokenRepo.BumpTokenVersion(userId)
+	if err != nil {
+		return
+	}
+	return s.repo.GetUser(userId)
+}
+
+// ResendVerification sends a new verification link. Unknown and already
+// verified addresses, and requests over the rate limit, are silently ignored
+// so the endpoint cannot be used to find out who has an account.
+func (s *authService) ResendVerification(email string) (err error) {
+	data, err := s.repo.GetUserByEmail(email)
+	if err != nil || data.EmailVerified {
+		return nil
+	}
+
+	count, last, err := s.tokenRepo.EmailTokenStats(data.ID, purposeVerifyEmail, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= maxVerificationsPerDay || (last != nil && time.Since(*last) < verificationResendDelay) {
+		return nil
+	}
+	return s.sendVerification(data)
+}
+
+// CheckVerified applies the unverified account policy to features that need
+// a confirmed email address.
+func (s *authService) CheckVerified(principal Principal) (err error) {
+	if principal.Guest {
+		return ErrGuestAccount
+	}
+	if principal.EmailVerified || s.policy == config.UnverifiedAllow {
+		return nil
+	}
+	return ErrEmailNotVerified
+}
+
+func (s *authService) PurgeUnverified() (purged int64, err error) {
+	if s.purgeDays == 0 {
+		return 0, nil
+	}
+	return s.repo.PurgeUnverified(s.purgeDays)
+}
+
+// ForgotPassword emails a password reset link. Nothing tells the caller
+// whether the address has an account; past the rate limit, requests are
+// dropped just as quietly.
+func (s *authService) ForgotPassword(email string) (err error) {
+	data, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	count, last, err := s.tokenRepo.EmailTokenStats(data.ID, purposeResetPassword, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= maxResetsPerDay || (last != nil && time.Since(*last) < resetResendDelay) {
+		return nil
+	}
+
+	token, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+
+	err = s.tokenRepo.CreateEmailToken(data.ID, purposeResetPassword, hashToken(token), time.Now().Add(resetTTL))
+	if err != nil {
+		return
+	}
+
+	link := s.appURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mail.Message{
+		To:      data.Email,
+		Subject: "Reset your File Explorers password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"someone asked to reset the password of your account. To choose a new one, open this link:\n\n%s\n\n"+
+			"The link works once and expires in one hour. If it was not you, you can ignore this email.\n",
+			data.Username, link),
+	})
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and
+// signs the user out everywhere. Following the link also proves the user
+// owns the email address.
+func (s *authService) ResetPassword(token, password, ip string) (err error) {
+	userId, err := s.tokenRepo.UseEmailToken(purposeResetPassword, hashToken(token))
+	if err == repository.ErrEmailTokenNotFound {
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		return
+	}
+
+	data, err := s.repo.GetUser(userId)
+	if err != nil {
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return
+	}
+
+	err = s.repo.PasswordChange(data.Username, hashedPassword)
+	if err != nil {
+		return
+	}
+	s.audit.Log(userAuditEntry(data, models.AuditPasswordReset, ip))
+	err = s.repo.MarkEmailVerified(userId)
+	if err != nil {
+		return
+	}
+	err = s.throttle.Clear(data.Username)
+	if err != nil {
+		return
+	}
+	return s.tokenRepo.RevokeUserTokens(userId)
+}
+
+func (s *authService) CheckLogin(ip, username string) (err error) {
+	return s.throttle.Check(ip, username)
+}
+
+// LoginFailed counts a wrong password or second factor. When that locks the
+// account, the owner gets an email with a link to unlock it. The log names
+// the account that was tried, never the username that was typed in.
+func (s *authService) LoginFailed(ip, username string) (err error) {
+	data, err := s.repo.Authenticate(username)
+	if err != nil {
+		log.Println("Failed to look up account for failed login:", err)
+		data = models.User{}
+	}
+	entry := models.AuditEntry{Action: models.AuditLoginFailed, IP: ip}
+	if data.ID != 0 {
+		entry.TargetType = models.AuditTargetUser
+		entry.TargetID = strconv.Itoa(data.ID)
+	}
+	s.audit.Log(entry)
+
+	locked, err := s.throttle.Fail(ip, username)
+	if err != nil || !locked || data.ID == 0 {
+		return
+	}
+	entry.Action = models.AuditAccountLocked
+	s.audit.Log(entry)
+	return s.sendUnlock(data)
+}
+
+// UnlockAccount lifts a lockout with the link from the lockout email.
+func (s *authService) UnlockAccount(token, ip string) (err error) {
+	userId, err := s.tokenRepo.UseEmailToken(purposeUnlockAccount, hashToken(token))
+	if err == repository.ErrEmailTokenNotFound {
+		return ErrInvalidEmailToken
+	}
+	if err != nil {
+		return
+	}
+	data, err := s.repo.GetUser(userId)
+	if err != nil {
+		return
+	}
+	err = s.throttle.Clear(data.Username)
+	if err != nil {
+		return
+	}
+	s.audit.Log(userAuditEntry(data, models.AuditAccountUnlock, ip))
+	return nil
+}
+
+// UnlockUser lifts a lockout on behalf of an admin.
+func (s *authService) UnlockUser(ctx context.Context, userId int) (err error) {
+	data, err := s.repo.GetUser(userId)
+	if err != nil {
+		return
+	}
+	err = s.throttle.Clear(data.Username)
+	if err != nil {
+		return
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditAccountUnlock, models.AuditTargetUser, strconv.Itoa(userId)))
+	return nil
+}
+
+func (s *authService) sendUnlock(user models.User) (err error) {
+	count, last, err := s.tokenRepo.EmailTokenStats(user.ID, purposeUnlockAccount, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return
+	}
+	if count >= maxUnlocksPerDay || (last != nil && time.Since(*last) < verificationResendDelay) {
+		return nil
+	}
+
+	token, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+
+	err = s.tokenRepo.CreateEmailToken(user.ID, purposeUnlockAccount, hashToken(token), time.Now().Add(unlockTTL))
+	if err != nil {
+		return
+	}
+
+	link := s.publicURL + "/auth/unlock?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your File Explorers account was locked",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"there were too many failed attempts to sign in to your account, so it is locked for a while. "+
+			"If it was you, open this link to unlock it right away:\n\n%s\n\n"+
+			"If it was not you, your password held up, but consider changing it anyway.\n",
+			user.Username, link),
+	})
+}
+
+func (s *authService) sendVerification(user models.User) (err error) {
+	token, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+
+	err = s.tokenRepo.CreateEmailToken(user.ID, purposeVerifyEmail, hashToken(token), time.Now().Add(verificationTTL))
+	if err != nil {
+		return
+	}
+
+	link := s.publicURL + "/auth/verify?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your File Explorers account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"please confirm your email address by opening this link:\n\n%s\n\n"+
+			"The link expires in 24 hours. If you did not create an account, you can ignore this email.\n",
+			user.Username, link),
+	})
+}
+
+// blocked reports whether the policy keeps the user from signing in.
+// Guests have no email to verify.
+func (s *authService) blocked(user models.User) bool {
+	return !user.EmailVerified && !user.Guest && s.policy == config.UnverifiedBlock
+}
+
+// Guest creates a guest account and signs it in, so people can start
+// playing without registering.
+func (s *authService) Guest() (tokens models.AuthTokens, user models.User, err error) {
+	suffix, err := randomToken(5, hex.EncodeToString)
+	if err != nil {
+		return
+	}
+	data, err := s.repo.CreateGuest("guest_" + suffix)
+	if err != nil {
+		return
+	}
+	return s.startSession(data)
+}
+
+// Upgrade turns the signed-in guest into a full account that keeps all its
+// progress. The guest's tokens stop working; the user continues with the
+// new ones.
+func (s *authService) Upgrade(ctx context.Context, username, email, password string) (tokens models.AuthTokens, user models.User, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return
+	}
+	err = s.repo.UpgradeGuest(principal.UserID, username, email, hashedPassword)
+	if err == repository.ErrNotGuest {
+		return tokens, user, ErrNotGuest
+	}
+	if err != nil {
+		return
+	}
+	err = s.roleRepo.GrantRole(principal.UserID, models.RolePlayer, nil)
+	if err != nil {
+		return
+	}
+	err = s.tokenRepo.RevokeUserTokens(principal.UserID)
+	if err != nil {
+		return
+	}
+
+	data, err := s.repo.GetUser(principal.UserID)
+	if err != nil {
+		return
+	}
+	if err := s.sendVerification(data); err != nil {
+		log.Println("Failed to send verification email:", err)
+	}
+	if s.blocked(data) {
+		return tokens, data, nil
+	}
+	return s.startSession(data)
+}
+
+// MergeGuest moves the progress of the guest the token belongs to into the
+// user's account, for players who started as a guest but already had an
+// account.
+func (s *authService) MergeGuest(userId int, guestToken string) (err error) {
+	claims, err := s.jwtService.VerifyToken(guestToken)
+	if err != nil {
+		return
+	}
+	if !claims.Guest || claims.UserID == userId {
+		return ErrNotGuest
+	}
+
+	err = s.repo.MergeGuest(claims.UserID, userId)
+	if err == repository.ErrNotGuest {
+		return ErrNotGuest
+	}
+	return
+}
+
+func (s *authService) PurgeGuests() (purged int64, err error) {
+	if s.guestDays == 0 {
+		return 0, nil
+	}
+	return s.repo.PurgeGuests(s.guestDays)
+}
+
+// SignIn starts a session for a user who proved who they are some other way
+// than with their password, such as through a school account.
+func (s *authService) SignIn(userId int) (tokens models.AuthTokens, user models.User, err error) {
+	data, err := s.repo.GetUser(userId)
+	if err != nil {
+		return
+	}
+	return s.login(data)
+}
+
+// StartSession issues tokens without asking for a second factor. It is meant
+// for callers that just checked one themselves.
+func (s *authService) StartSession(userId int) (tokens models.AuthTokens, user models.User, err error) {
+	data, err := s.repo.GetUser(userId)
+	if err != nil {
+		return
+	}
+	if s.blocked(data) {
+		return tokens, user, ErrEmailNotVerified
+	}
+	return s.startSession(data)
+}
+
+// login finishes the first step of a sign-in. Accounts with two-factor
+// authentication get an MFA token to exchange at /auth/2fa/verify instead
+// of a session.
+func (s *authService) login(data models.User) (tokens models.AuthTokens, user models.User, err error) {
+	if s.blocked(data) {
+		return tokens, user, ErrEmailNotVerified
+	}
+	if !data.TwoFactorEnabled {
+		return s.startSession(data)
+	}
+
+	tokens.MFAToken, err = s.jwtService.GenerateMFAToken(data)
+	if err != nil {
+		return models.AuthTokens{}, models.User{}, err
+	}
+	data, err = s.withRoles(data)
+	if err != nil {
+		return models.AuthTokens{}, models.User{}, err
+	}
+	return tokens, data, nil
+}
+
+func (s *authService) startSession(data models.User) (tokens models.AuthTokens, user models.User, err error) {
+	data, err = s.withRoles(data)
+	if err != nil {
+		return
+	}
+	err = s.throttle.Clear(data.Username)
+	if err != nil {
+		return
+	}
+	if data.DeletionRequestedAt != nil {
+		err = s.repo.CancelDeletion(data.ID)
+		if err != nil {
+			return
+		}
+		data.DeletionRequestedAt = nil
+	}
+
+	tokens, err = s.issueTokens(data, "")
+	if err != nil {
+		return models.AuthTokens{}, models.User{}, err
+	}
+	return tokens, data, nil
+}
+
+// CreateExternalUser registers an account without a password for someone
+// signing in through an external provider for the first time. The username
+// is derived from the given name and made unique.
+func (s *authService) CreateExternalUser(name, email string, verified bool) (user models.User, err error) {
+	if email == "" {
+		return user, ErrMissingEmail
+	}
+	if existing, err := s.repo.GetUserByEmail(email); err == nil && existing.ID != 0 {
+		return user, ErrEmailInUse
+	}
+
+	username, err := s.uniqueUsername(name)
+	if err != nil {
+		return
+	}
+
+	// An empty hash never matches, so the account has no password until
+	// the user sets one through a password reset.
+	user, err = s.repo.Register(username, email, "")
+	if err != nil {
+		return
+	}
+	err = s.roleRepo.GrantRole(user.ID, models.RolePlayer, nil)
+	if err != nil {
+		return
+	}
+
+	if verified {
+		err = s.repo.MarkEmailVerified(user.ID)
+		user.EmailVerified = err == nil
+	} else if err := s.sendVerification(user); err != nil {
+		log.Println("Failed to send verification email:", err)
+	}
+	return
+}
+
+func (s *authService) uniqueUsername(name string) (string, error) {
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return -1
+	}, name)
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if base == "" {
+		base = "explorer"
+	}
+
+	for i := 1; i < 1000; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+		data, err := s.repo.Authenticate(username)
+		if err != nil {
+			return "", err
+		}
+		if data.ID == 0 {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %s", base)
+}
+
+// createUser registers a new account as a player.
+func (s *authService) createUser(username, email, password string) (user models.User, err error) {
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return
+	}
+
+	user, err = s.repo.Register(username, email, hashedPassword)
+	if err != nil {
+		return
+	}
+	err = s.roleRepo.GrantRole(user.ID, models.RolePlayer, nil)
+	return
+}
+
+// withRoles loads the user's roles. Roles that require two-factor
+// authentication are left out until the user has enabled it.
+func (s *authService) withRoles(user models.User) (models.User, error) {
+	roles, permissions, err := s.roleRepo.UserPermissions(user.ID, user.TwoFactorEnabled)
+	if err != nil {
+		return user, err
+	}
+	required, err := s.roleRepo.RequiresTwoFactor(user.ID)
+	if err != nil {
+		return user, err
+	}
+	user.Roles = roles
+	user.Permissions = permissions
+	user.TwoFactorRequired = required
+	return user, nil
+}
+
+// Reauthenticate asks the signed-in user for their password again before
+// something that cannot be undone. Accounts without a password, such as
+// guests and school accounts, have nothing to confirm with, so they must
+// have signed in within reauthWindow instead.
+func (s *authService) Reauthenticate(principal Principal, password, ip string) (user models.User, err error) {
+	data, err := s.repo.GetUser(principal.UserID)
+	if err != nil {
+		return
+	}
+	if data.Password != "" {
+		return s.verifyThrottled(data.Username, password, ip)
+	}
+
+	if principal.SessionID == "" {
+		return user, ErrReauthRequired
+	}
+	startedAt, err := s.sessionRepo.SessionStarted(principal.UserID, principal.SessionID)
+	if err == repository.ErrSessionNotFound || err == nil && time.Since(startedAt) > reauthWindow {
+		return user, ErrReauthRequired
+	}
+	if err != nil {
+		return
+	}
+	return data, nil
+}
+
+// verifyThrottled is verify behind the login throttle; only wrong passwords
+// count as failures.
+func (s *authService) verifyThrottled(username, password, ip string) (user models.User, err error) {
+	err = s.throttle.Check(ip, username)
+	if err != nil {
+		return
+	}
+
+	user, err = s.verify(username, password)
+	if err == ErrInvalidCredentials {
+		if err := s.LoginFailed(ip, username); err != nil {
+			log.Println("Failed to record failed login:", err)
+		}
+	}
+	return
+}
+
+func (s *authService) verify(username, password string) (user models.User, err error) {
+	data, err := s.repo.Authenticate(username)
+	if err != nil {
+		return
+	}
+
+	if !s.checkPasswordHash(password, data.Password) {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return data, nil
+}
+
+// issueTokens signs an access token and stores a fresh refresh token. An
+// empty family starts a new one, and with it a new session, as on login.
+func (s *authService) issueTokens(user models.User, family string) (tokens models.AuthTokens, err error) {
+	if family == "" {
+		family, err = randomToken(16, hex.EncodeToString)
+		if err != nil {
+			return
+		}
+		err = s.sessionRepo.CreateSession(family, user.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	access, err := s.jwtService.GenerateToken(user, family)
+	if err != nil {
+		return
+	}
+
+	refresh, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+
+	err = s.tokenRepo.CreateRefreshToken(user.ID, family, hashToken(refresh), time.Now().Add(s.refreshTTL))
+	if err != nil {
+		return
+	}
+	err = s.repo.TouchUser(user.ID)
+	if err != nil {
+		return
+	}
+
+	return models.AuthTokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+	}, nil
+}
+
+func (s *authService) revokeFamily(family string) error {
+	if err := s.tokenRepo.RevokeTokenFamily(family); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
 }
 
 func (s *authService) hashPassword(password string) (string, error) {
@@ -90,3 +917,18 @@ func (s *authService) checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+func randomToken(size int, encode func([]byte) string) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return encode(bytes), nil
+}
+
+// hashToken is what gets stored for opaque tokens. They are random enough
+// that a plain SHA-256 is sufficient, and it can be looked up directly.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"file-explorers-be/circuit"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+)
+
+var (
+	ErrMissingCircuit = fmt.Errorf("No circuit submitted")
+)
+
+type CircuitService interface {
+	GetProgress(ctx context.Context) (progress models.CircuitProgress, err error)
+	GetChallenge(ctx context.Context, challengeId int) (challenge models.CircuitChallenge, err error)
+	CompleteChallenge(ctx context.Context, challengeId int, submission models.CircuitSubmission) (progress models.CircuitProgress, err error)
+	Evaluate(ctx context.Context, submission models.CircuitSubmission) (evaluation models.CircuitEvaluation, err error)
+	Simulate(ctx context.Context, req models.CircuitSimulationRequest) (simulation models.CircuitSimulation, err error)
+}
+
+type circuitService struct {
+	repo repository.CircuitRepository
+}
+
+func NewCircuitService(repo repository.CircuitRepository) CircuitService {
+	return &circuitService{
+		repo: repo,
+	}
+}
+
+// GetProgress returns every challenge with the user's completion state. The
+// current challenge is the first one the user has not completed yet.
+func (s *circuitService) GetProgress(ctx context.Context) (progress models.CircuitProgress, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	challenges, err := s.repo.GetChallenges(principal.UserID)
+	if err != nil {
+		return
+	}
+
+	progress.Challenges = challenges
+	progress.CurrentChallengeIndex = len(challenges)
+	for i, challenge := range challenges {
+		progress.Points += challenge.PointsEarned
+		if !challenge.Completed && progress.CurrentChallengeIndex == len(challenges) {
+			progress.CurrentChallengeIndex = i
+		}
+	}
+	return
+}
+
+func (s *circuitService) GetChallenge(ctx context.Context, challengeId int) (challenge models.CircuitChallenge, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.GetChallenge(principal.UserID, challengeId)
+}
+
+func (s *circuitService) CompleteChallenge(ctx context.Context, challengeId int, submission models.CircuitSubmission) (progress models.CircuitProgress, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	if submission.Circuit == nil {
+		return progress, ErrMissingCircuit
+	}
+
+	challenge, err := s.repo.GetChallenge(principal.UserID, challengeId)
+	if err != nil {
+		return
+	}
+
+	err = s.validate(submission, challenge)
+	if err != nil {
+		return
+	}
+
+	err = s.repo.CompleteChallenge(principal.UserID, challengeId, submission.Circuit)
+	if err != nil {
+		return
+	}
+	return s.GetProgress(ctx)
+}
+
+// validate runs the submitted circuit through the simulator. Circuits with an
+// AC source are sampled over time and graded on RMS values.
+func (s *circuitService) validate(submission models.CircuitSubmission, challenge models.CircuitChallenge) error {
+	c, err := circuit.Decode(submission.Circuit)
+	if err != nil {
+		return err
+	}
+
+	if c.HasAC() {
+		simulation, err := circuit.Simulate(c, 0, 0)
+		if err != nil {
+			return err
+		}
+		return circuit.CheckSimulation(simulation, challenge.Targets, challenge.Tolerance)
+	}
+
+	evaluation, err := circuit.Evaluate(c)
+	if err != nil {
+		return err
+	}
+	return circuit.Check(evaluation, challenge.Targets, challenge.Tolerance)
+}
+
+// Evaluate solves a circuit export without recording anything, so players can
+// check their circuit against the server's simulator.
+func (s *circuitService) Evaluate(ctx context.Context, submission models.CircuitSubmission) (evaluation models.CircuitEvaluation, err error) {
+	if submission.Circuit == nil {
+		return evaluation, ErrMissingCircuit
+	}
+
+	c, err := circuit.Decode(submission.Circuit)
+	if err != nil {
+		return
+	}
+	return circuit.Evaluate(c)
+}
+
+// Simulate samples a circuit over time for plotting on the oscilloscopes.
+func (s *circuitService) Simulate(ctx context.Context, req models.CircuitSimulationRequest) (simulation models.CircuitSimulation, err error) {
+	if req.Circuit == nil {
+		return simulation, ErrMissingCircuit
+	}
+
+	c, err := circuit.Decode(req.Circuit)
+	if err != nil {
+		return
+	}
+	return circuit.Simulate(c, req.SampleRate, req.Duration)
+}
@@ -1,65 +1,113 @@
 package service
 
 import (
-	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"file-explorers-be/config"
+	"file-explorers-be/jwk"
 	"file-explorers-be/models"
+	"file-explorers-be/repository"
 	"fmt"
-	"net/http"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type contextKey string
+var ErrTokenRevoked = fmt.Errorf("token has been revoked")
 
 const (
-	ContextKeyHttpRequest contextKey = "httpRequest"
+	accessAudience = "file-explorers"
+	// mfaAudience marks the short-lived token handed out after the password
+	// check of an account with two-factor authentication. It only works for
+	// the second step and is never accepted as an access token.
+	mfaAudience = "file-explorers-mfa"
+	mfaLifetime = 5 * time.Minute
 )
 
 type JWTClaims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	// Version must match users.token_version; SessionID is the refresh
+	// token family the access token was issued with.
+	Version       int      `json:"ver"`
+	SessionID     string   `json:"sid,omitempty"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	Guest         bool     `json:"guest,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type JwtService interface {
-	GenerateToken(user models.User) (string, error)
-	DecodeTokenFromCtx(ctx context.Context) (claims *JWTClaims, err error)
+	GenerateToken(user models.User, sessionId string) (string, error)
+	VerifyToken(tokenString string) (claims *JWTClaims, err error)
+	GenerateMFAToken(user models.User) (string, error)
+	VerifyMFAToken(tokenString string) (claims *JWTClaims, err error)
+	JWKS() jwk.Document
 }
 
 type jwtService struct {
-	secretKey string
+	keys      *jwk.Set
 	issuer    string
+	lifetime  time.Duration
+	tokenRepo repository.TokenRepository
 }
 
-func NewJwtService(cfg config.Config) JwtService {
+func NewJwtService(keys *jwk.Set, cfg config.Config, tokenRepo repository.TokenRepository) JwtService {
 	return &jwtService{
-		secretKey: cfg.JwtSecret,
+		keys:      keys,
 		issuer:    cfg.JwtIssuer,
+		lifetime:  cfg.AccessTokenTTL,
+		tokenRepo: tokenRepo,
 	}
 }
 
-func (s *jwtService) GenerateToken(user models.User) (string, error) {
+func (s *jwtService) GenerateToken(user models.User, sessionId string) (string, error) {
+	claims := JWTClaims{
+		UserID:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Version:       user.TokenVersion,
+		SessionID:     sessionId,
+		Roles:         user.Roles,
+		Permissions:   user.Permissions,
+		EmailVerified: user.EmailVerified,
+		Guest:         user.Guest,
+	}
+	return s.sign(claims, user.Username, accessAudience, s.lifetime)
+}
+
+func (s *jwtService) GenerateMFAToken(user models.User) (string, error) {
 	claims := JWTClaims{
 		UserID:   user.ID,
 		Username: user.Username,
-		Email:    user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    s.issuer,
-			Subject:   user.Username,
-			Audience:  []string{"file-explorers"},
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		Version:  user.TokenVersion,
+	}
+	return s.sign(claims, user.Username, mfaAudience, mfaLifetime)
+}
+
+func (s *jwtService) sign(claims JWTClaims, subject, audience string, lifetime time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        hex.EncodeToString(jti),
+		Issuer:    s.issuer,
+		Subject:   subject,
+		Audience:  []string{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
+		NotBefore: jwt.NewNumericDate(time.Now()),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	key := s.keys.Signing()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
 
-	tokenString, err := token.SignedString([]byte(s.secretKey))
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
@@ -67,39 +115,56 @@ func (s *jwtService) GenerateToken(user models.User) (string, error) {
 	return tokenString, nil
 }
 
-func (s *jwtService) DecodeTokenFromCtx(ctx context.Context) (claims *JWTClaims, err error) {
-	tokenString, err := s.extractTokenFromCtx(ctx)
-	if err != nil {
-		return
-	}
+// VerifyToken checks the signature and lifetime of an access token and that
+// neither it nor its session has been revoked since it was issued.
+func (s *jwtService) VerifyToken(tokenString string) (claims *JWTClaims, err error) {
+	return s.verify(tokenString, accessAudience)
+}
+
+// VerifyMFAToken checks a token from GenerateMFAToken; only the user fields
+// of the claims are set.
+func (s *jwtService) VerifyMFAToken(tokenString string) (claims *JWTClaims, err error) {
+	return s.verify(tokenString, mfaAudience)
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.secretKey), nil
-	})
+func (s *jwtService) verify(tokenString, audience string) (claims *JWTClaims, err error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.key,
+		jwt.WithValidMethods([]string{jwk.AlgRS256, jwk.AlgEdDSA}), jwt.WithAudience(audience))
 	if err != nil {
 		return
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
-	} else {
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
 		return nil, fmt.Errorf("invalid token claims")
 	}
+
+	version, revoked, err := s.tokenRepo.TokenState(claims.UserID, claims.ID, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked || version != claims.Version {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
 }
 
-func (s *jwtService) extractTokenFromCtx(ctx context.Context) (string, error) {
-	fmt.Println(ctx)
-	req, ok := ctx.Value(ContextKeyHttpRequest).(*http.Request)
+// key picks the verification key named by the token. The algorithm has to
+// be the one the key is meant for.
+func (s *jwtService) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys.Lookup(kid)
 	if !ok {
-		return "", fmt.Errorf("no http request in context")
-	}
-	authHeader := req.Header.Get("Authorization")
-	if authHeader == "" {
-		return "", fmt.Errorf("no Authorization header")
+		return nil, fmt.Errorf("unknown signing key %q", kid)
 	}
-	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		return "", fmt.Errorf("invalid Authorization header format")
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
 	}
-	return parts[1], nil
+	return key.Public, nil
+}
+
+// JWKS lists the public keys tokens are signed with, for anyone who wants
+// to verify them.
+func (s *jwtService) JWKS() jwk.Document {
+	return s.keys.Document()
 }
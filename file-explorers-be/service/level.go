@@ -2,41 +2,63 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"file-explorers-be/logic"
 	"file-explorers-be/models"
 	"file-explorers-be/repository"
+	"file-explorers-be/shell"
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
+var (
+	ErrTerminalOnlyLevel = fmt.Errorf("This level can only be solved through the terminal")
+	ErrBooleanOnlyLevel  = fmt.Errorf("This level is solved by submitting a gate circuit")
+	ErrLevelType         = fmt.Errorf("Level type must be %q, %q or %q", models.LevelTypeGUI, models.LevelTypeTerminal, models.LevelTypeBoolean)
+	ErrLevelName         = fmt.Errorf("Level names must be 1 to %d characters", maxLevelName)
+	ErrLevelDifficulty   = fmt.Errorf("Difficulty must be at least 1")
+	ErrLevelTooLarge     = fmt.Errorf("Level filesystems are limited to %d files", shell.MaxFiles)
+	ErrNoLevelSolution   = fmt.Errorf("Level has no solution")
+	ErrInvalidLevel      = fmt.Errorf("Invalid level")
+)
+
+// maxLevelName is the size of the name column.
+const maxLevelName = 100
+
 type LevelService interface {
 	GetLevels(ctx context.Context) (levels []models.LevelStatus, err error)
 	GetLevelData(ctx context.Context, level int) (data models.LevelData, err error)
 	SolvedLevel(ctx context.Context, level int) (levels []models.LevelStatus, err error)
 	GetLeaderboard(ctx context.Context, timeFilter string) (leaderboard []models.LeaderboardEntry, err error)
+	CreateLevel(ctx context.Context, data models.LevelData) (level models.LevelData, err error)
+	UpdateLevel(ctx context.Context, data models.LevelData) (level models.LevelData, err error)
 }
 
 type levelService struct {
-	repo       repository.LevelRepository
-	jwtService JwtService
+	repo  repository.LevelRepository
+	audit AuditLogger
 }
 
-func NewLevelService(repo repository.LevelRepository, jwtService JwtService) LevelService {
+func NewLevelService(repo repository.LevelRepository, audit AuditLogger) LevelService {
 	return &levelService{
-		repo:       repo,
-		jwtService: jwtService,
+		repo:  repo,
+		audit: audit,
 	}
 }
 
 func (s *levelService) GetLevels(ctx context.Context) (levels []models.LevelStatus, err error) {
-	jwt, err := s.jwtService.DecodeTokenFromCtx(ctx)
+	principal, err := PrincipalFromCtx(ctx)
 	if err != nil {
 		return
 	}
-	return s.repo.GetLevelsWithSolved(jwt.UserID)
+	return s.repo.GetLevelsWithSolved(principal.UserID)
 }
 
 func (s *levelService) GetLevelData(ctx context.Context, level int) (data models.LevelData, err error) {
 	fmt.Println("[DEBUG levelService.GetLevelData] Decoding JWT token from context")
-	_, err = s.jwtService.DecodeTokenFromCtx(ctx)
+	_, err = PrincipalFromCtx(ctx)
 	if err != nil {
 		fmt.Println("[DEBUG levelService.GetLevelData] JWT decode error:", err)
 		return
@@ -47,12 +69,12 @@ func (s *levelService) GetLevelData(ctx context.Context, level int) (data models
 }
 
 func (s *levelService) StartedLevel(ctx context.Context, level int) (levels []models.LevelStatus, err error) {
-	jwt, err := s.jwtService.DecodeTokenFromCtx(ctx)
+	principal, err := PrincipalFromCtx(ctx)
 	if err != nil {
 		return
 	}
 
-	err = s.repo.MarkLevelSolved(jwt.UserID, level)
+	err = s.repo.MarkLevelSolved(principal.UserID, level)
 	if err != nil {
 		return
 	}
@@ -60,12 +82,22 @@ func (s *levelService) StartedLevel(ctx context.Context, level int) (levels []mo
 }
 
 func (s *levelService) SolvedLevel(ctx context.Context, level int) (levels []models.LevelStatus, err error) {
-	jwt, err := s.jwtService.DecodeTokenFromCtx(ctx)
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	data, err := s.repo.GetLevelData(level)
 	if err != nil {
 		return
 	}
+	if data.Type == models.LevelTypeTerminal {
+		return nil, ErrTerminalOnlyLevel
+	}
+	if data.Type == models.LevelTypeBoolean {
+		return nil, ErrBooleanOnlyLevel
+	}
 	fmt.Println("[DEBUG] level" , level , " marked as solved " )
-	err = s.repo.MarkLevelSolved(jwt.UserID, level)
+	err = s.repo.MarkLevelSolved(principal.UserID, level)
 	if err != nil {
 		return
 	}
@@ -75,3 +107,101 @@ func (s *levelService) SolvedLevel(ctx context.Context, level int) (levels []mod
 func (s *levelService) GetLeaderboard(ctx context.Context, timeFilter string) (leaderboard []models.LeaderboardEntry, err error) {
 	return s.repo.GetLeaderboard(timeFilter)
 }
+
+// CreateLevel adds a level written by a level author.
+func (s *levelService) CreateLevel(ctx context.Context, data models.LevelData) (level models.LevelData, err error) {
+	err = validateLevel(&data)
+	if err != nil {
+		return
+	}
+	id, err := s.repo.CreateLevel(data)
+	if err != nil {
+		return
+	}
+
+	entry := auditEntry(ctx, models.AuditLevelCreate, models.AuditTargetLevel, strconv.Itoa(id))
+	entry.Details = map[string]interface{}{"name": data.Name, "type": data.Type}
+	s.audit.Log(entry)
+	return s.repo.GetLevelData(id)
+}
+
+// UpdateLevel replaces a level with the author's new version. Players keep
+// their progress on it.
+func (s *levelService) UpdateLevel(ctx context.Context, data models.LevelData) (level models.LevelData, err error) {
+	err = validateLevel(&data)
+	if err != nil {
+		return
+	}
+	err = s.repo.UpdateLevel(data)
+	if err != nil {
+		return
+	}
+
+	entry := auditEntry(ctx, models.AuditLevelUpdate, models.AuditTargetLevel, strconv.Itoa(data.LevelID))
+	entry.Details = map[string]interface{}{"name": data.Name, "type": data.Type}
+	s.audit.Log(entry)
+	return s.repo.GetLevelData(data.LevelID)
+}
+
+// validateLevel checks that a level can be played: the filesystem and the
+// solution must have the shape its level type expects.
+func validateLevel(data *models.LevelData) (err error) {
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Type == "" {
+		data.Type = models.LevelTypeGUI
+	}
+	if data.Difficulty == 0 {
+		data.Difficulty = 1
+	}
+	if data.StartingFileSystem == nil {
+		data.StartingFileSystem = []interface{}{}
+	}
+
+	switch {
+	case data.Type != models.LevelTypeGUI && data.Type != models.LevelTypeTerminal && data.Type != models.LevelTypeBoolean:
+		return ErrLevelType
+	case data.Name == "" || utf8.RuneCountInString(data.Name) > maxLevelName:
+		return ErrLevelName
+	case data.Difficulty < 1:
+		return ErrLevelDifficulty
+	case data.Solution == nil:
+		return ErrNoLevelSolution
+	}
+
+	var files []models.File
+	if err = remarshal(data.StartingFileSystem, &files); err != nil {
+		return fmt.Errorf("%w: starting filesystem: %v", ErrInvalidLevel, err)
+	}
+	if len(files) > shell.MaxFiles {
+		return ErrLevelTooLarge
+	}
+
+	if data.Type == models.LevelTypeBoolean {
+		target, err := booleanTarget(*data)
+		if err == nil {
+			_, err = logic.Table(target)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLevel, err)
+		}
+		return nil
+	}
+	var solution []models.SolutionRequirement
+	if err = remarshal(data.Solution, &solution); err != nil {
+		return fmt.Errorf("%w: solution: %v", ErrInvalidLevel, err)
+	}
+	if len(solution) == 0 {
+		return ErrNoLevelSolution
+	}
+	return nil
+}
+
+// remarshal converts generic JSON values, as decoded from a request body,
+// into a typed value.
+func remarshal(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
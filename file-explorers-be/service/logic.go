@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"file-explorers-be/logic"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+)
+
+var (
+	ErrNotBooleanLevel = fmt.Errorf("This level is not a boolean logic level")
+	ErrMissingNetlist  = fmt.Errorf("No netlist submitted")
+	ErrLevelNotSolved  = fmt.Errorf("Solve the level first to see a minimal circuit")
+)
+
+type LogicService interface {
+	Submit(ctx context.Context, level int, submission models.BooleanSubmission) (evaluation models.BooleanEvaluation, err error)
+	Synthesize(ctx context.Context, req models.SynthesisRequest) (result models.BooleanSynthesis, err error)
+	Solution(ctx context.Context, level int, gateSet string) (result models.BooleanSynthesis, err error)
+}
+
+type logicService struct {
+	levelRepo repository.LevelRepository
+}
+
+func NewLogicService(levelRepo repository.LevelRepository) LogicService {
+	return &logicService{
+		levelRepo: levelRepo,
+	}
+}
+
+// Submit checks a gate netlist against the level's truth table. A correct
+// circuit solves the level and records its gate count and depth.
+func (s *logicService) Submit(ctx context.Context, level int, submission models.BooleanSubmission) (evaluation models.BooleanEvaluation, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	if submission.Netlist == nil {
+		return evaluation, ErrMissingNetlist
+	}
+
+	data, err := s.levelRepo.GetLevelData(level)
+	if err != nil {
+		return
+	}
+
+	target, err := booleanTarget(data)
+	if err != nil {
+		return
+	}
+
+	netlist, err := logic.Decode(submission.Netlist)
+	if err != nil {
+		return
+	}
+	evaluation, err = logic.Check(netlist, target)
+	if err != nil || !evaluation.Solved {
+		return
+	}
+
+	err = s.levelRepo.RecordBooleanSolve(principal.UserID, level, evaluation.GateCount, evaluation.Depth)
+	return
+}
+
+// Synthesize builds a minimal, or for larger tables near-minimal, circuit
+// for a truth table or expression. Anyone signed in can ask, so it takes
+// fewer inputs than a level may have.
+func (s *logicService) Synthesize(ctx context.Context, req models.SynthesisRequest) (result models.BooleanSynthesis, err error) {
+	if len(req.Inputs) > logic.MaxSynthesisInputs {
+		return result, logic.ErrTooManySynthesisInputs
+	}
+	return logic.Synthesize(req.BooleanTarget, req.GateSet)
+}
+
+// Solution shows a minimal reference circuit for a boolean level once the
+// user has solved it.
+func (s *logicService) Solution(ctx context.Context, level int, gateSet string) (result models.BooleanSynthesis, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	solved, err := s.levelRepo.IsLevelSolved(principal.UserID, level)
+	if err != nil {
+		return
+	}
+	if !solved {
+		return result, ErrLevelNotSolved
+	}
+
+	data, err := s.levelRepo.GetLevelData(level)
+	if err != nil {
+		return
+	}
+	target, err := booleanTarget(data)
+	if err != nil {
+		return
+	}
+	return logic.Synthesize(target, gateSet)
+}
+
+func booleanTarget(data models.LevelData) (target models.BooleanTarget, err error) {
+	if data.Type != models.LevelTypeBoolean {
+		return target, ErrNotBooleanLevel
+	}
+
+	raw, err := json.Marshal(data.Solution)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(raw, &target)
+	return
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"file-explorers-be/config"
+	"file-explorers-be/models"
+	"file-explorers-be/oidc"
+	"file-explorers-be/repository"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRedirect = fmt.Errorf("Redirect must point to the app")
+	ErrLoginExpired    = fmt.Errorf("The sign-in took too long, please try again")
+	ErrIdentityInUse   = fmt.Errorf("This account is already linked to another user")
+	ErrAlreadyLinked   = fmt.Errorf("A different account from this provider is already linked")
+	ErrLastLogin       = fmt.Errorf("Set a password before unlinking your only sign-in method")
+	ErrOtherBrowser    = fmt.Errorf("The sign-in was started in a different browser, please try again")
+	ErrLinkExpired     = fmt.Errorf("The link request has expired, please link the account again")
+	ErrLinkOtherUser   = fmt.Errorf("The link was started by a different account")
+)
+
+// oidcStateTTL is how long the user has to finish signing in at the
+// provider.
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCService interface {
+	Providers() (names []string)
+	LoginURL(ctx context.Context, provider, redirect string) (url, state string, err error)
+	LinkURL(ctx context.Context, provider, redirect string) (url, state string, err error)
+	Callback(ctx context.Context, provider, code, state, browserState string) (login models.OIDCLogin, err error)
+	ConfirmLink(ctx context.Context, provider, token string) (err error)
+	Identities(ctx context.Context) (identities []models.Identity, err error)
+	Unlink(ctx context.Context, provider string) (err error)
+}
+
+type oidcService struct {
+	repo        repository.IdentityRepository
+	authRepo    repository.AuthRepository
+	authService AuthService
+	audit       AuditLogger
+	providers   map[string]*oidc.Provider
+	names       []string
+	appURL      string
+}
+
+func NewOIDCService(repo repository.IdentityRepository, authRepo repository.AuthRepository, authService AuthService, audit AuditLogger, cfg config.Config) OIDCService {
+	s := &oidcService{
+		repo:        repo,
+		authRepo:    authRepo,
+		authService: authService,
+		audit:       audit,
+		providers:   map[string]*oidc.Provider{},
+		names:       []string{},
+		appURL:      cfg.AppURL,
+	}
+	for _, p := range cfg.OIDCProviders {
+		s.providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  cfg.PublicURL + "/auth/oidc/" + p.Name + "/callback",
+			Scopes:       p.Scopes,
+		})
+		s.names = append(s.names, p.Name)
+	}
+	return s
+}
+
+func (s *oidcService) Providers() (names []string) {
+	return s.names
+}
+
+// LoginURL starts signing in with a provider. After the callback the browser
+// is sent to redirect, which has to be a page of the app; without one the
+// callback answers with JSON. The returned state must be kept in the browser
+// and handed back to Callback, so a callback from someone else's sign-in is
+// refused.
+func (s *oidcService) LoginURL(ctx context.Context, provider, redirect string) (url, state string, err error) {
+	if !s.appRedirect(redirect) {
+		return "", "", ErrInvalidRedirect
+	}
+	return s.start(ctx, provider, nil, redirect)
+}
+
+// LinkURL starts adding a provider to the signed-in user's account. The link
+// is only made once the user confirms it with ConfirmLink.
+func (s *oidcService) LinkURL(ctx context.Context, provider, redirect string) (url, state string, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	if !s.appRedirect(redirect) {
+		return "", "", ErrInvalidRedirect
+	}
+	return s.start(ctx, provider, &principal.UserID, redirect)
+}
+
+func (s *oidcService) appRedirect(redirect string) bool {
+	return redirect == "" || redirect == s.appURL || strings.HasPrefix(redirect, s.appURL+"/")
+}
+
+func (s *oidcService) start(ctx context.Context, provider string, userId *int, redirect string) (url, browserState string, err error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", oidc.ErrUnknownProvider
+	}
+
+	state := models.OIDCState{
+		Provider:  provider,
+		UserID:    userId,
+		ExpiresAt: time.Now().Add(oidcStateTTL),
+	}
+	if redirect != "" {
+		state.Redirect = &redirect
+	}
+	for _, v := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		*v, err = randomToken(32, base64.RawURLEncoding.EncodeToString)
+		if err != nil {
+			return
+		}
+	}
+
+	url, err = p.AuthURL(ctx, state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		return
+	}
+	err = s.repo.CreateState(state)
+	return url, state.State, err
+}
+
+// Callback finishes a login at the provider. A known identity signs its user
+// in, and an unknown one becomes a new account. When an account started
+// linking, the callback hands out a token to confirm the link with instead.
+// browserState is the state the browser kept from LoginURL or LinkURL.
+func (s *oidcService) Callback(ctx context.Context, provider, code, state, browserState string) (login models.OIDCLogin, err error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return login, oidc.ErrUnknownProvider
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return login, ErrOtherBrowser
+	}
+
+	pending, err := s.repo.TakeState(state)
+	if err == repository.ErrOIDCStateNotFound {
+		return login, ErrLoginExpired
+	}
+	if err != nil {
+		return
+	}
+	if pending.Subject != nil || pending.Provider != provider || time.Now().After(pending.ExpiresAt) {
+		return login, ErrLoginExpired
+	}
+	if pending.Redirect != nil {
+		login.Redirect = *pending.Redirect
+	}
+
+	claims, err := p.Exchange(ctx, code, pending.Verifier, pending.Nonce)
+	if err != nil {
+		return
+	}
+
+	identity, err := s.repo.GetIdentity(provider, claims.Subject)
+	found := err == nil
+	if err != nil && err != repository.ErrIdentityNotFound {
+		return
+	}
+
+	if pending.UserID != nil {
+		if found {
+			if identity.UserID != *pending.UserID {
+				return login, ErrIdentityInUse
+			}
+			login.Linked = true
+			return login, nil
+		}
+		login.LinkToken, err = s.pendingLink(*pending.UserID, provider, claims)
+		return
+	}
+
+	userId := identity.UserID
+	if !found {
+		name := claims.PreferredUsername
+		if name == "" {
+			name = claims.Email
+		}
+		user, err := s.authService.CreateExternalUser(name, claims.Email, claims.EmailVerified)
+		if err != nil {
+			return login, err
+		}
+		err = s.repo.LinkIdentity(user.ID, provider, claims.Subject, claims.Email)
+		if err != nil {
+			return login, err
+		}
+		userId = user.ID
+	}
+
+	login.Tokens, login.User, err = s.authService.SignIn(userId)
+	if err == nil && login.Tokens.AccessToken != "" {
+		entry := userAuditEntry(login.User, models.AuditLogin, ClientIPFromCtx(ctx))
+		entry.Details = map[string]interface{}{"method": provider}
+		s.audit.Log(entry)
+	}
+	return
+}
+
+// pendingLink remembers an identity that came back from the provider for
+// the account that started linking it, until that account confirms it.
+func (s *oidcService) pendingLink(userId int, provider string, claims oidc.Claims) (token string, err error) {
+	token, err = randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return
+	}
+	err = s.repo.CreateState(models.OIDCState{
+		State:     token,
+		Provider:  provider,
+		UserID:    &userId,
+		Subject:   &claims.Subject,
+		Email:     &claims.Email,
+		ExpiresAt: time.Now().Add(oidcStateTTL),
+	})
+	return
+}
+
+// ConfirmLink links the identity from a link callback to the signed-in
+// user. A link someone else started, for example by sending the user their
+// link URL, is refused.
+func (s *oidcService) ConfirmLink(ctx context.Context, provider, token string) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	pending, err := s.repo.TakeState(token)
+	if err == repository.ErrOIDCStateNotFound {
+		return ErrLinkExpired
+	}
+	if err != nil {
+		return
+	}
+	if pending.Subject == nil || pending.Provider != provider || time.Now().After(pending.ExpiresAt) {
+		return ErrLinkExpired
+	}
+	if pending.UserID == nil || *pending.UserID != principal.UserID {
+		return ErrLinkOtherUser
+	}
+
+	identity, err := s.repo.GetIdentity(provider, *pending.Subject)
+	if err == nil {
+		if identity.UserID != principal.UserID {
+			return ErrIdentityInUse
+		}
+		return nil
+	}
+	if err != repository.ErrIdentityNotFound {
+		return
+	}
+
+	identities, err := s.repo.ListIdentities(principal.UserID)
+	if err != nil {
+		return
+	}
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			return ErrAlreadyLinked
+		}
+	}
+	email := ""
+	if pending.Email != nil {
+		email = *pending.Email
+	}
+	return s.repo.LinkIdentity(principal.UserID, provider, *pending.Subject, email)
+}
+
+func (s *oidcService) Identities(ctx context.Context) (identities []models.Identity, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.ListIdentities(principal.UserID)
+}
+
+// Unlink removes a provider from the account, as long as the user can still
+// sign in afterwards.
+func (s *oidcService) Unlink(ctx context.Context, provider string) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	user, err := s.authRepo.GetUser(principal.UserID)
+	if err != nil {
+		return
+	}
+	if user.Password == "" {
+		identities, err := s.repo.ListIdentities(principal.UserID)
+		if err != nil {
+			return err
+		}
+		if len(identities) <= 1 {
+			return ErrLastLogin
+		}
+	}
+	return s.repo.UnlinkIdentity(principal.UserID, provider)
+}
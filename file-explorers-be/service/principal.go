@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type contextKey string
+
+const (
+	contextKeyPrincipal contextKey = "principal"
+	contextKeyClientIP  contextKey = "client_ip"
+)
+
+var (
+	ErrUnauthenticated = fmt.Errorf("Authentication required")
+	ErrForbidden       = fmt.Errorf("You do not have permission to do that")
+)
+
+// Principal is the signed-in user a request is made on behalf of. The
+// authentication middleware puts it in the request context once, and
+// services read it back from there.
+type Principal struct {
+	UserID        int
+	Username      string
+	Roles         []string
+	Permissions   []string
+	EmailVerified bool
+	Guest         bool
+	SessionID     string
+	TokenID       string
+	ExpiresAt     time.Time
+	// AccessTokenID and Scopes are set when the request came with a
+	// personal access token instead of a login.
+	AccessTokenID int
+	Scopes        []string
+}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, contextKeyPrincipal, principal)
+}
+
+func PrincipalFromCtx(ctx context.Context) (principal Principal, err error) {
+	principal, ok := ctx.Value(contextKeyPrincipal).(Principal)
+	if !ok {
+		return principal, ErrUnauthenticated
+	}
+	return principal, nil
+}
+
+// WithClientIP stores the address a request came from, for the audit log.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKeyClientIP, ip)
+}
+
+func ClientIPFromCtx(ctx context.Context) string {
+	ip, _ := ctx.Value(contextKeyClientIP).(string)
+	return ip
+}
+
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Principal) HasPermission(permission string) bool {
+	for _, name := range p.Permissions {
+		if name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the principal may act within the scope. Logins
+// are not limited by scopes; personal access tokens only have theirs.
+func (p Principal) HasScope(scope string) bool {
+	if p.AccessTokenID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrErasureNotFound      = fmt.Errorf("No pending erasure request with this id")
+	ErrInvalidErasureStatus = fmt.Errorf("Status must be pending, cancelled or completed")
+)
+
+type PrivacyService interface {
+	Export(ctx context.Context) (archive []byte, filename string, err error)
+	ErasureRequests(ctx context.Context, status string) (requests []models.ErasureRequest, err error)
+	Erase(ctx context.Context, requestId int) (summary map[string]int64, err error)
+	ProcessErasures() (erased int, err error)
+}
+
+type privacyService struct {
+	repo  repository.PrivacyRepository
+	audit AuditLogger
+}
+
+func NewPrivacyService(repo repository.PrivacyRepository, audit AuditLogger) PrivacyService {
+	return &privacyService{
+		repo:  repo,
+		audit: audit,
+	}
+}
+
+// Export packs everything stored about the caller into a zip with one JSON
+// file per section and a manifest listing them.
+func (s *privacyService) Export(ctx context.Context) (archive []byte, filename string, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	export, err := s.repo.Export(principal.UserID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	sections := make([]string, 0, len(export))
+	for name := range export {
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+
+	files := make([]string, 0, len(sections))
+	for _, name := range sections {
+		files = append(files, name+".json")
+		err = write(name+".json", export[name])
+		if err != nil {
+			return
+		}
+	}
+	err = write("manifest.json", map[string]interface{}{
+		"user_id":      principal.UserID,
+		"username":     principal.Username,
+		"generated_at": now,
+		"files":        files,
+	})
+	if err != nil {
+		return
+	}
+	err = zw.Close()
+	if err != nil {
+		return
+	}
+
+	s.audit.Log(auditEntry(ctx, models.AuditDataExport, models.AuditTargetUser, strconv.Itoa(principal.UserID)))
+	filename = fmt.Sprintf("file-explorers-%s-%s.zip", principal.Username, now.Format("20060102"))
+	return buf.Bytes(), filename, nil
+}
+
+func (s *privacyService) ErasureRequests(ctx context.Context, status string) (requests []models.ErasureRequest, err error) {
+	if status == "" {
+		status = models.ErasurePending
+	}
+	if status != models.ErasurePending && status != models.ErasureCancelled && status != models.ErasureCompleted {
+		return nil, ErrInvalidErasureStatus
+	}
+	return s.repo.ListErasureRequests(status)
+}
+
+// Erase runs a pending request now instead of at the end of its grace
+// period, for example when a parent asks for it by email.
+func (s *privacyService) Erase(ctx context.Context, requestId int) (summary map[string]int64, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	summary, err = s.erase(requestId, &principal.UserID)
+	if err == repository.ErrErasureRequestNotFound {
+		return nil, ErrErasureNotFound
+	}
+	if err != nil {
+		return
+	}
+	entry := auditEntry(ctx, models.AuditErase, models.AuditTargetErasure, strconv.Itoa(requestId))
+	entry.Details = map[string]interface{}{"deleted": summary}
+	s.audit.Log(entry)
+	return summary, nil
+}
+
+// ProcessErasures erases the accounts whose grace period has ended. One
+// failing account does not hold up the others.
+func (s *privacyService) ProcessErasures() (erased int, err error) {
+	ids, err := s.repo.DueErasures()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		summary, err := s.erase(id, nil)
+		if err != nil {
+			log.Printf("Failed to process erasure request %d: %v\n", id, err)
+			continue
+		}
+		s.audit.Log(models.AuditEntry{
+			Action:     models.AuditErase,
+			TargetType: models.AuditTargetErasure,
+			TargetID:   strconv.Itoa(id),
+			Details:    map[string]interface{}{"deleted": summary},
+		})
+		erased++
+	}
+	return erased, nil
+}
+
+func (s *privacyService) erase(requestId int, completedBy *int) (summary map[string]int64, err error) {
+	username, err := randomToken(6, hex.EncodeToString)
+	if err != nil {
+		return
+	}
+	return s.repo.Erase(requestId, "erased-"+username, completedBy)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrMissingRole = fmt.Errorf("No role given")
+	ErrLastAdmin   = fmt.Errorf("Cannot remove the last admin")
+	ErrGuestRole   = fmt.Errorf("Guest accounts cannot be given roles")
+)
+
+type RoleService interface {
+	Roles(ctx context.Context) (roles []models.Role, err error)
+	UserRoles(ctx context.Context, userId int) (roles []models.UserRole, err error)
+	Grant(ctx context.Context, userId int, role string) (roles []models.UserRole, err error)
+	Revoke(ctx context.Context, userId int, role string) (roles []models.UserRole, err error)
+	SetTwoFactor(ctx context.Context, role string, required bool) (roles []models.Role, err error)
+}
+
+type roleService struct {
+	repo      repository.RoleRepository
+	authRepo  repository.AuthRepository
+	tokenRepo repository.TokenRepository
+	audit     AuditLogger
+}
+
+func NewRoleService(repo repository.RoleRepository, authRepo repository.AuthRepository, tokenRepo repository.TokenRepository, audit AuditLogger) RoleService {
+	return &roleService{
+		repo:      repo,
+		authRepo:  authRepo,
+		tokenRepo: tokenRepo,
+		audit:     audit,
+	}
+}
+
+func (s *roleService) Roles(ctx context.Context) (roles []models.Role, err error) {
+	return s.repo.ListRoles()
+}
+
+func (s *roleService) UserRoles(ctx context.Context, userId int) (roles []models.UserRole, err error) {
+	return s.repo.UserRoles(userId)
+}
+
+// Grant gives the user a role. Their current access token is made stale so
+// the new role shows up on the next refresh rather than at the next login.
+// Guest accounts are throwaway and never hold roles.
+func (s *roleService) Grant(ctx context.Context, userId int, role string) (roles []models.UserRole, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	if role == "" {
+		return nil, ErrMissingRole
+	}
+	user, err := s.authRepo.GetUser(userId)
+	if err != nil {
+		return
+	}
+	if user.Guest {
+		return nil, ErrGuestRole
+	}
+
+	err = s.repo.GrantRole(userId, role, &principal.UserID)
+	if err != nil {
+		return
+	}
+	entry := auditEntry(ctx, models.AuditRoleGrant, models.AuditTargetUser, strconv.Itoa(userId))
+	entry.Details = map[string]interface{}{"role": role}
+	s.audit.Log(entry)
+	err = s.tokenRepo.BumpTokenVersion(userId)
+	if err != nil {
+		return
+	}
+	return s.repo.UserRoles(userId)
+}
+
+func (s *roleService) Revoke(ctx context.Context, userId int, role string) (roles []models.UserRole, err error) {
+	if role == models.RoleAdmin {
+		count, err := s.repo.CountRoleMembers(models.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if count <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+
+	err = s.repo.RevokeRole(userId, role)
+	if err != nil {
+		return
+	}
+	entry := auditEntry(ctx, models.AuditRoleRevoke, models.AuditTargetUser, strconv.Itoa(userId))
+	entry.Details = map[string]interface{}{"role": role}
+	s.audit.Log(entry)
+	err = s.tokenRepo.BumpTokenVersion(userId)
+	if err != nil {
+		return
+	}
+	return s.repo.UserRoles(userId)
+}
+
+// SetTwoFactor decides whether members of a role must have two-factor
+// authentication enabled to use it. Tokens already issued keep their
+// permissions until they expire.
+func (s *roleService) SetTwoFactor(ctx context.Context, role string, required bool) (roles []models.Role, err error) {
+	err = s.repo.SetRoleTwoFactor(role, required)
+	if err != nil {
+		return
+	}
+	entry := auditEntry(ctx, models.AuditRoleTwoFactor, models.AuditTargetRole, role)
+	entry.Details = map[string]interface{}{"required": required}
+	s.audit.Log(entry)
+	return s.repo.ListRoles()
+}
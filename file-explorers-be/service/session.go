@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrSessionNotFound = fmt.Errorf("Session not found or already ended")
+
+const maxUserAgent = 255
+
+type SessionService interface {
+	List(ctx context.Context) (sessions []models.Session, err error)
+	Revoke(ctx context.Context, sessionId string) (err error)
+	UserSessions(ctx context.Context, userId int) (sessions []models.Session, err error)
+	RevokeUserSession(ctx context.Context, userId int, sessionId string) (err error)
+	RevokeUserSessions(ctx context.Context, userId int) (err error)
+	Touch(sessionId, ip, userAgent string) (err error)
+}
+
+type sessionService struct {
+	repo      repository.SessionRepository
+	tokenRepo repository.TokenRepository
+	audit     AuditLogger
+}
+
+func NewSessionService(repo repository.SessionRepository, tokenRepo repository.TokenRepository, audit AuditLogger) SessionService {
+	return &sessionService{
+		repo:      repo,
+		tokenRepo: tokenRepo,
+		audit:     audit,
+	}
+}
+
+// List shows the caller's sessions, with the one the request came from
+// marked as current.
+func (s *sessionService) List(ctx context.Context) (sessions []models.Session, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	sessions, err = s.repo.ListSessions(principal.UserID)
+	if err != nil {
+		return
+	}
+	for i := range sessions {
+		sessions[i].Device = describeDevice(sessions[i].UserAgent)
+		sessions[i].Current = sessions[i].ID == principal.SessionID
+	}
+	return sessions, nil
+}
+
+// Revoke signs one of the caller's sessions out, for example on a shared
+// classroom PC someone forgot to log out of. Its access token stops working
+// on the next request.
+func (s *sessionService) Revoke(ctx context.Context, sessionId string) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.revoke(ctx, principal.UserID, sessionId)
+}
+
+func (s *sessionService) UserSessions(ctx context.Context, userId int) (sessions []models.Session, err error) {
+	sessions, err = s.repo.ListSessions(userId)
+	if err != nil {
+		return
+	}
+	for i := range sessions {
+		sessions[i].Device = describeDevice(sessions[i].UserAgent)
+	}
+	return sessions, nil
+}
+
+func (s *sessionService) RevokeUserSession(ctx context.Context, userId int, sessionId string) (err error) {
+	return s.revoke(ctx, userId, sessionId)
+}
+
+func (s *sessionService) RevokeUserSessions(ctx context.Context, userId int) (err error) {
+	err = s.tokenRepo.RevokeUserTokens(userId)
+	if err != nil {
+		return
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditLogoutAll, models.AuditTargetUser, strconv.Itoa(userId)))
+	return nil
+}
+
+// Touch records the address and browser a session was last used from.
+func (s *sessionService) Touch(sessionId, ip, userAgent string) (err error) {
+	if len(userAgent) > maxUserAgent {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgent], "")
+	}
+	return s.repo.TouchSession(sessionId, ip, userAgent)
+}
+
+func (s *sessionService) revoke(ctx context.Context, userId int, sessionId string) (err error) {
+	err = s.repo.RevokeSession(userId, sessionId)
+	if err == repository.ErrSessionNotFound {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return
+	}
+	entry := auditEntry(ctx, models.AuditSessionRevoke, models.AuditTargetSession, sessionId)
+	entry.Details = map[string]interface{}{"user_id": userId}
+	s.audit.Log(entry)
+	return nil
+}
+
+// describeDevice names the browser and operating system in a user agent
+// well enough to tell sessions apart.
+func describeDevice(userAgent string) string {
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		// Order matters: Edge and Opera also claim to be Chrome, and
+		// Chrome claims to be Safari.
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"python-requests/", "Python"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, o := range []struct{ token, name string }{
+		{"CrOS", "ChromeOS"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			system = o.name
+			break
+		}
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
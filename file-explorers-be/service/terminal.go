@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"file-explorers-be/shell"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Replays are meant for a solution, not for scripting the shell.
+	maxTranscriptCommands = 100
+	maxCommandLength      = 1000
+
+	// Only the newest commands of a user in a level are kept in the log.
+	maxLoggedCommands = 1000
+
+	// A solved transcript starts at terminalBaseScore and loses points for
+	// every command and keystroke, but never drops below terminalMinScore.
+	terminalBaseScore        = 1000
+	terminalMinScore         = 100
+	terminalCommandPenalty   = 25
+	terminalKeystrokePenalty = 1
+)
+
+var (
+	ErrTranscriptEmpty   = fmt.Errorf("Transcript contains no commands")
+	ErrTranscriptTooLong = fmt.Errorf("Transcript exceeds %d commands", maxTranscriptCommands)
+	ErrCommandTooLong    = fmt.Errorf("Commands are limited to %d characters", maxCommandLength)
+)
+
+type TerminalService interface {
+	Run(ctx context.Context, level int, command string) (result models.TerminalResult, err error)
+	Reset(ctx context.Context, level int) (err error)
+	Replay(ctx context.Context, level int, transcript models.TranscriptRequest) (result models.TranscriptResult, err error)
+}
+
+type terminalService struct {
+	repo      repository.TerminalRepository
+	levelRepo repository.LevelRepository
+}
+
+func NewTerminalService(repo repository.TerminalRepository, levelRepo repository.LevelRepository) TerminalService {
+	return &terminalService{
+		repo:      repo,
+		levelRepo: levelRepo,
+	}
+}
+
+// Run executes one command against the user's copy of the level filesystem,
+// persists the new state, logs the command and marks the level solved once
+// the filesystem matches the level solution. Command-line-only levels are
+// only recorded as solved through Replay, which scores the solution.
+func (s *terminalService) Run(ctx context.Context, level int, command string) (result models.TerminalResult, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	if len(command) > maxCommandLength {
+		return result, ErrCommandTooLong
+	}
+
+	starting, solution, err := s.repo.GetLevelSetup(level)
+	if err != nil {
+		return
+	}
+
+	state, found, err := s.repo.GetState(principal.UserID, level)
+	if err != nil {
+		return
+	}
+	if !found {
+		state = starting
+		err = s.levelRepo.StartedLevel(principal.UserID, level)
+		if err != nil {
+			return
+		}
+	}
+
+	sh := shell.New(state)
+	output, cmdErr := sh.Run(command)
+
+	state = sh.State()
+	result = models.TerminalResult{
+		Command:    command,
+		Output:     output,
+		Cwd:        sh.Cwd(),
+		OpenFolder: state.OpenFolder,
+		FileSystem: state.FileSystem,
+		Solved:     sh.Satisfies(solution),
+	}
+	if cmdErr != nil {
+		result.Error = cmdErr.Error()
+	}
+
+	err = s.repo.SaveState(principal.UserID, level, state)
+	if err != nil {
+		return
+	}
+	err = s.repo.LogCommand(principal.UserID, level, result, maxLoggedCommands)
+	if err != nil {
+		return
+	}
+
+	if !result.Solved {
+		return
+	}
+	data, err := s.levelRepo.GetLevelData(level)
+	if err != nil || data.Type == models.LevelTypeTerminal {
+		return
+	}
+	err = s.levelRepo.MarkLevelSolved(principal.UserID, level)
+	return
+}
+
+// Reset discards the user's terminal filesystem so the next command starts
+// from the level's starting filesystem again.
+func (s *terminalService) Reset(ctx context.Context, level int) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.DeleteState(principal.UserID, level)
+}
+
+// Replay runs a submitted transcript from the level's starting filesystem and,
+// when the result satisfies the solution, records the solve with a score based
+// on the number of commands and keystrokes used. The user's live terminal
+// state is left untouched.
+func (s *terminalService) Replay(ctx context.Context, level int, transcript models.TranscriptRequest) (result models.TranscriptResult, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	var commands []string
+	for _, command := range transcript.Commands {
+		if len(command) > maxCommandLength {
+			return result, ErrCommandTooLong
+		}
+		if strings.TrimSpace(command) != "" {
+			commands = append(commands, command)
+		}
+	}
+	if len(commands) == 0 {
+		return result, ErrTranscriptEmpty
+	}
+	if len(commands) > maxTranscriptCommands {
+		return result, ErrTranscriptTooLong
+	}
+
+	starting, solution, err := s.repo.GetLevelSetup(level)
+	if err != nil {
+		return
+	}
+
+	sh := shell.New(starting)
+	for _, command := range commands {
+		output, cmdErr := sh.Run(command)
+		step := models.TranscriptStep{
+			Command: command,
+			Output:  output,
+		}
+		if cmdErr != nil {
+			step.Error = cmdErr.Error()
+		}
+		result.Steps = append(result.Steps, step)
+	}
+
+	result.Cwd = sh.Cwd()
+	result.FileSystem = sh.State().FileSystem
+	result.Solved = sh.Satisfies(solution)
+	result.Commands = len(commands)
+	result.Keystrokes = transcriptKeystrokes(commands)
+	if !result.Solved {
+		return
+	}
+
+	result.Score = terminalScore(result.Commands, result.Keystrokes)
+	err = s.repo.LogTranscript(principal.UserID, level, result, maxLoggedCommands)
+	if err != nil {
+		return
+	}
+	err = s.levelRepo.RecordTerminalSolve(principal.UserID, level, result.Commands, result.Keystrokes, result.Score)
+	return
+}
+
+// transcriptKeystrokes counts the keys needed to type the commands, Enter
+// included. The count is computed here rather than taken from the client so
+// it cannot be made up.
+func transcriptKeystrokes(commands []string) (keystrokes int) {
+	for _, command := range commands {
+		keystrokes += len([]rune(command)) + 1
+	}
+	return
+}
+
+func terminalScore(commands, keystrokes int) int {
+	score := terminalBaseScore - commands*terminalCommandPenalty - keystrokes*terminalKeystrokePenalty
+	if score < terminalMinScore {
+		score = terminalMinScore
+	}
+	return score
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"file-explorers-be/config"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// attemptWindow is how long failed logins are remembered. A lockout longer
+// than that extends it.
+const attemptWindow = time.Hour
+
+// ThrottledError is returned while a username or address has to wait before
+// the next login attempt.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("Too many failed attempts, try again in %d seconds", e.Seconds())
+}
+
+// Seconds is the wait rounded up, as sent in the Retry-After header.
+func (e *ThrottledError) Seconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// LoginThrottle slows down password guessing. Failures are counted per
+// account: a few are free, then every failure doubles the wait before the
+// next attempt, and too many lock the account for a while. Addresses only
+// get the lockout, with a higher limit, since a whole classroom may share
+// one. Checks happen before the password hash is compared, so a
+// throttled request costs no bcrypt round.
+type LoginThrottle interface {
+	Check(ip, username string) (err error)
+	Fail(ip, username string) (locked bool, err error)
+	Clear(username string) (err error)
+}
+
+type loginThrottle struct {
+	repo       repository.AttemptRepository
+	free       int
+	maxAccount int
+	maxAddress int
+	lockout    time.Duration
+	window     time.Duration
+}
+
+func NewLoginThrottle(repo repository.AttemptRepository, cfg config.Config) LoginThrottle {
+	return &loginThrottle{
+		repo:       repo,
+		free:       cfg.LoginFreeAttempts,
+		maxAccount: cfg.LoginMaxAttempts,
+		maxAddress: cfg.LoginIPMaxAttempts,
+		lockout:    cfg.LoginLockout,
+		window:     max(attemptWindow, cfg.LoginLockout),
+	}
+}
+
+// Check returns a *ThrottledError while either the account or the address
+// has to wait.
+func (t *loginThrottle) Check(ip, username string) (err error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range t.keys(ip, username) {
+		attempts, err := t.repo.GetAttempts(key.name)
+		if err != nil {
+			return err
+		}
+		wait = max(wait, t.wait(attempts, key.free, key.limit, now))
+	}
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Fail records a failed attempt. It reports whether this failure locked the
+// account, so the owner can be told.
+func (t *loginThrottle) Fail(ip, username string) (locked bool, err error) {
+	now := time.Now()
+	for _, key := range t.keys(ip, username) {
+		attempts, err := t.repo.RecordFailure(key.name, now, t.window)
+		if err != nil {
+			return false, err
+		}
+		if key.account && attempts.Failures == key.limit {
+			locked = true
+		}
+	}
+	return locked, nil
+}
+
+// Clear forgets the account's failures after a successful login or an
+// unlock. The address keeps its count.
+func (t *loginThrottle) Clear(username string) (err error) {
+	return t.repo.ClearAttempts(accountKey(username))
+}
+
+type throttleKey struct {
+	name    string
+	free    int
+	limit   int
+	account bool
+}
+
+func (t *loginThrottle) keys(ip, username string) (keys []throttleKey) {
+	if ip != "" {
+		keys = append(keys, throttleKey{name: "ip:" + ip, free: t.maxAddress, limit: t.maxAddress})
+	}
+	if username != "" {
+		keys = append(keys, throttleKey{name: accountKey(username), free: t.free, limit: t.maxAccount, account: true})
+	}
+	return
+}
+
+// wait is how long to hold off after the given failures. A limit of 0 never
+// locks.
+func (t *loginThrottle) wait(attempts models.LoginAttempts, free, limit int, now time.Time) time.Duration {
+	var until time.Time
+	switch {
+	case limit > 0 && attempts.Failures >= limit:
+		until = attempts.LastFailure.Add(t.lockout)
+	case attempts.Failures <= free || now.Sub(attempts.LastFailure) > t.window:
+		return 0
+	default:
+		delay := t.lockout
+		if n := attempts.Failures - free - 1; n < 30 {
+			delay = min(time.Second<<n, t.lockout)
+		}
+		until = attempts.LastFailure.Add(delay)
+	}
+	return max(until.Sub(now), 0)
+}
+
+func accountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
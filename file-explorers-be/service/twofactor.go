@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"file-explorers-be/models"
+	"file-explorers-be/qr"
+	"file-explorers-be/repository"
+	"file-explorers-be/totp"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTwoFactorEnabled     = fmt.Errorf("Two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = fmt.Errorf("Two-factor authentication is not enabled")
+	ErrTwoFactorNotSetup    = fmt.Errorf("Start the two-factor setup first")
+	ErrInvalidTwoFactorCode = fmt.Errorf("Invalid or already used code")
+	ErrInvalidMFAToken      = fmt.Errorf("The sign-in took too long, please log in again")
+)
+
+const (
+	totpIssuer = "File Explorers"
+
+	recoveryCodeCount = 10
+	// recoveryAlphabet leaves out characters that are easily mixed up.
+	recoveryAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+type TwoFactorService interface {
+	Setup(ctx context.Context) (setup models.TwoFactorSetup, err error)
+	QRCode(ctx context.Context) (png []byte, err error)
+	Enable(ctx context.Context, code string) (enabled models.TwoFactorEnabled, err error)
+	Verify(mfaToken, code, ip string) (tokens models.AuthTokens, user models.User, err error)
+	Disable(ctx context.Context, code string) (err error)
+	RecoveryCodes(ctx context.Context, code string) (codes []string, err error)
+}
+
+type twoFactorService struct {
+	repo        repository.TwoFactorRepository
+	tokenRepo   repository.TokenRepository
+	authService AuthService
+	jwtService  JwtService
+	audit       AuditLogger
+}
+
+func NewTwoFactorService(repo repository.TwoFactorRepository, tokenRepo repository.TokenRepository, authService AuthService, jwtService JwtService, audit AuditLogger) TwoFactorService {
+	return &twoFactorService{
+		repo:        repo,
+		tokenRepo:   tokenRepo,
+		authService: authService,
+		jwtService:  jwtService,
+		audit:       audit,
+	}
+}
+
+// Setup starts enrolling an authenticator app. Calling it again before the
+// app is confirmed with Enable replaces the secret.
+func (s *twoFactorService) Setup(ctx context.Context) (setup models.TwoFactorSetup, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	_, enabled, err := s.repo.GetTOTPSecret(principal.UserID)
+	if err != nil {
+		return
+	}
+	if enabled {
+		return setup, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return
+	}
+	err = s.repo.SetTOTPSecret(principal.UserID, secret)
+	if err != nil {
+		return
+	}
+
+	uri := totp.URI(totpIssuer, principal.Username, secret)
+	png, err := qrCode(uri)
+	if err != nil {
+		return
+	}
+	return models.TwoFactorSetup{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// QRCode draws the pending secret again. Once enabled the secret is never
+// shown again.
+func (s *twoFactorService) QRCode(ctx context.Context) (png []byte, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	secret, enabled, err := s.repo.GetTOTPSecret(principal.UserID)
+	if err != nil {
+		return
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if secret == nil {
+		return nil, ErrTwoFactorNotSetup
+	}
+	return qrCode(totp.URI(totpIssuer, principal.Username, *secret))
+}
+
+// Enable confirms the authenticator app with a code from it. Every other
+// session is signed out, and the caller continues in a new one that carries
+// the roles which need two-factor authentication.
+func (s *twoFactorService) Enable(ctx context.Context, code string) (enabled models.TwoFactorEnabled, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	secret, isEnabled, err := s.repo.GetTOTPSecret(principal.UserID)
+	if err != nil {
+		return
+	}
+	if isEnabled {
+		return enabled, ErrTwoFactorEnabled
+	}
+	if secret == nil {
+		return enabled, ErrTwoFactorNotSetup
+	}
+
+	ok, err := s.checkTOTP(principal.UserID, *secret, code)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return enabled, ErrInvalidTwoFactorCode
+	}
+
+	err = s.repo.EnableTOTP(principal.UserID)
+	if err != nil {
+		return
+	}
+	codes, err := s.newRecoveryCodes(principal.UserID)
+	if err != nil {
+		return
+	}
+	err = s.tokenRepo.RevokeUserTokens(principal.UserID)
+	if err != nil {
+		return
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditTwoFactorOn, models.AuditTargetUser, strconv.Itoa(principal.UserID)))
+
+	tokens, user, err := s.authService.StartSession(principal.UserID)
+	if err != nil {
+		return
+	}
+	return models.TwoFactorEnabled{
+		RecoveryCodes: codes,
+		Tokens:        tokens,
+		User:          user,
+	}, nil
+}
+
+// Verify is the second step of a login: the MFA token from the first step
+// and a code from the app, or a recovery code, are exchanged for a session.
+// Wrong codes count towards the same lockout as wrong passwords.
+func (s *twoFactorService) Verify(mfaToken, code, ip string) (tokens models.AuthTokens, user models.User, err error) {
+	claims, err := s.jwtService.VerifyMFAToken(mfaToken)
+	if err != nil {
+		return tokens, user, ErrInvalidMFAToken
+	}
+	err = s.authService.CheckLogin(ip, claims.Username)
+	if err != nil {
+		return
+	}
+
+	err = s.checkCode(claims.UserID, code)
+	if err == ErrInvalidTwoFactorCode {
+		if err := s.authService.LoginFailed(ip, claims.Username); err != nil {
+			log.Println("Failed to record failed login:", err)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	// The challenge is single-use, or it could be traded for another
+	// session with any later code until it expires.
+	used, err := s.tokenRepo.UseToken(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return
+	}
+	if !used {
+		return tokens, user, ErrInvalidMFAToken
+	}
+	tokens, user, err = s.authService.StartSession(claims.UserID)
+	if err != nil {
+		return
+	}
+	entry := userAuditEntry(user, models.AuditLogin, ip)
+	entry.Details = map[string]interface{}{"method": "password+2fa"}
+	s.audit.Log(entry)
+	return tokens, user, nil
+}
+
+// Disable turns two-factor authentication off and throws away the recovery
+// codes. The roles that require it drop out at the next refresh.
+func (s *twoFactorService) Disable(ctx context.Context, code string) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	err = s.checkCode(principal.UserID, code)
+	if err != nil {
+		return
+	}
+
+	err = s.repo.DisableTOTP(principal.UserID)
+	if err != nil {
+		return
+	}
+	s.audit.Log(auditEntry(ctx, models.AuditTwoFactorOff, models.AuditTargetUser, strconv.Itoa(principal.UserID)))
+	return s.tokenRepo.BumpTokenVersion(principal.UserID)
+}
+
+// RecoveryCodes replaces the recovery codes, for when they ran out or were
+// lost.
+func (s *twoFactorService) RecoveryCodes(ctx context.Context, code string) (codes []string, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	err = s.checkCode(principal.UserID, code)
+	if err != nil {
+		return
+	}
+	return s.newRecoveryCodes(principal.UserID)
+}
+
+// checkCode accepts a code from the authenticator app or an unused recovery
+// code.
+func (s *twoFactorService) checkCode(userId int, code string) (err error) {
+	secret, enabled, err := s.repo.GetTOTPSecret(userId)
+	if err != nil {
+		return
+	}
+	if !enabled || secret == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	ok, err := s.checkTOTP(userId, *secret, code)
+	if err != nil || ok {
+		return
+	}
+
+	ok, err = s.repo.UseRecoveryCode(userId, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return
+	}
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// checkTOTP validates a code from the app. Each code works once: the step it
+// belongs to is recorded, and codes of that step or earlier are refused.
+func (s *twoFactorService) checkTOTP(userId int, secret, code string) (ok bool, err error) {
+	step, ok := totp.Validate(secret, strings.ReplaceAll(code, " ", ""), time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.repo.UseTOTPStep(userId, step)
+}
+
+// newRecoveryCodes replaces the user's recovery codes with fresh ones. Only
+// their hashes are stored, so this is the one chance to show them.
+func (s *twoFactorService) newRecoveryCodes(userId int) (codes []string, err error) {
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomToken(10, func(b []byte) string {
+			chars := make([]byte, len(b))
+			for i, c := range b {
+				chars[i] = recoveryAlphabet[int(c)%len(recoveryAlphabet)]
+			}
+			return string(chars[:5]) + "-" + string(chars[5:])
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	err = s.repo.ReplaceRecoveryCodes(userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode lets users type recovery codes in any case and with
+// or without the dash.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+}
+
+func qrCode(text string) ([]byte, error) {
+	code, err := qr.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(6)
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"file-explorers-be/circuit"
+	"file-explorers-be/logic"
+	"file-explorers-be/models"
+	"file-explorers-be/repository"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxWorkspaces        = 50
+	maxWorkspaceVersions = 20
+	maxWorkspaceName     = 100
+
+	// MaxWorkspaceSize is the largest workspace content that is stored.
+	MaxWorkspaceSize = 256 << 10
+)
+
+var (
+	ErrWorkspaceName     = fmt.Errorf("Workspace name must be 1 to %d characters", maxWorkspaceName)
+	ErrWorkspaceKind     = fmt.Errorf("Workspace kind must be %q or %q", models.WorkspaceKindCircuit, models.WorkspaceKindBoolean)
+	ErrWorkspaceContent  = fmt.Errorf("Workspace content is required")
+	ErrWorkspaceTooLarge = fmt.Errorf("Workspace content exceeds %d KiB", MaxWorkspaceSize>>10)
+	ErrTooManyWorkspaces = fmt.Errorf("You can store at most %d workspaces", maxWorkspaces)
+	ErrNotCircuit        = fmt.Errorf("Only circuit workspaces can be exported to SPICE")
+)
+
+type WorkspaceService interface {
+	List(ctx context.Context) (workspaces []models.Workspace, err error)
+	Create(ctx context.Context, req models.WorkspaceRequest) (workspace models.Workspace, err error)
+	Get(ctx context.Context, workspaceId int) (workspace models.Workspace, err error)
+	Update(ctx context.Context, workspaceId int, req models.WorkspaceRequest) (workspace models.Workspace, err error)
+	Delete(ctx context.Context, workspaceId int) (err error)
+	Versions(ctx context.Context, workspaceId int) (versions []models.WorkspaceVersion, err error)
+	Version(ctx context.Context, workspaceId, version int) (v models.WorkspaceVersion, err error)
+	Share(ctx context.Context, workspaceId int) (workspace models.Workspace, err error)
+	Unshare(ctx context.Context, workspaceId int) (err error)
+	GetShared(ctx context.Context, token string) (workspace models.Workspace, err error)
+	ExportSPICE(ctx context.Context, workspaceId int) (name, deck string, err error)
+	ImportSPICE(ctx context.Context, name, deck string) (workspace models.Workspace, err error)
+}
+
+type workspaceService struct {
+	repo repository.WorkspaceRepository
+}
+
+func NewWorkspaceService(repo repository.WorkspaceRepository) WorkspaceService {
+	return &workspaceService{
+		repo: repo,
+	}
+}
+
+func (s *workspaceService) List(ctx context.Context) (workspaces []models.Workspace, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.ListWorkspaces(principal.UserID)
+}
+
+func (s *workspaceService) Create(ctx context.Context, req models.WorkspaceRequest) (workspace models.Workspace, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxWorkspaceName {
+		return workspace, ErrWorkspaceName
+	}
+	content, err := validateWorkspace(req.Kind, req.Content)
+	if err != nil {
+		return
+	}
+
+	workspaceId, err := s.repo.CreateWorkspace(principal.UserID, name, req.Kind, content, maxWorkspaces)
+	if err == repository.ErrWorkspaceLimit {
+		return workspace, ErrTooManyWorkspaces
+	}
+	if err != nil {
+		return
+	}
+	return s.repo.GetWorkspace(principal.UserID, workspaceId)
+}
+
+func (s *workspaceService) Get(ctx context.Context, workspaceId int) (workspace models.Workspace, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.GetWorkspace(principal.UserID, workspaceId)
+}
+
+// Update renames the workspace and saves new content as the next version. The
+// kind of a workspace cannot change.
+func (s *workspaceService) Update(ctx context.Context, workspaceId int, req models.WorkspaceRequest) (workspace models.Workspace, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	existing, err := s.repo.GetWorkspace(principal.UserID, workspaceId)
+	if err != nil {
+		return
+	}
+	if req.Kind != "" && req.Kind != existing.Kind {
+		return workspace, fmt.Errorf("Workspace kind cannot be changed from %q", existing.Kind)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if len(name) > maxWorkspaceName {
+		return workspace, ErrWorkspaceName
+	}
+
+	var content []byte
+	if req.Content != nil {
+		content, err = validateWorkspace(existing.Kind, req.Content)
+		if err != nil {
+			return
+		}
+	}
+
+	err = s.repo.UpdateWorkspace(principal.UserID, workspaceId, name, content, maxWorkspaceVersions)
+	if err != nil {
+		return
+	}
+	return s.repo.GetWorkspace(principal.UserID, workspaceId)
+}
+
+func (s *workspaceService) Delete(ctx context.Context, workspaceId int) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.DeleteWorkspace(principal.UserID, workspaceId)
+}
+
+func (s *workspaceService) Versions(ctx context.Context, workspaceId int) (versions []models.WorkspaceVersion, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.ListVersions(principal.UserID, workspaceId)
+}
+
+func (s *workspaceService) Version(ctx context.Context, workspaceId, version int) (v models.WorkspaceVersion, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.GetVersion(principal.UserID, workspaceId, version)
+}
+
+// Share creates a new share link for the workspace, replacing any earlier one.
+func (s *workspaceService) Share(ctx context.Context, workspaceId int) (workspace models.Workspace, err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+
+	bytes := make([]byte, 16)
+	_, err = rand.Read(bytes)
+	if err != nil {
+		return
+	}
+	token := hex.EncodeToString(bytes)
+
+	err = s.repo.SetShareToken(principal.UserID, workspaceId, &token)
+	if err != nil {
+		return
+	}
+	return s.repo.GetWorkspace(principal.UserID, workspaceId)
+}
+
+func (s *workspaceService) Unshare(ctx context.Context, workspaceId int) (err error) {
+	principal, err := PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.SetShareToken(principal.UserID, workspaceId, nil)
+}
+
+// GetShared opens someone else's workspace through its share link. The copy
+// is read-only; the viewer can save it as their own workspace.
+func (s *workspaceService) GetShared(ctx context.Context, token string) (workspace models.Workspace, err error) {
+	_, err = PrincipalFromCtx(ctx)
+	if err != nil {
+		return
+	}
+	return s.repo.GetSharedWorkspace(token)
+}
+
+// ExportSPICE converts the latest version of a circuit workspace to a SPICE
+// deck. The workspace name is returned for the download's file name.
+func (s *workspaceService) ExportSPICE(ctx context.Context, workspaceId int) (name, deck string, err error) {
+	workspace, err := s.Get(ctx, workspaceId)
+	if err != nil {
+		return
+	}
+	if workspace.Kind != models.WorkspaceKindCircuit {
+		return "", "", ErrNotCircuit
+	}
+
+	c, err := circuit.Decode(workspace.Content)
+	if err != nil {
+		return
+	}
+	deck, err = circuit.ToSPICE(c, workspace.Name)
+	return workspace.Name, deck, err
+}
+
+// ImportSPICE reads a SPICE deck into a new circuit workspace. Without a name
+// the deck's title line is used.
+func (s *workspaceService) ImportSPICE(ctx context.Context, name, deck string) (workspace models.Workspace, err error) {
+	if len(deck) > MaxWorkspaceSize {
+		return workspace, ErrWorkspaceTooLarge
+	}
+
+	c, title, err := circuit.FromSPICE(deck)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(name) == "" {
+		name = title
+	}
+	return s.Create(ctx, models.WorkspaceRequest{
+		Name:    name,
+		Kind:    models.WorkspaceKindCircuit,
+		Content: c,
+	})
+}
+
+// validateWorkspace checks the content against its kind's format and returns
+// it encoded for storage.
+func validateWorkspace(kind string, content interface{}) (data []byte, err error) {
+	if content == nil {
+		return nil, ErrWorkspaceContent
+	}
+	data, err = json.Marshal(content)
+	if err != nil {
+		return
+	}
+	if len(data) > MaxWorkspaceSize {
+		return nil, ErrWorkspaceTooLarge
+	}
+
+	switch kind {
+	case models.WorkspaceKindCircuit:
+		_, err = circuit.Parse(data)
+	case models.WorkspaceKindBoolean:
+		_, err = logic.Parse(data)
+	default:
+		err = ErrWorkspaceKind
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,443 @@
+package shell
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	// globs enables wildcard expansion of the command's arguments.
+	globs bool
+	usage string
+	run   func(sh *Shell, args []string) (string, error)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help":  {usage: "help [command]           - Show help for a command", run: (*Shell).help},
+		"ls":    {globs: true, usage: "ls [path...]             - List files and directories", run: (*Shell).ls},
+		"pwd":   {usage: "pwd                      - Print working directory", run: (*Shell).pwd},
+		"echo":  {usage: "echo <text>              - Display text", run: (*Shell).echo},
+		"cd":    {globs: true, usage: "cd [dir]                 - Change directory", run: (*Shell).cd},
+		"mkdir": {usage: "mkdir [-p] <dir...>      - Create directory", run: (*Shell).mkdir},
+		"rm":    {globs: true, usage: "rm [-r] <path...>        - Remove file or directory", run: (*Shell).rm},
+		"touch": {usage: "touch <file...>          - Create file", run: (*Shell).touch},
+		"cp":    {globs: true, usage: "cp [-r] <src...> <dst>   - Copy file or directory", run: (*Shell).cp},
+		"mv":    {globs: true, usage: "mv <src...> <dst>        - Move or rename file or directory", run: (*Shell).mv},
+		"find":  {usage: "find [dir] [-name] <pat> - Search for files and directories", run: (*Shell).find},
+	}
+}
+
+// Commands returns the names of the supported commands, sorted.
+func Commands() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flags splits leading single-letter options such as -r or -rf from the rest of
+// the arguments. A "--" argument ends option parsing.
+func flags(name string, args []string, allowed string) (set map[rune]bool, rest []string, err error) {
+	set = map[rune]bool{}
+	for i, arg := range args {
+		if arg == "--" {
+			return set, args[i+1:], nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			return set, args[i:], nil
+		}
+		for _, ch := range arg[1:] {
+			if !strings.ContainsRune(allowed, ch) {
+				return nil, nil, fmt.Errorf("%s: invalid option -- '%c'", name, ch)
+			}
+			set[ch] = true
+		}
+	}
+	return set, nil, nil
+}
+
+func (sh *Shell) help(args []string) (string, error) {
+	if len(args) > 0 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return "", fmt.Errorf("No help available for: %s", args[0])
+		}
+		return "Usage: " + cmd.usage, nil
+	}
+
+	lines := []string{"Available commands:"}
+	for _, name := range Commands() {
+		lines = append(lines, "  "+commands[name].usage)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (sh *Shell) ls(args []string) (string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	// Files given as arguments are listed together first, then each
+	// directory's contents, as ls does.
+	var files []string
+	var dirs []string
+	for _, arg := range args {
+		f, err := sh.lookup(arg)
+		if err != nil {
+			return "", fmt.Errorf("ls: %s: %v", arg, err)
+		}
+		if isDir(f) {
+			dirs = append(dirs, arg)
+		} else {
+			files = append(files, f.Name)
+		}
+	}
+
+	var sections []string
+	if len(files) > 0 {
+		sections = append(sections, strings.Join(files, "  "))
+	}
+	for _, arg := range dirs {
+		f, _ := sh.lookup(arg)
+		var subdirs, entries []string
+		for _, c := range sh.children(folderID(f)) {
+			if c.IsDirectory {
+				subdirs = append(subdirs, c.Name+"/")
+			} else {
+				entries = append(entries, c.Name)
+			}
+		}
+		listing := strings.Join(append(subdirs, entries...), "  ")
+		if listing == "" {
+			listing = "Directory is empty"
+		}
+		if len(args) > 1 {
+			listing = arg + ":\n" + listing
+		}
+		sections = append(sections, listing)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+func (sh *Shell) pwd(args []string) (string, error) {
+	return sh.Cwd(), nil
+}
+
+func (sh *Shell) echo(args []string) (string, error) {
+	return strings.Join(args, " "), nil
+}
+
+func (sh *Shell) cd(args []string) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("cd: too many arguments")
+	}
+	if len(args) == 0 || args[0] == "/" {
+		sh.cwd = nil
+		return "Changed to root directory", nil
+	}
+
+	target := args[0]
+	f, err := sh.lookup(target)
+	if err != nil {
+		return "", fmt.Errorf("cd: %s: %v", target, err)
+	}
+	if !isDir(f) {
+		return "", fmt.Errorf("cd: %s: %v", target, errNotDir)
+	}
+
+	sh.cwd = folderID(f)
+	return "Changed to " + sh.Cwd(), nil
+}
+
+func (sh *Shell) mkdir(args []string) (string, error) {
+	opts, args, err := flags("mkdir", args, "p")
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("mkdir: missing directory name")
+	}
+
+	var out []string
+	for _, arg := range args {
+		if opts['p'] {
+			if err := sh.mkdirAll(arg); err != nil {
+				return strings.Join(out, "\n"), fmt.Errorf("mkdir: %s: %v", arg, err)
+			}
+			out = append(out, "Created directory: "+arg)
+			continue
+		}
+
+		dir, name, err := sh.lookupNew(arg)
+		if err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("mkdir: %s: %v", arg, err)
+		}
+		if sh.child(dir, name) != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("mkdir: %s: %v", arg, errExists)
+		}
+		if err := sh.room(1); err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("mkdir: %s: %v", arg, err)
+		}
+		sh.create(dir, name, true)
+		out = append(out, "Created directory: "+arg)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+func (sh *Shell) mkdirAll(p string) error {
+	dir := sh.cwd
+	if strings.HasPrefix(p, "/") {
+		dir = nil
+	}
+	for _, part := range strings.Split(p, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			dir = sh.parent(dir)
+			continue
+		}
+		f := sh.child(dir, part)
+		if f == nil {
+			if err := sh.room(1); err != nil {
+				return err
+			}
+			f = sh.create(dir, part, true)
+		} else if !f.IsDirectory {
+			return errNotDir
+		}
+		dir = intPtr(f.ID)
+	}
+	return nil
+}
+
+func (sh *Shell) rm(args []string) (string, error) {
+	opts, args, err := flags("rm", args, "rRf")
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("rm: missing file or directory name")
+	}
+	recursive := opts['r'] || opts['R']
+
+	var out []string
+	for _, arg := range args {
+		f, err := sh.lookup(arg)
+		if err != nil {
+			if opts['f'] && err == errNotFound {
+				continue
+			}
+			return strings.Join(out, "\n"), fmt.Errorf("rm: %s: %v", arg, err)
+		}
+		if f == nil {
+			return strings.Join(out, "\n"), fmt.Errorf("rm: %s: cannot remove the root directory", arg)
+		}
+		if f.IsDirectory && !recursive {
+			return strings.Join(out, "\n"), fmt.Errorf("rm: %s: is a directory (use -r to remove directories)", arg)
+		}
+		sh.remove(f)
+		out = append(out, "Removed: "+arg)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+func (sh *Shell) touch(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("touch: missing file name")
+	}
+
+	var out []string
+	for _, arg := range args {
+		dir, name, err := sh.lookupNew(arg)
+		if err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("touch: %s: %v", arg, err)
+		}
+		if sh.child(dir, name) != nil {
+			out = append(out, "File already exists: "+arg)
+			continue
+		}
+		if err := sh.room(1); err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("touch: %s: %v", arg, err)
+		}
+		sh.create(dir, name, false)
+		out = append(out, "Created file: "+arg)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// destination resolves the last argument of cp and mv. When it names an
+// existing directory the sources keep their names; otherwise exactly one
+// source is allowed and it takes the destination's name.
+func (sh *Shell) destination(name string, sources []string, dst string) (dir *int, newName string, err error) {
+	f, err := sh.lookup(dst)
+	if err == nil && isDir(f) {
+		return folderID(f), "", nil
+	}
+	if len(sources) > 1 {
+		return nil, "", fmt.Errorf("%s: %s: Target must be a directory when copying or moving multiple files", name, dst)
+	}
+	if err == nil {
+		return nil, "", fmt.Errorf("%s: %s: %v", name, dst, errExists)
+	}
+	if err != errNotFound {
+		return nil, "", fmt.Errorf("%s: %s: %v", name, dst, err)
+	}
+
+	dir, newName, err = sh.lookupNew(dst)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %s: %v", name, dst, err)
+	}
+	return dir, newName, nil
+}
+
+func (sh *Shell) cp(args []string) (string, error) {
+	_, args, err := flags("cp", args, "rR")
+	if err != nil {
+		return "", err
+	}
+	if len(args) < 2 {
+		return "", fmt.Errorf("cp: missing source or destination")
+	}
+	sources, dst := args[:len(args)-1], args[len(args)-1]
+
+	dir, newName, err := sh.destination("cp", sources, dst)
+	if err != nil {
+		return "", err
+	}
+
+	var out []string
+	for _, src := range sources {
+		f, err := sh.lookup(src)
+		if err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("cp: %s: %v", src, err)
+		}
+		if f == nil {
+			return strings.Join(out, "\n"), fmt.Errorf("cp: %s: cannot copy the root directory", src)
+		}
+		if f.IsDirectory && sh.contains(f, dir) {
+			return strings.Join(out, "\n"), fmt.Errorf("cp: %s: cannot copy a directory into itself", src)
+		}
+
+		name := newName
+		if name == "" {
+			name = f.Name
+		}
+		if sh.child(dir, name) != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("cp: %s: %v", path.Join(sh.path(dir), name), errExists)
+		}
+		if err := sh.room(len(sh.subtree(f.ID))); err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("cp: %s: %v", src, err)
+		}
+		sh.copyTree(f, dir, name)
+		out = append(out, fmt.Sprintf("Copied %s to %s", src, dst))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+func (sh *Shell) mv(args []string) (string, error) {
+	_, args, err := flags("mv", args, "f")
+	if err != nil {
+		return "", err
+	}
+	if len(args) < 2 {
+		return "", fmt.Errorf("mv: missing source or destination")
+	}
+	sources, dst := args[:len(args)-1], args[len(args)-1]
+
+	dir, newName, err := sh.destination("mv", sources, dst)
+	if err != nil {
+		return "", err
+	}
+
+	var out []string
+	for _, src := range sources {
+		f, err := sh.lookup(src)
+		if err != nil {
+			return strings.Join(out, "\n"), fmt.Errorf("mv: %s: %v", src, err)
+		}
+		if f == nil {
+			return strings.Join(out, "\n"), fmt.Errorf("mv: %s: cannot move the root directory", src)
+		}
+		if f.IsDirectory && sh.contains(f, dir) {
+			return strings.Join(out, "\n"), fmt.Errorf("mv: %s: cannot move a directory into itself", src)
+		}
+
+		name := newName
+		if name == "" {
+			name = f.Name
+		}
+		if existing := sh.child(dir, name); existing != nil && existing.ID != f.ID {
+			return strings.Join(out, "\n"), fmt.Errorf("mv: %s: %v", path.Join(sh.path(dir), name), errExists)
+		}
+		f.ParentDirectoryID = dir
+		f.Name = name
+		out = append(out, fmt.Sprintf("Moved %s to %s", src, dst))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+func (sh *Shell) find(args []string) (string, error) {
+	start := "."
+	pattern := ""
+	switch {
+	case len(args) == 1:
+		pattern = args[0]
+	case len(args) == 2 && args[0] == "-name":
+		pattern = args[1]
+	case len(args) == 2:
+		start, pattern = args[0], args[1]
+	case len(args) == 3 && args[1] == "-name":
+		start, pattern = args[0], args[2]
+	default:
+		return "", fmt.Errorf("find: missing search pattern")
+	}
+	if len(args) == 1 {
+		// A bare pattern searches the whole filesystem, like the in-browser terminal.
+		start = "/"
+	}
+
+	root, err := sh.lookup(start)
+	if err != nil {
+		return "", fmt.Errorf("find: %s: %v", start, err)
+	}
+	if !isDir(root) {
+		return "", fmt.Errorf("find: %s: %v", start, errNotDir)
+	}
+
+	glob := hasMeta(pattern)
+	var results []string
+	var walk func(dir *int, prefix string)
+	walk = func(dir *int, prefix string) {
+		for _, c := range sh.children(dir) {
+			p := joinPath(prefix, c.Name)
+			matched := strings.Contains(c.Name, pattern)
+			if glob {
+				matched, _ = path.Match(pattern, c.Name)
+			}
+			if matched {
+				kind := "f"
+				if c.IsDirectory {
+					kind = "d"
+				}
+				results = append(results, fmt.Sprintf("[%s] %s", kind, p))
+			}
+			if c.IsDirectory {
+				walk(intPtr(c.ID), p)
+			}
+		}
+	}
+	walk(folderID(root), sh.path(folderID(root)))
+
+	if len(results) == 0 {
+		return "", fmt.Errorf("find: no files or directories matching '%s'", pattern)
+	}
+	return strings.Join(results, "\n"), nil
+}
@@ -0,0 +1,334 @@
+package shell
+
+import (
+	"errors"
+	"file-explorers-be/models"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	errNotFound    = errors.New("No such file or directory")
+	errNotDir      = errors.New("Not a directory")
+	errExists      = errors.New("File or directory already exists")
+	errInvalidName = errors.New("Invalid file name")
+	errTooMany     = errors.New("No space left in this level")
+)
+
+// MaxFiles caps the size of a level filesystem. Lookups scan the whole list,
+// and the state is saved after every command, so it must stay small.
+const MaxFiles = 2000
+
+func (sh *Shell) file(id int) *models.File {
+	for i := range sh.files {
+		if sh.files[i].ID == id {
+			return &sh.files[i]
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) children(dir *int) (files []*models.File) {
+	for i := range sh.files {
+		if sameID(sh.files[i].ParentDirectoryID, dir) {
+			files = append(files, &sh.files[i])
+		}
+	}
+	return
+}
+
+func (sh *Shell) child(dir *int, name string) *models.File {
+	for i := range sh.files {
+		if sh.files[i].Name == name && sameID(sh.files[i].ParentDirectoryID, dir) {
+			return &sh.files[i]
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) parent(dir *int) *int {
+	if dir == nil {
+		return nil
+	}
+	if f := sh.file(*dir); f != nil {
+		return f.ParentDirectoryID
+	}
+	return nil
+}
+
+// path returns the absolute path of a folder, "/" for the root.
+func (sh *Shell) path(dir *int) string {
+	var parts []string
+	for depth := 0; dir != nil && depth <= len(sh.files); depth++ {
+		f := sh.file(*dir)
+		if f == nil {
+			break
+		}
+		parts = append([]string{f.Name}, parts...)
+		dir = f.ParentDirectoryID
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// lookup resolves an absolute or relative path. The root folder resolves to a
+// nil file and a nil error.
+func (sh *Shell) lookup(p string) (*models.File, error) {
+	dir := sh.cwd
+	if strings.HasPrefix(p, "/") {
+		dir = nil
+	}
+
+	var f *models.File
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			dir = sh.parent(dir)
+		default:
+			next := sh.child(dir, part)
+			if next == nil {
+				return nil, errNotFound
+			}
+			if !next.IsDirectory && i < len(parts)-1 {
+				return nil, errNotDir
+			}
+			dir = intPtr(next.ID)
+		}
+	}
+
+	if dir != nil {
+		f = sh.file(*dir)
+	}
+	if strings.HasSuffix(p, "/") && !isDir(f) {
+		return nil, errNotDir
+	}
+	return f, nil
+}
+
+// lookupNew resolves the folder a new entry at path p would be created in,
+// along with the entry's name. The entry itself does not need to exist.
+func (sh *Shell) lookupNew(p string) (dir *int, name string, err error) {
+	trimmed := strings.TrimRight(p, "/")
+	name = path.Base(trimmed)
+	if trimmed == "" || name == "." || name == ".." {
+		return nil, "", errInvalidName
+	}
+
+	parentPath := trimmed[:len(trimmed)-len(name)]
+	if parentPath == "" {
+		return sh.cwd, name, nil
+	}
+
+	parent, err := sh.lookup(parentPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isDir(parent) {
+		return nil, "", errNotDir
+	}
+	return folderID(parent), name, nil
+}
+
+// glob expands a pattern against the filesystem, returning the matching paths
+// in the form they were written (relative or absolute), sorted.
+func (sh *Shell) glob(pattern string) (matches []string) {
+	type candidate struct {
+		dir  *int
+		path string
+	}
+
+	start := candidate{dir: sh.cwd}
+	if strings.HasPrefix(pattern, "/") {
+		start = candidate{dir: nil, path: "/"}
+	}
+	wantDir := strings.HasSuffix(pattern, "/")
+
+	var parts []string
+	for _, part := range strings.Split(pattern, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	current := []candidate{start}
+	for i, part := range parts {
+		last := i == len(parts)-1
+		var next []candidate
+		for _, c := range current {
+			if !hasMeta(part) {
+				name := unescape(part)
+				switch name {
+				case ".":
+					next = append(next, candidate{c.dir, joinPath(c.path, name)})
+				case "..":
+					next = append(next, candidate{sh.parent(c.dir), joinPath(c.path, name)})
+				default:
+					f := sh.child(c.dir, name)
+					if f != nil && (f.IsDirectory || (last && !wantDir)) {
+						next = append(next, candidate{intPtr(f.ID), joinPath(c.path, f.Name)})
+					}
+				}
+				continue
+			}
+
+			for _, f := range sh.children(c.dir) {
+				if ok, _ := path.Match(part, f.Name); !ok {
+					continue
+				}
+				if f.IsDirectory || (last && !wantDir) {
+					next = append(next, candidate{intPtr(f.ID), joinPath(c.path, f.Name)})
+				}
+			}
+		}
+		current = next
+	}
+
+	for _, c := range current {
+		if c.path == "" {
+			continue
+		}
+		if wantDir {
+			c.path += "/"
+		}
+		matches = append(matches, c.path)
+	}
+	sort.Strings(matches)
+	return
+}
+
+// room reports whether n more entries fit into the filesystem.
+func (sh *Shell) room(n int) error {
+	if len(sh.files)+n > MaxFiles {
+		return errTooMany
+	}
+	return nil
+}
+
+func (sh *Shell) create(dir *int, name string, isDirectory bool) *models.File {
+	sh.files = append(sh.files, models.File{
+		ID:                sh.nextID,
+		Name:              name,
+		IsDirectory:       isDirectory,
+		ParentDirectoryID: dir,
+	})
+	sh.nextID++
+	return &sh.files[len(sh.files)-1]
+}
+
+// remove deletes an entry and everything below it. If the open folder was
+// removed the shell moves to the removed entry's parent.
+func (sh *Shell) remove(f *models.File) {
+	removed := map[int]bool{}
+	for _, id := range sh.subtree(f.ID) {
+		removed[id] = true
+	}
+
+	if sh.cwd != nil && removed[*sh.cwd] {
+		sh.cwd = f.ParentDirectoryID
+	}
+
+	kept := sh.files[:0]
+	for _, file := range sh.files {
+		if !removed[file.ID] {
+			kept = append(kept, file)
+		}
+	}
+	sh.files = kept
+}
+
+// copyTree copies an entry and everything below it into dir under a new name.
+func (sh *Shell) copyTree(f *models.File, dir *int, name string) {
+	src := *f
+	children := sh.children(intPtr(src.ID))
+	originals := make([]models.File, len(children))
+	for i, c := range children {
+		originals[i] = *c
+	}
+
+	dst := sh.create(dir, name, src.IsDirectory)
+	dstID := dst.ID
+	for i := range originals {
+		sh.copyTree(&originals[i], intPtr(dstID), originals[i].Name)
+	}
+}
+
+// subtree returns the id of f and of every entry below it.
+func (sh *Shell) subtree(id int) []int {
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range sh.children(intPtr(ids[i])) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// contains reports whether dir is f itself or lies below it.
+func (sh *Shell) contains(f *models.File, dir *int) bool {
+	for _, id := range sh.subtree(f.ID) {
+		if dir != nil && *dir == id {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(f *models.File) bool {
+	return f == nil || f.IsDirectory
+}
+
+func folderID(f *models.File) *int {
+	if f == nil {
+		return nil
+	}
+	return intPtr(f.ID)
+}
+
+func sameID(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func joinPath(base, name string) string {
+	if base == "" {
+		return name
+	}
+	if strings.HasSuffix(base, "/") {
+		return base + name
+	}
+	return base + "/" + name
+}
+
+func hasMeta(pattern string) bool {
+	escaped := false
+	for _, ch := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == '*' || ch == '?':
+			return true
+		}
+	}
+	return false
+}
+
+func unescape(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, ch := range pattern {
+		if ch == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
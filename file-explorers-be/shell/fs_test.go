@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"file-explorers-be/models"
+	"reflect"
+	"testing"
+)
+
+// testShell is a level with /docs holding a.txt, b.txt and [ab].txt, and
+// notes.md and the folder src in the root.
+func testShell() *Shell {
+	docs := 1
+	return New(models.TerminalState{FileSystem: []models.File{
+		{ID: 1, Name: "docs", IsDirectory: true},
+		{ID: 2, Name: "a.txt", ParentDirectoryID: &docs},
+		{ID: 3, Name: "b.txt", ParentDirectoryID: &docs},
+		{ID: 4, Name: "[ab].txt", ParentDirectoryID: &docs},
+		{ID: 5, Name: "notes.md"},
+		{ID: 6, Name: "src", IsDirectory: true},
+	}})
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"ls docs/*.txt", "[ab].txt  a.txt  b.txt"},
+		{"ls docs/?.txt", "a.txt  b.txt"},
+		{"ls docs/[ab].txt", "[ab].txt"},
+		{"ls docs/[ab]*", "[ab].txt"},
+		{"ls /docs/a*", "a.txt"},
+		{"ls *.md", "notes.md"},
+		{"ls */", "docs/:\na.txt  b.txt  [ab].txt\n\nsrc/:\nDirectory is empty"},
+		{`ls docs/\*`, ""},
+		{"ls docs/*.md", ""},
+	}
+	for _, tt := range tests {
+		got, err := testShell().Run(tt.line)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s = %q, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestGlobMatchesSorted(t *testing.T) {
+	got := testShell().glob("docs/*")
+	want := []string{"docs/[ab].txt", "docs/a.txt", "docs/b.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("glob = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// word is a single argument after quote removal. Glob is set when the word
+// contains wildcard characters that were not quoted or escaped; Pattern then
+// holds the text with the quoted wildcard characters escaped for path.Match.
+type word struct {
+	Text    string
+	Pattern string
+	Glob    bool
+}
+
+// parse splits a command line into words the way a POSIX shell would for the
+// subset we support: whitespace separation, single quotes, double quotes and
+// backslash escapes. Only * and ? are wildcards, as in the frontend terminal;
+// brackets are plain characters.
+func parse(line string) (words []word, err error) {
+	var current, pattern strings.Builder
+	inWord := false
+	glob := false
+	quote := rune(0)
+	escaped := false
+
+	flush := func() {
+		if inWord {
+			words = append(words, word{Text: current.String(), Pattern: pattern.String(), Glob: glob})
+		}
+		current.Reset()
+		pattern.Reset()
+		inWord = false
+		glob = false
+	}
+
+	literal := func(ch rune) {
+		current.WriteRune(ch)
+		if strings.ContainsRune("*?[]\\", ch) {
+			pattern.WriteRune('\\')
+		}
+		pattern.WriteRune(ch)
+	}
+
+	for _, ch := range line {
+		if escaped {
+			literal(ch)
+			escaped = false
+			continue
+		}
+
+		switch quote {
+		case '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				literal(ch)
+			}
+			continue
+		case '"':
+			switch ch {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				literal(ch)
+			}
+			continue
+		}
+
+		switch ch {
+		case ' ', '\t', '\n', '\r':
+			flush()
+		case '\'', '"':
+			quote = ch
+			inWord = true
+		case '\\':
+			escaped = true
+			inWord = true
+		case '*', '?':
+			glob = true
+			inWord = true
+			current.WriteRune(ch)
+			pattern.WriteRune(ch)
+		default:
+			inWord = true
+			literal(ch)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unexpected EOF while looking for matching `%c'", quote)
+	}
+	if escaped {
+		literal('\\')
+	}
+	flush()
+	return
+}
@@ -0,0 +1,43 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want []word
+	}{
+		{"", nil},
+		{"ls  -r\tdir", []word{{Text: "ls", Pattern: "ls"}, {Text: "-r", Pattern: "-r"}, {Text: "dir", Pattern: "dir"}}},
+		{`touch 'a b' "c d"`, []word{{Text: "touch", Pattern: "touch"}, {Text: "a b", Pattern: "a b"}, {Text: "c d", Pattern: "c d"}}},
+		{`echo a\ b ""`, []word{{Text: "echo", Pattern: "echo"}, {Text: "a b", Pattern: "a b"}, {Text: "", Pattern: ""}}},
+		{`"say \"hi\""`, []word{{Text: `say "hi"`, Pattern: `say "hi"`}}},
+		{"*.txt", []word{{Text: "*.txt", Pattern: "*.txt", Glob: true}}},
+		{"'*'?", []word{{Text: "*?", Pattern: `\*?`, Glob: true}}},
+		{`\*`, []word{{Text: "*", Pattern: `\*`}}},
+		{"[ab]", []word{{Text: "[ab]", Pattern: `\[ab\]`}}},
+		{"[ab]*", []word{{Text: "[ab]*", Pattern: `\[ab\]*`, Glob: true}}},
+		{`trailing\`, []word{{Text: `trailing\`, Pattern: `trailing\\`}}},
+	}
+	for _, tt := range tests {
+		got, err := parse(tt.line)
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseUnterminatedQuote(t *testing.T) {
+	for _, line := range []string{`echo 'a`, `echo "a`} {
+		if _, err := parse(line); err == nil {
+			t.Errorf("parse(%q) succeeded, want an error", line)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package shell is a small command interpreter over a level filesystem. It
+// mirrors the commands offered by the frontend terminal so terminal levels can
+// be replayed and validated on the server.
+package shell
+
+import (
+	"file-explorers-be/models"
+	"fmt"
+	"strings"
+)
+
+// Shell holds a level filesystem and the currently open folder. The root
+// folder is represented by a nil folder id, as in the level JSON.
+type Shell struct {
+	files  []models.File
+	cwd    *int
+	nextID int
+}
+
+func New(state models.TerminalState) *Shell {
+	sh := &Shell{
+		files:  make([]models.File, len(state.FileSystem)),
+		nextID: state.NextID,
+	}
+	copy(sh.files, state.FileSystem)
+
+	for _, f := range sh.files {
+		if f.ID >= sh.nextID {
+			sh.nextID = f.ID + 1
+		}
+	}
+
+	if state.OpenFolder != nil {
+		if dir := sh.file(*state.OpenFolder); dir != nil && dir.IsDirectory {
+			sh.cwd = intPtr(dir.ID)
+		}
+	}
+	return sh
+}
+
+// State returns a snapshot of the filesystem that can be persisted and passed
+// back to New.
+func (sh *Shell) State() models.TerminalState {
+	files := make([]models.File, len(sh.files))
+	copy(files, sh.files)
+	return models.TerminalState{
+		FileSystem: files,
+		OpenFolder: sh.cwd,
+		NextID:     sh.nextID,
+	}
+}
+
+// Cwd returns the absolute path of the open folder.
+func (sh *Shell) Cwd() string {
+	return sh.path(sh.cwd)
+}
+
+// Run executes a single command line. Output is what the command printed on
+// success; a non-nil error carries the message a shell would print to stderr.
+func (sh *Shell) Run(line string) (output string, err error) {
+	words, err := parse(strings.TrimSpace(line))
+	if err != nil {
+		return "", err
+	}
+	if len(words) == 0 {
+		return "", nil
+	}
+
+	name := words[0].Text
+	cmd, ok := commands[name]
+	if !ok {
+		return "", fmt.Errorf("Command not found: %s", name)
+	}
+
+	args := make([]string, 0, len(words)-1)
+	for _, w := range words[1:] {
+		if !cmd.globs || !w.Glob {
+			args = append(args, w.Text)
+			continue
+		}
+		matches := sh.glob(w.Pattern)
+		if len(matches) == 0 {
+			return "", fmt.Errorf("%s: %s: No matches found", name, w.Text)
+		}
+		args = append(args, matches...)
+	}
+
+	return cmd.run(sh, args)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
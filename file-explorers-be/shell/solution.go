@@ -0,0 +1,60 @@
+package shell
+
+import "file-explorers-be/models"
+
+// Satisfies reports whether the shell's filesystem and open folder meet every
+// requirement of a level solution. It follows the rules of the frontend's
+// solutionValidator: requirements match files by id, or by name when no id is
+// given, and an isOpened requirement is met by the open folder.
+func (sh *Shell) Satisfies(solution []models.SolutionRequirement) bool {
+	return CheckSolution(sh.files, sh.cwd, solution)
+}
+
+func CheckSolution(files []models.File, openFolder *int, solution []models.SolutionRequirement) bool {
+	if len(solution) == 0 {
+		return false
+	}
+
+	for _, req := range solution {
+		if req.Type == "openFolder" || req.IsOpened {
+			if req.ID == nil || !sameID(openFolder, req.ID) {
+				return false
+			}
+			continue
+		}
+
+		if !checkRequirement(files, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRequirement matches a single requirement. When a requirement names a
+// file instead of giving its id (copies get new ids), any file with that name
+// may satisfy it.
+func checkRequirement(files []models.File, req models.SolutionRequirement) bool {
+	var candidates []*models.File
+	for i := range files {
+		if req.ID != nil && files[i].ID == *req.ID {
+			candidates = append(candidates, &files[i])
+		} else if req.ID == nil && req.Name != nil && files[i].Name == *req.Name {
+			candidates = append(candidates, &files[i])
+		}
+	}
+
+	if req.Removed {
+		return len(candidates) == 0
+	}
+
+	for _, file := range candidates {
+		if req.ID != nil && req.Name != nil && file.Name != *req.Name {
+			continue
+		}
+		if req.ParentDirectoryID.Set && !sameID(file.ParentDirectoryID, req.ParentDirectoryID.Value) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists eight digit passwords; six digit ones are their last six.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		got, err := Code(rfc6238Secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := Code(rfc6238Secret, now.Add(time.Duration(offset*Period)*time.Second))
+		got, ok := Validate(rfc6238Secret, code[:3]+" "+code[3:], now)
+		if !ok || got != step+offset {
+			t.Errorf("Validate code of step %+d = %d, %v; want %d, true", offset, got, ok, step+offset)
+		}
+	}
+
+	for _, offset := range []int64{-2, 2} {
+		code, _ := Code(rfc6238Secret, now.Add(time.Duration(offset*Period)*time.Second))
+		if _, ok := Validate(rfc6238Secret, code, now); ok {
+			t.Errorf("Validate accepted the code of step %+d", offset)
+		}
+	}
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfc6238Secret, code, now); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+}
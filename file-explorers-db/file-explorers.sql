@@ -6,20 +6,36 @@ USE file_explorers;
 CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(50) NOT NULL UNIQUE,
-    email VARCHAR(100) NOT NULL UNIQUE,
+    email VARCHAR(100) DEFAULT NULL UNIQUE,
     password_hash VARCHAR(255) NOT NULL,
+    token_version INT NOT NULL DEFAULT 0,
+    email_verified_at TIMESTAMP NULL DEFAULT NULL,
+    totp_secret VARCHAR(64) DEFAULT NULL,
+    totp_enabled_at TIMESTAMP NULL DEFAULT NULL,
+    totp_last_step BIGINT DEFAULT NULL,
+    is_guest BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen_at TIMESTAMP NULL DEFAULT NULL,
+    display_name VARCHAR(50) DEFAULT NULL,
+    avatar_url VARCHAR(255) DEFAULT NULL,
+    bio VARCHAR(500) DEFAULT NULL,
+    language VARCHAR(10) NOT NULL DEFAULT 'en',
+    pending_email VARCHAR(100) DEFAULT NULL,
+    deletion_requested_at TIMESTAMP NULL DEFAULT NULL,
+    erased_at TIMESTAMP NULL DEFAULT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-INSERT INTO users (username, email, password_hash)
+INSERT INTO users (username, email, password_hash, email_verified_at)
 VALUES (
     'demo_user',
     'demo@example.com',
-    '$2a$14$xFvq6IkBm8fp19GsEd24zONSMyUHVvcsZnFb9xpX//s0fr6ekoFpG'
+    '$2a$14$xFvq6IkBm8fp19GsEd24zONSMyUHVvcsZnFb9xpX//s0fr6ekoFpG',
+    CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS levels (
     level_Id INT AUTO_INCREMENT PRIMARY KEY,
+    level_type VARCHAR(20) NOT NULL DEFAULT 'gui',
     starting_file_system JSON NOT NULL,
     level_solution JSON NOT NULL,
     name VARCHAR(100) DEFAULT "",
@@ -377,13 +393,387 @@ INSERT INTO levels (starting_file_system, level_solution, name, description, dif
         }
     ]', 'Search', 'Finding files', 3, 'Find the civilian by searching for them in the search bar, then rename them to Bob');
 
+INSERT INTO levels (level_type, starting_file_system, level_solution, name, description, difficulty, instructions) VALUES
+    ('terminal', '[
+        {
+            "id": 0,
+            "name": "Documents",
+            "isDirectory": true,
+            "parentDirectoryId": null
+        },
+        {
+            "id": 1,
+            "name": "Downloads",
+            "isDirectory": true,
+            "parentDirectoryId": null
+        },
+        {
+            "id": 2,
+            "name": "report.txt",
+            "isDirectory": false,
+            "parentDirectoryId": 1
+        },
+        {
+            "id": 3,
+            "name": "Zombie_1.tmp",
+            "isDirectory": false,
+            "parentDirectoryId": 1
+        },
+        {
+            "id": 4,
+            "name": "Zombie_2.tmp",
+            "isDirectory": false,
+            "parentDirectoryId": 1
+        }
+    ]', '[
+        {
+            "id": 2,
+            "parentDirectoryId": 0
+        },
+        {
+            "id": 3,
+            "removed": true
+        },
+        {
+            "id": 4,
+            "removed": true
+        }
+    ]', 'Command line', 'Using the terminal', 3, 'Using only the terminal, move report.txt from Downloads into Documents and remove every .tmp zombie. Fewer commands and keystrokes give a higher score.');
+
+INSERT INTO levels (level_type, starting_file_system, level_solution, name, description, difficulty, instructions) VALUES
+    ('boolean', '[]', '{
+        "inputs": ["A", "B"],
+        "outputs": ["S", "C"],
+        "expressions": {
+            "S": "A xor B",
+            "C": "A and B"
+        }
+    }', 'Half adder', 'Logic gates', 2, 'Wire switches A and B to gates so that S is their sum bit and C is the carry bit. Fewer gates and a shallower circuit give a better score.'),
+    ('boolean', '[]', '{
+        "inputs": ["A", "B", "C"],
+        "outputs": ["Y"],
+        "truthTable": {
+            "Y": [0, 0, 0, 1, 0, 1, 1, 1]
+        }
+    }', 'Majority vote', 'Logic gates', 3, 'Y must be 1 when at least two of the switches A, B and C are on. Try to build it with NAND gates only.');
+
 CREATE TABLE IF NOT EXISTS user_levels (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT NOT NULL,
     level_id INT NOT NULL,
     solved_at TIMESTAMP DEFAULT NULL, 
     started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    command_count INT DEFAULT NULL,
+    keystrokes INT DEFAULT NULL,
+    score INT DEFAULT NULL,
+    gate_count INT DEFAULT NULL,
+    gate_depth INT DEFAULT NULL,
     UNIQUE KEY uniq_user_level (user_id, level_id),
-    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (level_id) REFERENCES levels(level_Id)
+);
+
+CREATE TABLE IF NOT EXISTS user_level_terminals (
+    user_id INT NOT NULL,
+    level_id INT NOT NULL,
+    file_system JSON NOT NULL,
+    open_folder INT DEFAULT NULL,
+    next_id INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, level_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (level_id) REFERENCES levels(level_Id)
+);
+
+CREATE TABLE IF NOT EXISTS terminal_commands (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    level_id INT NOT NULL,
+    command TEXT NOT NULL,
+    output TEXT,
+    error TEXT,
+    cwd VARCHAR(1024) NOT NULL,
+    replayed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_terminal_commands_user_level (user_id, level_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (level_id) REFERENCES levels(level_Id)
 );
+
+CREATE TABLE IF NOT EXISTS circuit_challenges (
+    challenge_id INT AUTO_INCREMENT PRIMARY KEY,
+    position INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    definition JSON DEFAULT NULL,
+    targets JSON NOT NULL,
+    tolerance DOUBLE NOT NULL DEFAULT 0.05,
+    points INT NOT NULL DEFAULT 10
+);
+
+INSERT INTO circuit_challenges (position, name, description, targets, tolerance, points) VALUES
+(1, 'Light the bulb', 'Connect a 9 V battery and a 100 ohm bulb so that current flows through the bulb.', '[
+        { "component": "bulb", "quantity": "current", "value": 0.09 }
+    ]', 0.05, 10),
+(2, 'Measure the current', 'Build a circuit with a 9 V battery and a 90 ohm resistor and measure 0.1 A with an ammeter.', '[
+        { "component": "ammeter", "quantity": "current", "value": 0.1 }
+    ]', 0.05, 20),
+(3, 'Voltage divider', 'Use two resistors in series on a 12 V battery so the voltmeter shows 4 V.', '[
+        { "component": "voltmeter", "quantity": "voltage", "value": 4 }
+    ]', 0.05, 30),
+(4, 'Alternating current', 'Switch the battery to AC with a 10 V peak and connect a 50 ohm resistor. The meter should read the RMS current.', '[
+        { "component": "resistor", "quantity": "current_rms", "value": 0.1414 },
+        { "component": "resistor", "quantity": "current_peak", "value": 0.2 }
+    ]', 0.05, 40);
+
+CREATE TABLE IF NOT EXISTS user_circuit_challenges (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    challenge_id INT NOT NULL,
+    completed_at TIMESTAMP NULL DEFAULT NULL,
+    points INT NOT NULL DEFAULT 0,
+    circuit JSON DEFAULT NULL,
+    UNIQUE KEY uniq_user_challenge (user_id, challenge_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (challenge_id) REFERENCES circuit_challenges(challenge_id)
+);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    workspace_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    current_version INT NOT NULL DEFAULT 1,
+    share_token CHAR(32) DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_workspace_share_token (share_token),
+    INDEX idx_workspaces_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS workspace_versions (
+    workspace_id INT NOT NULL,
+    version INT NOT NULL,
+    content JSON NOT NULL,
+    size INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (workspace_id, version),
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(workspace_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    family_id CHAR(32) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_refresh_token_hash (token_hash),
+    INDEX idx_refresh_tokens_family (family_id),
+    INDEX idx_refresh_tokens_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- A session is one login on one device. Its id is the refresh token family
+-- and the sid claim of the access tokens issued in it, so revoking the
+-- session stops both at once.
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL,
+    user_agent VARCHAR(255) DEFAULT NULL,
+    ip VARCHAR(45) DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_sessions_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti CHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX idx_revoked_tokens_expires (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    role_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    requires_2fa BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INT NOT NULL,
+    permission_id INT NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles(role_id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(permission_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INT NOT NULL,
+    role_id INT NOT NULL,
+    granted_by INT DEFAULT NULL,
+    granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles(role_id) ON DELETE CASCADE,
+    FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+INSERT INTO roles (name, requires_2fa) VALUES ('player', FALSE), ('teacher', TRUE), ('admin', TRUE);
+
+INSERT INTO permissions (name) VALUES
+    ('levels.author'),
+    ('classes.manage'),
+    ('users.moderate'),
+    ('roles.manage');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON p.name IN ('levels.author', 'classes.manage')
+WHERE r.name = 'teacher';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'admin';
+
+-- Everyone who already has an account is a player.
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.role_id
+FROM users u
+JOIN roles r ON r.name = 'player';
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose VARCHAR(20) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_email_token_hash (token_hash),
+    INDEX idx_email_tokens_user (user_id, purpose, created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_identity_subject (provider, subject),
+    UNIQUE KEY uniq_identity_user (user_id, provider),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state VARCHAR(64) PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    user_id INT DEFAULT NULL,
+    redirect VARCHAR(255) DEFAULT NULL,
+    subject VARCHAR(255) DEFAULT NULL,
+    email VARCHAR(255) DEFAULT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_recovery_codes_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_key VARCHAR(191) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP(3) NOT NULL,
+    INDEX idx_login_attempts_last (last_failure_at)
+);
+
+-- Erasure requests outlive the erasure itself: the user row stays behind,
+-- anonymised, so the leaderboard keeps its totals, and the completed request
+-- records what was removed.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    erase_after TIMESTAMP NOT NULL,
+    cancelled_at TIMESTAMP NULL DEFAULT NULL,
+    completed_at TIMESTAMP NULL DEFAULT NULL,
+    completed_by INT DEFAULT NULL,
+    summary JSON DEFAULT NULL,
+    INDEX idx_erasure_requests_due (completed_at, cancelled_at, erase_after),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (completed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Personal access tokens let scripts call the API without a login. Only the
+-- hash is stored; the prefix is kept so users can tell their tokens apart.
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_access_token_hash (token_hash),
+    INDEX idx_access_tokens_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- The audit log is append-only: the triggers refuse to change or remove
+-- entries. Actors are not foreign keys so entries outlive purged accounts.
+-- Names are looked up in users, so erased accounts show their erased name.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    actor_id INT DEFAULT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(20) DEFAULT NULL,
+    target_id VARCHAR(64) DEFAULT NULL,
+    details JSON DEFAULT NULL,
+    INDEX idx_audit_log_created (created_at),
+    INDEX idx_audit_log_actor (actor_id, created_at),
+    INDEX idx_audit_log_action (action, created_at),
+    INDEX idx_audit_log_target (target_type, target_id, created_at)
+);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+-- IP addresses of audit entries are kept apart from the log, so they can be
+-- purged after AUDIT_IP_RETENTION_DAYS and when an account is erased.
+CREATE TABLE IF NOT EXISTS audit_log_ips (
+    audit_id BIGINT PRIMARY KEY,
+    ip VARCHAR(45) NOT NULL,
+    created_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    INDEX idx_audit_log_ips_ip (ip),
+    INDEX idx_audit_log_ips_created (created_at),
+    FOREIGN KEY (audit_id) REFERENCES audit_log(id)
+);